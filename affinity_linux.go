@@ -0,0 +1,29 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Bind the calling OS thread to one CPU, returning a func that restores the CPUs it could run on
+// before. The thread must stay locked to its goroutine (runtime.LockOSThread) until restored
+func bindCPU(cpu int) (restore func(), err error) {
+	var before, mask [CPU_SET_SIZE / 64]uint64
+	if err := schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &before); err != nil {
+		return nil, err
+	}
+	mask[cpu/64] = 1 << (cpu % 64)
+	if err := schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &mask); err != nil {
+		return nil, err
+	}
+	return func() { schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &before) }, nil
+}
+
+// Get or set the calling thread's CPU affinity mask
+func schedAffinity(trap uintptr, mask *[CPU_SET_SIZE / 64]uint64) error {
+	_, _, errno := syscall.RawSyscall(trap, 0, unsafe.Sizeof(*mask), uintptr(unsafe.Pointer(mask)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
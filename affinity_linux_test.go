@@ -0,0 +1,35 @@
+package main
+
+import (
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestLockThreads_BindsDistributorsAndRestoresTheThread(t *testing.T) {
+	e := newTestEngineWithConfig(EngineConfig{lockThreads: true, cpus: []int{0, 0}})
+
+	// Run the distributors on this goroutine, locked so every check reads the same thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var before, after, during [CPU_SET_SIZE / 64]uint64
+	if err := schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &before); err != nil {
+		t.Fatalf("cannot read affinity: %v", err)
+	}
+
+	limit(e, 1, Bid, 100, 5, 1, GTC)
+	e.inputRing.Push(InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Ask, price: 100, size: 5, trader: 2})
+	e.Stop()
+	e.StartInputDistributor()
+	e.StartOutputDistributor(func(OutputEvent) { schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &during) })
+	if err := schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &after); err != nil {
+		t.Fatalf("cannot read affinity: %v", err)
+	}
+
+	if want := [CPU_SET_SIZE / 64]uint64{1}; during != want {
+		t.Fatalf("expected the output distributor bound to cpu 0 alone, got mask %x", during[0])
+	}
+	if after != before {
+		t.Fatalf("expected the thread's affinity restored to %x, got %x", before[0], after[0])
+	}
+}
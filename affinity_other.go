@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// CPU affinity is only set on Linux; elsewhere a locked distributor thread can still run on any CPU
+func bindCPU(cpu int) (restore func(), err error) {
+	return func() {}, nil
+}
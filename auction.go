@@ -0,0 +1,112 @@
+package main
+
+// StartAuction puts a symbol into a call auction: limit orders accumulate without matching (the
+// book may cross) until Uncross. Market, IOC, FOK and post-only orders are rejected with
+// REJECT_AUCTION, and amends re-queue without matching. Emits an AUCTION_EVENT if the symbol was
+// trading continuously. Must run on the matching goroutine (or send an AUCTION_EVENT command)
+func (e *MatchingEngine) StartAuction(symbol Symbol) {
+	if symbol >= MAX_SYMBOLS || e.auctions[symbol] {
+		return
+	}
+	e.auctions[symbol] = true
+	e.outputRing.Push(OutputEvent{eventType: AUCTION_EVENT, symbol: symbol})
+}
+
+// Uncross ends a symbol's call auction. It finds the clearing price that maximises executed volume
+// (ties going to the smallest imbalance between the buy and sell volume eligible at that price, then
+// to the price nearest the reference price, then to the lowest price) and crosses every eligible
+// order at it in price-time priority, emitting a pair of EXECUTION_EVENTs per match (the bid
+// reported as the taker, the ask as the maker). Self-trade prevention does not apply to the uncross. An
+// UNCROSS_EVENT follows with the clearing price and total volume (both 0 if nothing crossed), and
+// continuous trading resumes. Must run on the matching goroutine (or send an UNCROSS_EVENT command)
+func (e *MatchingEngine) Uncross(symbol Symbol) {
+	if symbol >= MAX_SYMBOLS || !e.auctions[symbol] {
+		return
+	}
+	e.auctions[symbol] = false
+	book := &e.books[symbol]
+
+	price := e.clearingPrice(symbol, book)
+	var volume Size
+	for price != 0 && book.bidMax >= price && book.askMin <= price {
+		bidLevel, askLevel := &book.bidLevels[book.bidMax], &book.askLevels[book.askMin]
+		bidSlot, askSlot := bidLevel.headSlot, askLevel.headSlot
+		bid, ask := e.pool.get(bidSlot), e.pool.get(askSlot)
+		fillSize := min(bid.size, ask.size)
+
+		e.fill(book, askLevel, askSlot, fillSize, price, symbol, bid.trader, bid.id)
+		e.reduceResting(bidLevel, bidSlot, fillSize)
+		volume += fillSize
+
+		if askLevel.headSlot == 0 {
+			book.updateAskMin()
+		}
+		if bidLevel.headSlot == 0 {
+			book.updateBidMax()
+		}
+	}
+	if volume == 0 {
+		price = 0
+	}
+
+	e.outputRing.Push(OutputEvent{eventType: UNCROSS_EVENT, symbol: symbol, price: price, size: volume})
+	e.triggerStops(book)
+}
+
+// Price (on the symbol's tick grid) at which the crossed part of the book clears, or 0 if it is not crossed
+func (e *MatchingEngine) clearingPrice(symbol Symbol, book *OrderBook) Price {
+	lo, hi := book.askMin, book.bidMax
+	if hi == 0 || lo >= book.priceLevels() || lo > hi {
+		return 0
+	}
+
+	// Open quantity (including iceberg reserve) per price across the crossed range; orders outside
+	// it cannot execute at any clearing price
+	bidQty := make([]uint64, hi-lo+1)
+	askQty := make([]uint64, hi-lo+1)
+	for price := lo; price <= hi; price++ {
+		for slot := book.bidLevels[price].headSlot; slot != 0; slot = e.pool.get(slot).nextSlot {
+			bidQty[price-lo] += uint64(e.pool.get(slot).size + e.pool.get(slot).reserve)
+		}
+		for slot := book.askLevels[price].headSlot; slot != 0; slot = e.pool.get(slot).nextSlot {
+			askQty[price-lo] += uint64(e.pool.get(slot).size + e.pool.get(slot).reserve)
+		}
+	}
+
+	// Cumulative buy volume at or above each price, from the top down
+	bidCum := make([]uint64, len(bidQty))
+	var cum uint64
+	for i := len(bidQty) - 1; i >= 0; i-- {
+		cum += bidQty[i]
+		bidCum[i] = cum
+	}
+
+	ref := e.referencePrices[symbol]
+	if ref == 0 {
+		ref = book.lastPrice
+	}
+	distance := func(p Price) Price {
+		if ref == 0 {
+			return 0
+		}
+		return max(p, ref) - min(p, ref)
+	}
+
+	var best Price
+	var bestVolume, bestImbalance uint64
+	var askCum uint64
+	for price := lo; price <= hi; price++ {
+		askCum += askQty[price-lo] // Cumulative sell volume at or below price
+		if !e.validTick(symbol, price) {
+			continue
+		}
+
+		buy, sell := bidCum[price-lo], askCum
+		volume, imbalance := min(buy, sell), max(buy, sell)-min(buy, sell)
+		if best == 0 || volume > bestVolume || (volume == bestVolume && (imbalance < bestImbalance ||
+			(imbalance == bestImbalance && distance(price) < distance(best)))) {
+			best, bestVolume, bestImbalance = price, volume, imbalance
+		}
+	}
+	return best
+}
@@ -0,0 +1,125 @@
+package main
+
+import "testing"
+
+func TestAuction_OrdersRestWithoutMatching(t *testing.T) {
+	e := newTestEngine()
+	e.StartAuction(1)
+	e.StartAuction(1) // Already in auction: no second event
+
+	limit(e, 1, Bid, 105, 5, 1, GTC)
+	limit(e, 1, Ask, 100, 5, 2, GTC) // Crosses, but only rests
+	limit(e, 1, Ask, 100, 5, 2, IOC)
+	e.Market(&InputCommand{symbol: 1, side: Ask, size: 5, trader: 2})
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 90, size: 5, trader: 1, postOnly: true})
+
+	evs := drainOutputEvents(e)
+	if len(evs) != 8 || evs[0].eventType != AUCTION_EVENT || evs[1].eventType != ORDER_EVENT || evs[2].eventType != RESTED_EVENT ||
+		evs[3].eventType != ORDER_EVENT || evs[4].eventType != RESTED_EVENT {
+		t.Fatalf("expected AUCTION_EVENT and two resting orders first, got %+v", evs)
+	}
+	for i, ev := range evs[5:] {
+		if ev.eventType != REJECT_EVENT || ev.reason != REJECT_AUCTION {
+			t.Fatalf("event %d: expected REJECT_AUCTION, got %+v", i+5, ev)
+		}
+	}
+	if book := &e.books[1]; book.bidMax != 105 || book.askMin != 100 {
+		t.Fatalf("expected a crossed book 105 / 100, got %d / %d", book.bidMax, book.askMin)
+	}
+
+	// Amending into the other side does not trade either
+	e.Amend(evs[1].orderID, 110, 5, evs[1].trader)
+	for _, ev := range drainOutputEvents(e) {
+		if ev.eventType == EXECUTION_EVENT {
+			t.Fatalf("expected no executions during the auction, got %+v", ev)
+		}
+	}
+}
+
+// Helper to build the book used by the uncross tests, then uncross it
+func uncrossTestBook(e *MatchingEngine) []OutputEvent {
+	e.StartAuction(1)
+	limit(e, 1, Bid, 102, 10, 1, GTC)
+	limit(e, 1, Bid, 101, 5, 2, GTC)
+	limit(e, 1, Bid, 100, 10, 3, GTC)
+	limit(e, 1, Ask, 99, 8, 4, GTC)
+	limit(e, 1, Ask, 100, 7, 5, GTC)
+	limit(e, 1, Ask, 101, 10, 6, GTC)
+	drainOutputEvents(e)
+
+	// Both 100 and 101 execute 15 with an imbalance of 10
+	e.Uncross(1)
+	return drainOutputEvents(e)
+}
+
+func TestUncross_MaximisesVolumeInPriceTimePriority(t *testing.T) {
+	e := newTestEngine()
+	e.SetReferencePrice(1, 101) // Breaks the volume and imbalance tie
+	evs := takerEvents(uncrossTestBook(e))
+
+	expected := []struct {
+		trader TraderID
+		size   Size
+	}{{1, 8}, {1, 2}, {2, 5}} // Bid traders, best bid first
+	if len(evs) != len(expected)+1 {
+		t.Fatalf("expected %d executions and an UNCROSS_EVENT, got %+v", len(expected), evs)
+	}
+	for i, want := range expected {
+		if ev := evs[i]; ev.eventType != EXECUTION_EVENT || ev.price != 101 || ev.trader != want.trader || ev.size != want.size {
+			t.Fatalf("execution %d: expected trader %d for %d @ 101, got %+v", i, want.trader, want.size, ev)
+		}
+	}
+	if ev := evs[len(evs)-1]; ev.eventType != UNCROSS_EVENT || ev.price != 101 || ev.size != 15 {
+		t.Fatalf("expected UNCROSS_EVENT 15 @ 101, got %+v", ev)
+	}
+
+	// Continuous trading resumes on an uncrossed book
+	if book := &e.books[1]; book.bidMax != 100 || book.askMin != 101 {
+		t.Fatalf("expected book 100 / 101 after the uncross, got %d / %d", book.bidMax, book.askMin)
+	}
+	limit(e, 1, Bid, 101, 1, 7, GTC)
+	if fills := fillsByCounterOrder(takerEvents(drainOutputEvents(e))); len(fills) != 1 {
+		t.Fatalf("expected an order to trade after the uncross, got %v", fills)
+	}
+}
+
+func TestUncross_TieBreaks(t *testing.T) {
+	// Without a reference price, equal volume and imbalance go to the lower price
+	e := newTestEngine()
+	if evs := uncrossTestBook(e); evs[len(evs)-1].price != 100 {
+		t.Fatalf("expected to clear at 100 with no reference, got %+v", evs[len(evs)-1])
+	}
+
+	// Imbalance is preferred over closeness to the reference price
+	e = newTestEngine()
+	e.SetReferencePrice(1, 100)
+	e.StartAuction(1)
+	limit(e, 1, Bid, 101, 10, 1, GTC)
+	limit(e, 1, Bid, 100, 4, 1, GTC)
+	limit(e, 1, Ask, 100, 10, 2, GTC)
+	limit(e, 1, Ask, 101, 3, 2, GTC)
+	drainOutputEvents(e)
+
+	e.Uncross(1) // 10 executes at either price, with imbalance 4 at 100 and 3 at 101
+	evs := drainOutputEvents(e)
+	if ev := evs[len(evs)-1]; ev.eventType != UNCROSS_EVENT || ev.price != 101 || ev.size != 10 {
+		t.Fatalf("expected UNCROSS_EVENT 10 @ 101, got %+v", ev)
+	}
+}
+
+func TestUncross_NothingCrossed(t *testing.T) {
+	e := newTestEngine()
+	e.StartAuction(1)
+	limit(e, 1, Bid, 99, 5, 1, GTC)
+	limit(e, 1, Ask, 100, 5, 2, GTC)
+	drainOutputEvents(e)
+
+	e.Uncross(1)
+	evs := drainOutputEvents(e)
+	if len(evs) != 1 || evs[0].eventType != UNCROSS_EVENT || evs[0].price != 0 || evs[0].size != 0 {
+		t.Fatalf("expected an empty UNCROSS_EVENT, got %+v", evs)
+	}
+	if e.auctions[1] {
+		t.Fatal("expected the auction to end")
+	}
+}
@@ -0,0 +1,40 @@
+//go:build !purespin
+
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+const (
+	BACKOFF_SPINS  = 1 << 12               // Empty polls spun tight before backing off, so a busy ring sees no added latency
+	BACKOFF_YIELDS = 1 << 6                // Then polls that first yield the processor (runtime.Gosched)
+	BACKOFF_SLEEP  = 50 * time.Microsecond // Then the sleep before each poll, so an idle ring costs next to no CPU
+)
+
+// Escalating wait between empty polls of the ring buffers' blocking loops: a tight spin, then
+// yields, then short sleeps. The zero value starts from the tight spin; use a fresh one per wait.
+// Build with -tags purespin for the latency-optimized pure busy-spin (see backoff_purespin.go)
+type backoff struct {
+	polls uint32
+}
+
+// Wait before the next poll
+func (b *backoff) wait() {
+	switch {
+	case b.polls < BACKOFF_SPINS:
+		b.polls++
+	case b.polls < BACKOFF_SPINS+BACKOFF_YIELDS:
+		b.polls++
+		runtime.Gosched()
+	default:
+		time.Sleep(BACKOFF_SLEEP)
+	}
+}
+
+// Report whether the wait has escalated to sleeping, when each poll is slow enough that a caller
+// can afford to check a context or clock every time
+func (b *backoff) sleeping() bool {
+	return b.polls >= BACKOFF_SPINS+BACKOFF_YIELDS
+}
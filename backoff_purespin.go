@@ -0,0 +1,13 @@
+//go:build purespin
+
+package main
+
+// Pure busy-spin between empty polls, for the lowest latency at the cost of a core per waiting
+// loop. Selected with -tags purespin (the default backs off; see backoff.go)
+type backoff struct{}
+
+func (b *backoff) wait() {}
+
+func (b *backoff) sleeping() bool {
+	return false
+}
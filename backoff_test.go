@@ -0,0 +1,41 @@
+//go:build !purespin
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff_EscalatesToSleeping(t *testing.T) {
+	var b backoff
+	for i := 0; i < BACKOFF_SPINS+BACKOFF_YIELDS; i++ {
+		if b.sleeping() {
+			t.Fatalf("expected to still be spinning or yielding after %d waits", i)
+		}
+		b.wait()
+	}
+	if !b.sleeping() {
+		t.Fatal("expected to be sleeping once the spins and yields are used up")
+	}
+
+	start := time.Now()
+	b.wait()
+	if elapsed := time.Since(start); elapsed < BACKOFF_SLEEP {
+		t.Fatalf("expected a sleep of at least %v, took %v", BACKOFF_SLEEP, elapsed)
+	}
+}
+
+// Backing off must not make a timed read on an idle ring overshoot its deadline by much
+func TestRingBuffer_ReadTimeoutPromptWhileBackedOff(t *testing.T) {
+	r := NewRingBuffer[int](8)
+	out := make([]int, 1)
+
+	start := time.Now()
+	if n := r.ReadTimeout(out, 20*time.Millisecond); n != 0 {
+		t.Fatalf("expected nothing read, got %d", n)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Fatalf("expected to give up after about 20ms, took %v", elapsed)
+	}
+}
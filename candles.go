@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// OHLCV bar for one symbol over [start, start+interval)
+type Candle struct {
+	symbol                 Symbol
+	start                  int64 // Bucket start (unix nanos, a multiple of the interval)
+	open, high, low, close Price
+	volume                 uint64 // Total traded size
+	trades                 uint32
+}
+
+// CandleAggregator builds fixed-interval candles per symbol from trades, bucketed by the time the
+// caller attaches to each trade. A candle is emitted exactly once, when its interval has ended:
+// either a later trade for any symbol moves time past it, or Advance is called (on a timer, so
+// sparsely traded symbols still close on time). Intervals with no trades produce no candle.
+// Safe for concurrent use, so Advance can run on its own ticker alongside the trade feed
+type CandleAggregator struct {
+	mu       sync.Mutex
+	interval int64
+	onCandle func(Candle)
+	current  [MAX_SYMBOLS]Candle // Open candle per symbol (no trades means none open)
+	nextEnd  int64               // Earliest end of any open candle, so Advance can skip the scan
+}
+
+// NewCandleAggregator creates an aggregator that passes each completed candle to onCandle (called
+// with the aggregator locked, so it must not call back into it)
+func NewCandleAggregator(interval time.Duration, onCandle func(Candle)) *CandleAggregator {
+	return &CandleAggregator{interval: int64(interval), onCandle: onCandle, nextEnd: 1<<63 - 1}
+}
+
+// AddTrade folds a trade made at time now (unix nanos) into its symbol's candle, first closing any
+// candles that ended by now. A trade timestamped before its symbol's open candle (out of order) is
+// counted in the open candle rather than reopening one already emitted
+func (a *CandleAggregator) AddTrade(now int64, tr Trade) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.advance(now)
+
+	candle := &a.current[tr.symbol]
+	if candle.trades == 0 {
+		start := now - now%a.interval
+		*candle = Candle{symbol: tr.symbol, start: start, open: tr.price, high: tr.price, low: tr.price}
+		a.nextEnd = min(a.nextEnd, start+a.interval)
+	}
+	candle.high = max(candle.high, tr.price)
+	candle.low = min(candle.low, tr.price)
+	candle.close = tr.price
+	candle.volume += uint64(tr.size)
+	candle.trades++
+}
+
+// Add is AddTrade for an output event stream; events other than executions, and the maker report
+// of each fill (the trade is counted once, from its taker report), are ignored
+func (a *CandleAggregator) Add(now int64, ev OutputEvent) {
+	if ev.eventType == EXECUTION_EVENT && !ev.maker {
+		a.AddTrade(now, tradeOf(&ev))
+	}
+}
+
+// Advance emits every open candle whose interval ended by now (unix nanos)
+func (a *CandleAggregator) Advance(now int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.advance(now)
+}
+
+func (a *CandleAggregator) advance(now int64) {
+	if now < a.nextEnd {
+		return
+	}
+
+	a.nextEnd = 1<<63 - 1
+	for symbol := range a.current {
+		candle := &a.current[symbol]
+		if candle.trades == 0 {
+			continue
+		}
+		if end := candle.start + a.interval; end <= now {
+			a.onCandle(*candle)
+			*candle = Candle{}
+		} else {
+			a.nextEnd = min(a.nextEnd, end)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCandles_BucketsAndEmitsOnce(t *testing.T) {
+	var candles []Candle
+	a := NewCandleAggregator(time.Second, func(c Candle) { candles = append(candles, c) })
+	sec := int64(time.Second)
+
+	a.AddTrade(0*sec+1, Trade{symbol: 1, price: 100, size: 2})
+	a.AddTrade(0*sec+2, Trade{symbol: 1, price: 104, size: 1})
+	a.AddTrade(0*sec+3, Trade{symbol: 1, price: 98, size: 3})
+	a.AddTrade(0*sec+4, Trade{symbol: 1, price: 101, size: 1})
+	a.AddTrade(0*sec+5, Trade{symbol: 2, price: 50, size: 7})
+	if len(candles) != 0 {
+		t.Fatalf("expected no candles before the interval ends, got %v", candles)
+	}
+
+	// A symbol 1 trade in the next second closes both symbols' first candles
+	a.AddTrade(1*sec, Trade{symbol: 1, price: 102, size: 1})
+	expected := Candle{symbol: 1, start: 0, open: 100, high: 104, low: 98, close: 101, volume: 7, trades: 4}
+	if len(candles) != 2 || candles[0] != expected {
+		t.Fatalf("expected symbol 1 candle %+v first of 2, got %+v", expected, candles)
+	}
+	if candles[1].symbol != 2 || candles[1].volume != 7 || candles[1].open != 50 {
+		t.Fatalf("expected the sparse symbol 2 candle to close too, got %+v", candles[1])
+	}
+
+	// Advancing to the same time again, or with nothing open, emits nothing new
+	a.Advance(1 * sec)
+	a.Advance(5 * sec)
+	a.Advance(6 * sec)
+	if len(candles) != 3 || candles[2].start != 1*sec || candles[2].close != 102 {
+		t.Fatalf("expected exactly one more candle for second 1, got %+v", candles)
+	}
+}
+
+func TestCandles_AddIgnoresNonExecutions(t *testing.T) {
+	var candles []Candle
+	a := NewCandleAggregator(time.Second, func(c Candle) { candles = append(candles, c) })
+
+	a.Add(1, OutputEvent{eventType: ORDER_EVENT, symbol: 1, price: 100, size: 5})
+	a.Add(2, OutputEvent{eventType: EXECUTION_EVENT, symbol: 1, price: 100, size: 5})
+	a.Advance(int64(time.Second))
+
+	if len(candles) != 1 || candles[0].trades != 1 || candles[0].volume != 5 {
+		t.Fatalf("expected one candle from the single execution, got %+v", candles)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Fixed-layout binary frame for an InputCommand: a 1-byte message type (the EventType) followed by
+// the command's fields, little-endian, in struct order (except the in-process Submit token)
+const COMMAND_FRAME_SIZE = 1 + 4 + 4 + 4 + 4 + 4 + 8 + 8 + 8 + 8 + 2 + 2 + 1 + 1 + 1
+
+// Bits of the frame's flags byte
+const (
+	FRAME_POST_ONLY   = 1 << iota // InputCommand.postOnly
+	FRAME_REDUCE_ONLY             // InputCommand.reduceOnly
+)
+
+var (
+	ErrFrameShort   = errors.New("codec: frame shorter than COMMAND_FRAME_SIZE")
+	ErrFrameInvalid = errors.New("codec: frame has an unknown message type or out-of-range field")
+)
+
+// AppendCommand appends the binary frame for cmd to buf
+func AppendCommand(buf []byte, cmd *InputCommand) []byte {
+	var flags byte
+	if cmd.postOnly {
+		flags |= FRAME_POST_ONLY
+	}
+	if cmd.reduceOnly {
+		flags |= FRAME_REDUCE_ONLY
+	}
+
+	buf = append(buf, byte(cmd.eventType))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(cmd.price))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(cmd.size))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(cmd.peakSize))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(cmd.stopPrice))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(cmd.trailOffset))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(cmd.expiresAt))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(cmd.orderID))
+	buf = binary.LittleEndian.AppendUint64(buf, cmd.clOrdID)
+	buf = binary.LittleEndian.AppendUint64(buf, cmd.groupID)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(cmd.symbol))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(cmd.trader))
+	buf = append(buf, byte(cmd.side), byte(cmd.tif), flags)
+	return buf
+}
+
+// DecodeCommand decodes one frame from the start of frame into cmd without allocating. Short frames
+// and frames with an unknown message type, side, time in force or flag bit are rejected, leaving cmd
+// unchanged
+func DecodeCommand(frame []byte, cmd *InputCommand) error {
+	if len(frame) < COMMAND_FRAME_SIZE {
+		return ErrFrameShort
+	}
+
+	eventType, side, tif, flags := EventType(frame[0]), Side(frame[57]), TimeInForce(frame[58]), frame[59]
+	if eventType == INVALID_EVENT || int(eventType) >= len(eventTypeNames) || side > Ask || tif > GTD || flags&^(FRAME_POST_ONLY|FRAME_REDUCE_ONLY) != 0 {
+		return ErrFrameInvalid
+	}
+
+	*cmd = InputCommand{
+		eventType:   eventType,
+		price:       Price(binary.LittleEndian.Uint32(frame[1:])),
+		size:        Size(binary.LittleEndian.Uint32(frame[5:])),
+		peakSize:    Size(binary.LittleEndian.Uint32(frame[9:])),
+		stopPrice:   Price(binary.LittleEndian.Uint32(frame[13:])),
+		trailOffset: Price(binary.LittleEndian.Uint32(frame[17:])),
+		expiresAt:   int64(binary.LittleEndian.Uint64(frame[21:])),
+		orderID:     OrderID(binary.LittleEndian.Uint64(frame[29:])),
+		clOrdID:     binary.LittleEndian.Uint64(frame[37:]),
+		groupID:     binary.LittleEndian.Uint64(frame[45:]),
+		symbol:      Symbol(binary.LittleEndian.Uint16(frame[53:])),
+		trader:      TraderID(binary.LittleEndian.Uint16(frame[55:])),
+		side:        side,
+		tif:         tif,
+		postOnly:    flags&FRAME_POST_ONLY != 0,
+		reduceOnly:  flags&FRAME_REDUCE_ONLY != 0,
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestCodec_RoundTrip(t *testing.T) {
+	cmd := InputCommand{
+		eventType:   ORDER_EVENT,
+		price:       1234,
+		size:        99,
+		peakSize:    10,
+		stopPrice:   1200,
+		trailOffset: 25,
+		expiresAt:   1_700_000_000_000_000_000,
+		orderID:     OrderID(7)<<SLOT_BITS | 42,
+		clOrdID:     1<<64 - 1,
+		groupID:     1<<40 + 3,
+		symbol:      255,
+		trader:      65535,
+		side:        Ask,
+		tif:         GTD,
+		postOnly:    true,
+		reduceOnly:  true,
+	}
+
+	frame := AppendCommand(nil, &cmd)
+	if len(frame) != COMMAND_FRAME_SIZE {
+		t.Fatalf("expected a %d byte frame, got %d", COMMAND_FRAME_SIZE, len(frame))
+	}
+
+	var decoded InputCommand
+	if err := DecodeCommand(frame, &decoded); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if decoded != cmd {
+		t.Fatalf("round trip mismatch: expected %+v, got %+v", cmd, decoded)
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { DecodeCommand(frame, &decoded) }); allocs != 0 {
+		t.Fatalf("expected decoding not to allocate, got %v allocs", allocs)
+	}
+}
+
+func TestCodec_RejectsMalformedFrames(t *testing.T) {
+	frame := AppendCommand(nil, &InputCommand{eventType: CANCEL_EVENT, orderID: 1})
+
+	var cmd InputCommand
+	if err := DecodeCommand(frame[:COMMAND_FRAME_SIZE-1], &cmd); err != ErrFrameShort {
+		t.Fatalf("expected ErrFrameShort, got %v", err)
+	}
+
+	for name, corrupt := range map[string]func(f []byte){
+		"message type": func(f []byte) { f[0] = 0xff },
+		"side":         func(f []byte) { f[57] = 2 },
+		"tif":          func(f []byte) { f[58] = 9 },
+		"flags":        func(f []byte) { f[59] = 0x80 },
+	} {
+		bad := append([]byte(nil), frame...)
+		corrupt(bad)
+		if err := DecodeCommand(bad, &cmd); err != ErrFrameInvalid {
+			t.Fatalf("%s: expected ErrFrameInvalid, got %v", name, err)
+		}
+	}
+}
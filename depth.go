@@ -0,0 +1,130 @@
+package main
+
+// Aggregated view of one price level for market data
+type PriceLevelView struct {
+	price Price
+	size  Size // Total visible quantity (hidden iceberg reserve is excluded)
+}
+
+// Depth returns the top levels non-empty price levels on each side of a symbol's book, best price
+// first. It reads the book directly, so it must run on the matching thread (or while it is idle)
+func (e *MatchingEngine) Depth(symbol Symbol, levels int) ([]PriceLevelView, []PriceLevelView) {
+	if symbol >= MAX_SYMBOLS || levels <= 0 {
+		return nil, nil
+	}
+	book := &e.books[symbol]
+
+	var bids, asks []PriceLevelView
+	// Jump between non-empty levels with the price bitmaps rather than scanning every tick
+	for price := book.bidBits.prev(book.bidMax); price > 0 && len(bids) < levels; price = book.bidBits.prev(price - 1) {
+		bids = append(bids, PriceLevelView{price: price, size: book.bidLevels[price].volume})
+	}
+	for price := book.askBits.next(book.askMin); price < book.priceLevels() && len(asks) < levels; price = book.askBits.next(price + 1) {
+		asks = append(asks, PriceLevelView{price: price, size: book.askLevels[price].volume})
+	}
+	return bids, asks
+}
+
+// LastTrade returns the price and size of a symbol's most recent trade, or false if it has never
+// traded. Must run on the matching thread (or while it is idle), like Depth
+func (e *MatchingEngine) LastTrade(symbol Symbol) (Price, Size, bool) {
+	if symbol >= MAX_SYMBOLS || e.books[symbol].lastPrice == 0 {
+		return 0, 0, false
+	}
+	book := &e.books[symbol]
+	return book.lastPrice, book.lastSize, true
+}
+
+// Spread returns the best ask minus the best bid, or false if either side of the book is empty.
+// A locked or crossed book reports a spread of 0 rather than underflowing
+func (e *MatchingEngine) Spread(symbol Symbol) (Price, bool) {
+	if symbol >= MAX_SYMBOLS {
+		return 0, false
+	}
+	book := &e.books[symbol]
+	if book.bidMax == 0 || book.askMin == book.priceLevels() {
+		return 0, false
+	}
+	if book.askMin <= book.bidMax {
+		return 0, true
+	}
+	return book.askMin - book.bidMax, true
+}
+
+// Mid returns the midpoint of the best bid and best ask, or false if either side of the book is empty
+func (e *MatchingEngine) Mid(symbol Symbol) (float64, bool) {
+	if symbol >= MAX_SYMBOLS {
+		return 0, false
+	}
+	book := &e.books[symbol]
+	if book.bidMax == 0 || book.askMin == book.priceLevels() {
+		return 0, false
+	}
+	return (float64(book.bidMax) + float64(book.askMin)) / 2, true
+}
+
+// Microprice returns the size-weighted mid of the best bid and best ask,
+// (bidPrice*askSize + askPrice*bidSize) / (bidSize + askSize), with each size the best level's visible
+// volume. It leans towards the price with less volume behind it, the one more likely to trade through
+// next, so it estimates fair value better than Mid. Reports false if either side of the book is empty
+func (e *MatchingEngine) Microprice(symbol Symbol) (float64, bool) {
+	if symbol >= MAX_SYMBOLS {
+		return 0, false
+	}
+	book := &e.books[symbol]
+	if book.bidMax == 0 || book.askMin == book.priceLevels() {
+		return 0, false
+	}
+	bidSize, askSize := float64(book.bidLevels[book.bidMax].volume), float64(book.askLevels[book.askMin].volume)
+	return (float64(book.bidMax)*askSize + float64(book.askMin)*bidSize) / (bidSize + askSize), true
+}
+
+// EstimateFill dry-runs a market order of size against the opposite side of the book, returning the
+// volume-weighted average price and the quantity that would fill (less than size if the book is too
+// thin). It walks the same price bounds as match and counts hidden iceberg reserve, but ignores
+// self-trade prevention. Nothing is modified
+func (e *MatchingEngine) EstimateFill(symbol Symbol, side Side, size Size) (avgPrice float64, filled Size) {
+	if symbol >= MAX_SYMBOLS || size == 0 {
+		return 0, 0
+	}
+
+	var notional float64
+	book := &e.books[symbol]
+	e.walkCrossing(book, side, book.limitPrice(side, 0), func(order *Order) bool {
+		fillSize := min(size-filled, order.size+order.reserve)
+		notional += float64(order.price) * float64(fillSize)
+		filled += fillSize
+		return filled < size
+	})
+
+	if filled == 0 {
+		return 0, 0
+	}
+	return notional / float64(filled), filled
+}
+
+// DepthToFill dry-runs a market order of size like EstimateFill, reporting how far it would move the
+// market instead: the worst (last) price it would trade at and how many price levels it would take
+// liquidity from. On a book too thin to cover size, fullyFilled is false and the price and levels are
+// those of all the volume there is (0 and 0 for an empty side). A size of 0 needs no liquidity and
+// reports fullyFilled at once. Nothing is modified
+func (e *MatchingEngine) DepthToFill(symbol Symbol, side Side, size Size) (worstPrice Price, levelsConsumed int, fullyFilled bool) {
+	if size == 0 {
+		return 0, 0, true
+	}
+	if symbol >= MAX_SYMBOLS {
+		return 0, 0, false
+	}
+
+	var filled Size
+	book := &e.books[symbol]
+	e.walkCrossing(book, side, book.limitPrice(side, 0), func(order *Order) bool {
+		if order.price != worstPrice {
+			worstPrice = order.price
+			levelsConsumed++
+		}
+		filled += min(size-filled, order.size+order.reserve)
+		return filled < size
+	})
+	return worstPrice, levelsConsumed, filled == size
+}
@@ -0,0 +1,172 @@
+package main
+
+import "testing"
+
+func TestDepth_AggregatesTopLevels(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 3, 1, GTC)
+	e.Limit(1, Bid, 10, 4, 2, GTC)
+	e.Limit(1, Bid, 8, 5, 1, GTC)
+	e.Limit(1, Bid, 5, 1, 1, GTC)
+	e.Limit(1, Ask, 12, 2, 3, GTC)
+	e.Limit(1, Ask, 15, 6, 3, GTC)
+
+	bids, asks := e.Depth(1, 2)
+
+	wantBids := []PriceLevelView{{price: 10, size: 7}, {price: 8, size: 5}}
+	if len(bids) != len(wantBids) || bids[0] != wantBids[0] || bids[1] != wantBids[1] {
+		t.Fatalf("expected bids %+v, got %+v", wantBids, bids)
+	}
+	wantAsks := []PriceLevelView{{price: 12, size: 2}, {price: 15, size: 6}}
+	if len(asks) != len(wantAsks) || asks[0] != wantAsks[0] || asks[1] != wantAsks[1] {
+		t.Fatalf("expected asks %+v, got %+v", wantAsks, asks)
+	}
+}
+
+func TestDepth_EmptyBook(t *testing.T) {
+	e := newTestEngine()
+
+	bids, asks := e.Depth(1, 10)
+	if len(bids) != 0 || len(asks) != 0 {
+		t.Fatalf("expected empty depth, got %+v %+v", bids, asks)
+	}
+}
+
+func TestSpreadAndMid(t *testing.T) {
+	e := newTestEngine()
+
+	if _, ok := e.Spread(1); ok {
+		t.Fatalf("expected no spread for an empty book")
+	}
+	e.Limit(1, Bid, 10, 1, 1, GTC)
+	if _, ok := e.Mid(1); ok {
+		t.Fatalf("expected no mid with an empty ask side")
+	}
+
+	e.Limit(1, Ask, 13, 1, 2, GTC)
+	if spread, ok := e.Spread(1); !ok || spread != 3 {
+		t.Fatalf("expected spread 3, got %d %v", spread, ok)
+	}
+	if mid, ok := e.Mid(1); !ok || mid != 11.5 {
+		t.Fatalf("expected mid 11.5, got %v %v", mid, ok)
+	}
+
+	// A crossed book (not reachable through matching) reports a zero spread
+	e.books[1].bidMax = 14
+	if spread, ok := e.Spread(1); !ok || spread != 0 {
+		t.Fatalf("expected spread 0 for a crossed book, got %d %v", spread, ok)
+	}
+}
+
+func TestMicroprice_LeansTowardsTheThinnerSide(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 3, 1, GTC)
+	if _, ok := e.Microprice(1); ok {
+		t.Fatalf("expected no microprice with an empty ask side")
+	}
+	e.Limit(1, Ask, 14, 1, 2, GTC)
+	e.Limit(1, Bid, 9, 50, 1, GTC) // Behind the best bid, so not counted
+
+	// (10*1 + 14*3) / (3+1): the thin ask pulls it up from the mid of 12
+	if micro, ok := e.Microprice(1); !ok || micro != 13 {
+		t.Fatalf("expected microprice 13, got %v %v", micro, ok)
+	}
+
+	e.Limit(1, Ask, 14, 2, 2, GTC)
+	if micro, ok := e.Microprice(1); !ok || micro != 12 {
+		t.Fatalf("expected equal sizes to give the mid of 12, got %v %v", micro, ok)
+	}
+}
+
+func TestEstimateFill_WalksOppositeSide(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 2, 1, GTC)
+	e.Limit(1, Ask, 12, 4, 1, GTC)
+
+	if avg, filled := e.EstimateFill(1, Bid, 4); filled != 4 || avg != 11 {
+		t.Fatalf("expected 4 filled at an average of 11, got %d at %v", filled, avg)
+	}
+	if avg, filled := e.EstimateFill(1, Bid, 10); filled != 6 || avg != 68.0/6 {
+		t.Fatalf("expected 6 filled at an average of %v, got %d at %v", 68.0/6, filled, avg)
+	}
+	if _, filled := e.EstimateFill(1, Ask, 5); filled != 0 {
+		t.Fatalf("expected nothing to fill against an empty bid side, got %d", filled)
+	}
+
+	// Nothing was consumed
+	if volume := e.books[1].VolumeAt(Ask, 10); volume != 2 {
+		t.Fatalf("expected the estimate to leave the book untouched, got volume %d at 10", volume)
+	}
+}
+
+func TestDepthToFill_ReportsWorstPriceAndLevels(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 20, 2, 1, GTC)
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 18, size: 6, peakSize: 1, trader: 1}) // Reserve counts
+	e.Limit(1, Bid, 15, 4, 1, GTC)
+
+	for _, tc := range []struct {
+		size   Size
+		worst  Price
+		levels int
+		full   bool
+	}{
+		{size: 2, worst: 20, levels: 1, full: true},
+		{size: 3, worst: 18, levels: 2, full: true},
+		{size: 8, worst: 18, levels: 2, full: true},
+		{size: 12, worst: 15, levels: 3, full: true},
+		{size: 13, worst: 15, levels: 3, full: false}, // Thin: everything available is consumed
+		{size: 0, worst: 0, levels: 0, full: true},
+	} {
+		worst, levels, full := e.DepthToFill(1, Ask, tc.size)
+		if worst != tc.worst || levels != tc.levels || full != tc.full {
+			t.Errorf("size %d: expected %d over %d levels (full %v), got %d over %d (full %v)", tc.size, tc.worst, tc.levels, tc.full, worst, levels, full)
+		}
+	}
+	if worst, levels, full := e.DepthToFill(1, Bid, 1); worst != 0 || levels != 0 || full {
+		t.Fatalf("expected nothing against an empty ask side, got %d %d %v", worst, levels, full)
+	}
+	if volume := e.books[1].VolumeAt(Bid, 20); volume != 2 {
+		t.Fatalf("expected the walk to leave the book untouched, got volume %d at 20", volume)
+	}
+}
+
+func TestDepth_SkipsSparseLevels(t *testing.T) {
+	e := newTestEngine()
+
+	// Levels at opposite ends of the price range, with nothing in between
+	e.Limit(1, Bid, DEFAULT_PRICE_LEVELS-2, 1, 1, GTC)
+	e.Limit(1, Bid, 1, 2, 1, GTC)
+	e.Limit(1, Ask, DEFAULT_PRICE_LEVELS-1, 3, 2, GTC)
+
+	bids, asks := e.Depth(1, 10)
+	if len(bids) != 2 || bids[0] != (PriceLevelView{price: DEFAULT_PRICE_LEVELS - 2, size: 1}) || bids[1] != (PriceLevelView{price: 1, size: 2}) {
+		t.Fatalf("expected bids at %d and 1, got %+v", DEFAULT_PRICE_LEVELS-2, bids)
+	}
+	if len(asks) != 1 || asks[0] != (PriceLevelView{price: DEFAULT_PRICE_LEVELS - 1, size: 3}) {
+		t.Fatalf("expected a single ask at %d, got %+v", DEFAULT_PRICE_LEVELS-1, asks)
+	}
+}
+
+func TestLastTrade(t *testing.T) {
+	e := newTestEngine()
+
+	if _, _, ok := e.LastTrade(1); ok {
+		t.Fatal("expected no last trade for a symbol that never traded")
+	}
+
+	limit(e, 1, Ask, 100, 2, 1, GTC)
+	limit(e, 1, Ask, 101, 5, 1, GTC)
+	limit(e, 1, Bid, 101, 4, 2, IOC) // Fills 2 at 100, then 2 at 101
+
+	if price, size, ok := e.LastTrade(1); !ok || price != 101 || size != 2 {
+		t.Fatalf("expected last trade 2 @ 101, got %d @ %d (%v)", size, price, ok)
+	}
+	if _, _, ok := e.LastTrade(2); ok {
+		t.Fatal("expected trades on symbol 1 not to affect symbol 2")
+	}
+}
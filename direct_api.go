@@ -0,0 +1,42 @@
+package main
+
+// Error returned by the Try* methods when the engine rejects a command. The matching REJECT_EVENT
+// is still emitted, so output consumers see the same stream either way
+type RejectError struct {
+	reason RejectReason
+}
+
+func (err *RejectError) Error() string {
+	return "order rejected: " + err.reason.String()
+}
+
+// Reason returns why the command was rejected
+func (err *RejectError) Reason() RejectReason {
+	return err.reason
+}
+
+// TryLimit is Limit for embedders driving the engine directly: it returns the new order's ID, or a
+// *RejectError. Like every engine method it must run on the matching goroutine (or while it is idle)
+func (e *MatchingEngine) TryLimit(symbol Symbol, side Side, price Price, size Size, trader TraderID, tif TimeInForce) (OrderID, error) {
+	return e.TryLimitCommand(&InputCommand{symbol: symbol, side: side, price: price, size: size, trader: trader, tif: tif})
+}
+
+// TryLimitCommand is LimitCommand returning the new order's ID or a *RejectError. An accepted order
+// has already matched by the time it returns, so it may be filled or (for IOC and FOK) cancelled;
+// use OrderStatus to see what rests
+func (e *MatchingEngine) TryLimitCommand(cmd *InputCommand) (OrderID, error) {
+	id, reason := e.limitCommand(cmd)
+	if id == 0 {
+		return 0, &RejectError{reason: reason}
+	}
+	return id, nil
+}
+
+// TryCancel is Cancel returning a *RejectError if the order is unknown, stale or already finished,
+// or belongs to another trader
+func (e *MatchingEngine) TryCancel(id OrderID, trader TraderID) error {
+	if ok, reason := e.cancelCommand(id, trader); !ok {
+		return &RejectError{reason: reason}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTryLimit_ReturnsIDOrRejectError(t *testing.T) {
+	e := newTestEngine()
+
+	askID, err := e.TryLimit(1, Ask, 100, 10, 1, GTC)
+	if err != nil || askID == 0 {
+		t.Fatalf("expected an accepted order, got %d, %v", askID, err)
+	}
+	if exists, remaining, _, _, _ := e.OrderStatus(askID); !exists || remaining != 10 {
+		t.Fatalf("expected the returned ID to be resting with 10, got %v %d", exists, remaining)
+	}
+
+	// A crossing IOC is accepted, matches and returns its ID even though nothing rests
+	bidID, err := e.TryLimit(1, Bid, 100, 4, 2, IOC)
+	if err != nil || bidID == 0 {
+		t.Fatalf("expected an accepted IOC, got %d, %v", bidID, err)
+	}
+	if exists, remaining, _, _, _ := e.OrderStatus(askID); !exists || remaining != 6 {
+		t.Fatalf("expected the ask to have 6 left, got %v %d", exists, remaining)
+	}
+
+	_, err = e.TryLimit(1, Bid, 100, 0, 2, GTC)
+	var rejectErr *RejectError
+	if !errors.As(err, &rejectErr) || rejectErr.Reason() != REJECT_INVALID_SIZE {
+		t.Fatalf("expected a RejectError with REJECT_INVALID_SIZE, got %v", err)
+	}
+	if err.Error() != "order rejected: invalid_size" {
+		t.Fatalf("unexpected error text %q", err.Error())
+	}
+
+	// The async event stream is unchanged: order, rested, order, execution, reject
+	events := takerEvents(drainOutputEvents(e))
+	if len(events) != 5 || events[4].eventType != REJECT_EVENT || events[4].reason != REJECT_INVALID_SIZE {
+		t.Fatalf("expected the reject to still be emitted, got %+v", events)
+	}
+}
+
+func TestTryCancel(t *testing.T) {
+	e := newTestEngine()
+
+	id, _ := e.TryLimit(1, Bid, 100, 5, 1, GTC)
+	if err := e.TryCancel(id, 1); err != nil {
+		t.Fatalf("expected the cancel to succeed, got %v", err)
+	}
+
+	var rejectErr *RejectError
+	if err := e.TryCancel(id, 1); !errors.As(err, &rejectErr) || rejectErr.Reason() != REJECT_UNKNOWN_ORDER {
+		t.Fatalf("expected REJECT_UNKNOWN_ORDER cancelling twice, got %v", err)
+	}
+
+	events := drainOutputEvents(e)
+	if len(events) != 4 || events[2].eventType != CANCEL_EVENT || events[3].eventType != REJECT_EVENT {
+		t.Fatalf("expected order, rested, cancel and reject events, got %+v", events)
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+)
+
+// Size of one pooled order in a full engine snapshot
+const snapshotOrderSize = 8 + 8 + 10*4 + 2 + 2 + 1 + 1
+
+// SaveSnapshot writes the engine's complete matching state to w: the WAL sequence and trade id it
+// has reached, the order pool (every slot up to its high-water mark, including free-list links and
+// generations, so order ids are allocated identically after a reload, each trader's list of working
+// orders, the client order ID index and OCO groups), every book's price levels and pending stops (with their trailing offsets),
+// GTD expiries, net positions, trading halts, call auctions and disabled traders. Configuration (tick sizes, size limits, price
+// bands, STP and match modes) is not state and must be set again before loading. The same
+// quiescence rules as Snapshot apply
+func (e *MatchingEngine) SaveSnapshot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, 0, 64)
+	put := func() error {
+		_, err := bw.Write(buf)
+		buf = buf[:0]
+		return err
+	}
+
+	buf = binary.LittleEndian.AppendUint64(buf, e.seq)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(e.lastTradeID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(e.pool.nextFreeSlot))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(e.pool.freeHead))
+	if err := put(); err != nil {
+		return err
+	}
+	for slot := Slot(1); slot <= e.pool.nextFreeSlot; slot++ {
+		order := e.pool.get(slot)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(order.id))
+		buf = binary.LittleEndian.AppendUint64(buf, order.clOrdID)
+		for _, v := range [...]uint32{uint32(order.price), uint32(order.size), uint32(order.filled), uint32(order.peak),
+			uint32(order.reserve), uint32(order.gen), uint32(order.prevSlot), uint32(order.nextSlot),
+			uint32(order.traderPrev), uint32(order.traderNext)} {
+			buf = binary.LittleEndian.AppendUint32(buf, v)
+		}
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(order.trader))
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(order.symbol))
+		buf = append(buf, byte(order.side), byte(order.flags))
+		if err := put(); err != nil {
+			return err
+		}
+	}
+
+	var traders uint32
+	for _, head := range e.pool.traderHeads {
+		if head != 0 {
+			traders++
+		}
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, traders)
+	for trader, head := range e.pool.traderHeads {
+		if head != 0 {
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(trader))
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(head))
+		}
+	}
+	if err := put(); err != nil {
+		return err
+	}
+
+	// Client order IDs sorted by slot, so the output is deterministic
+	tagged := make([]Slot, 0, len(e.pool.clOrdIDs))
+	for _, slot := range e.pool.clOrdIDs {
+		tagged = append(tagged, slot)
+	}
+	sort.Slice(tagged, func(i, j int) bool { return tagged[i] < tagged[j] })
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(tagged)))
+	if err := put(); err != nil {
+		return err
+	}
+	for _, slot := range tagged {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(slot))
+		if err := put(); err != nil {
+			return err
+		}
+	}
+
+	// OCO group rings sorted by slot, each member flagged if it is its group's head
+	grouped := make([]Slot, 0, len(e.pool.groups))
+	for slot := range e.pool.groups {
+		grouped = append(grouped, slot)
+	}
+	sort.Slice(grouped, func(i, j int) bool { return grouped[i] < grouped[j] })
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(grouped)))
+	if err := put(); err != nil {
+		return err
+	}
+	for _, slot := range grouped {
+		link := e.pool.groups[slot]
+		var head byte
+		if e.pool.groupHeads[groupKey{e.pool.get(slot).trader, link.groupID}] == slot {
+			head = 1
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(slot))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(link.next))
+		buf = binary.LittleEndian.AppendUint64(buf, link.groupID)
+		buf = append(buf, head)
+		if err := put(); err != nil {
+			return err
+		}
+	}
+
+	for symbol := range e.books {
+		book := &e.books[symbol]
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(book.bidMax))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(book.askMin))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(book.lastPrice))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(book.lastSize))
+		for _, side := range []Side{Bid, Ask} {
+			stops := *book.stops(side)
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(len(stops)))
+			for _, stop := range stops {
+				buf = binary.LittleEndian.AppendUint32(buf, uint32(stop.slot))
+				buf = binary.LittleEndian.AppendUint32(buf, uint32(stop.stopPrice))
+				buf = binary.LittleEndian.AppendUint32(buf, uint32(stop.trail))
+				buf = append(buf, byte(stop.tif))
+			}
+		}
+		if err := put(); err != nil {
+			return err
+		}
+
+		for _, levels := range [][]PriceLevel{book.bidLevels, book.askLevels} {
+			var count uint32
+			for price := range levels {
+				if levels[price].headSlot != 0 {
+					count++
+				}
+			}
+			buf = binary.LittleEndian.AppendUint32(buf, count)
+			for price := range levels {
+				if level := &levels[price]; level.headSlot != 0 {
+					buf = binary.LittleEndian.AppendUint32(buf, uint32(price))
+					buf = binary.LittleEndian.AppendUint32(buf, uint32(level.headSlot))
+					buf = binary.LittleEndian.AppendUint32(buf, uint32(level.tailSlot))
+					buf = binary.LittleEndian.AppendUint32(buf, uint32(level.volume))
+				}
+			}
+			if err := put(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Expiries in heap order, so the reloaded heap is identical
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.expiries)))
+	for _, exp := range e.expiries {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(exp.expiresAt))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(exp.id))
+	}
+	if err := put(); err != nil {
+		return err
+	}
+
+	// Positions sorted by trader, so the output is deterministic
+	for symbol := range e.positions {
+		traders := make([]TraderID, 0, len(e.positions[symbol]))
+		for trader := range e.positions[symbol] {
+			traders = append(traders, trader)
+		}
+		sort.Slice(traders, func(i, j int) bool { return traders[i] < traders[j] })
+
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(traders)))
+		for _, trader := range traders {
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(trader))
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(e.positions[symbol][trader]))
+		}
+		if err := put(); err != nil {
+			return err
+		}
+	}
+
+	for symbol, halted := range e.halted {
+		var b byte
+		if halted {
+			b |= 1
+		}
+		if e.auctions[symbol] {
+			b |= 2
+		}
+		buf = append(buf, b)
+	}
+
+	var disabled []TraderID
+	for trader := 0; trader < MAX_TRADERS; trader++ {
+		if e.isDisabled(TraderID(trader)) {
+			disabled = append(disabled, TraderID(trader))
+		}
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(disabled)))
+	for _, trader := range disabled {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(trader))
+	}
+	if err := put(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// SaveSnapshotFile writes a snapshot to path atomically: to a temporary file that is fsynced and
+// then renamed over path, so a crash never leaves a partial snapshot behind
+func (e *MatchingEngine) SaveSnapshotFile(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err = e.SaveSnapshot(file); err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Book state read back from a full engine snapshot, before it is applied
+type snapshotBook struct {
+	bidMax, askMin, lastPrice Price
+	lastSize                  Size
+	stops                     [2][]pendingStop
+	levels                    [2][]snapshotLevel
+}
+
+type snapshotLevel struct {
+	price              Price
+	headSlot, tailSlot Slot
+	volume             Size
+}
+
+// LoadSnapshot restores a SaveSnapshot into a freshly constructed engine, after which Replay
+// continues from the snapshot's WAL sequence. The snapshot is fully decoded and checked before the
+// engine is touched, so on error nothing is changed
+func (e *MatchingEngine) LoadSnapshot(r io.Reader) error {
+	if e.seq != 0 || e.pool.nextFreeSlot != 0 {
+		return ErrSnapshotNotEmpty
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	sr := snapshotReader{data: data}
+	seq, lastTradeID := sr.uint64(), TradeID(sr.uint64())
+	nextFreeSlot, freeHead := Slot(sr.uint32()), Slot(sr.uint32())
+	if nextFreeSlot >= Slot(len(e.pool.orders)) || freeHead > nextFreeSlot || len(sr.data) < int(nextFreeSlot)*snapshotOrderSize {
+		return ErrSnapshotCorrupt
+	}
+	validSlot := func(slot Slot) bool { return slot <= nextFreeSlot }
+
+	orders := make([]Order, nextFreeSlot+1)
+	for slot := Slot(1); slot <= nextFreeSlot; slot++ {
+		order := &orders[slot]
+		order.id, order.clOrdID = OrderID(sr.uint64()), sr.uint64()
+		order.price, order.size, order.filled, order.peak = Price(sr.uint32()), Size(sr.uint32()), Size(sr.uint32()), Size(sr.uint32())
+		order.reserve, order.gen, order.prevSlot, order.nextSlot = Size(sr.uint32()), Gen(sr.uint32()), Slot(sr.uint32()), Slot(sr.uint32())
+		order.traderPrev, order.traderNext = Slot(sr.uint32()), Slot(sr.uint32())
+		order.trader, order.symbol = TraderID(sr.uint16()), Symbol(sr.uint16())
+		order.side, order.flags = Side(sr.byte()), OrderFlags(sr.byte())
+		if !validSlot(order.prevSlot) || !validSlot(order.nextSlot) || !validSlot(order.traderPrev) || !validSlot(order.traderNext) || order.side > Ask {
+			return ErrSnapshotCorrupt
+		}
+	}
+
+	var traderHeads [MAX_TRADERS]Slot
+	for count := sr.uint32(); count > 0 && sr.ok(); count-- {
+		trader, head := TraderID(sr.uint16()), Slot(sr.uint32())
+		if head == 0 || !validSlot(head) {
+			return ErrSnapshotCorrupt
+		}
+		traderHeads[trader] = head
+	}
+
+	clOrdIDs := make(map[clOrdKey]Slot)
+	for count := sr.uint32(); count > 0 && sr.ok(); count-- {
+		slot := Slot(sr.uint32())
+		if slot == 0 || !validSlot(slot) || orders[slot].clOrdID == 0 {
+			return ErrSnapshotCorrupt
+		}
+		clOrdIDs[clOrdKey{orders[slot].trader, orders[slot].clOrdID}] = slot
+	}
+
+	groups, groupHeads := make(map[Slot]groupLink), make(map[groupKey]Slot)
+	for count := sr.uint32(); count > 0 && sr.ok(); count-- {
+		slot, link := Slot(sr.uint32()), groupLink{next: Slot(sr.uint32()), groupID: sr.uint64()}
+		head := sr.byte()
+		if slot == 0 || !validSlot(slot) || link.next == 0 || !validSlot(link.next) || orders[slot].flags&FLAG_OCO == 0 {
+			return ErrSnapshotCorrupt
+		}
+		groups[slot] = link
+		if head != 0 {
+			groupHeads[groupKey{orders[slot].trader, link.groupID}] = slot
+		}
+	}
+
+	books := make([]snapshotBook, MAX_SYMBOLS)
+	for symbol := range books {
+		book := &books[symbol]
+		book.bidMax, book.askMin, book.lastPrice, book.lastSize = Price(sr.uint32()), Price(sr.uint32()), Price(sr.uint32()), Size(sr.uint32())
+		if book.bidMax >= e.priceLevels || book.lastPrice >= e.priceLevels {
+			return ErrSnapshotCorrupt
+		}
+		for side := range book.stops {
+			for count := sr.uint32(); count > 0 && sr.ok(); count-- {
+				stop := pendingStop{slot: Slot(sr.uint32()), stopPrice: Price(sr.uint32()), trail: Price(sr.uint32()), tif: TimeInForce(sr.byte())}
+				if stop.slot == 0 || !validSlot(stop.slot) {
+					return ErrSnapshotCorrupt
+				}
+				book.stops[side] = append(book.stops[side], stop)
+			}
+		}
+		for side := range book.levels {
+			for count := sr.uint32(); count > 0 && sr.ok(); count-- {
+				level := snapshotLevel{price: Price(sr.uint32()), headSlot: Slot(sr.uint32()), tailSlot: Slot(sr.uint32()), volume: Size(sr.uint32())}
+				if level.price >= e.priceLevels || level.headSlot == 0 || level.tailSlot == 0 || !validSlot(level.headSlot) || !validSlot(level.tailSlot) {
+					return ErrSnapshotCorrupt
+				}
+				book.levels[side] = append(book.levels[side], level)
+			}
+		}
+
+		// With no asks, askMin is the saving engine's level count, which may differ from this one's
+		if len(book.levels[Ask]) == 0 {
+			book.askMin = e.priceLevels
+		} else if book.askMin >= e.priceLevels {
+			return ErrSnapshotCorrupt
+		}
+	}
+
+	var expiries expiryHeap
+	for count := sr.uint32(); count > 0 && sr.ok(); count-- {
+		expiries = append(expiries, expiry{expiresAt: int64(sr.uint64()), id: OrderID(sr.uint64())})
+	}
+
+	var positions [MAX_SYMBOLS]map[TraderID]int64
+	for symbol := range positions {
+		positions[symbol] = make(map[TraderID]int64)
+		for count := sr.uint32(); count > 0 && sr.ok(); count-- {
+			trader := TraderID(sr.uint16())
+			positions[symbol][trader] = int64(sr.uint64())
+		}
+	}
+	var halted, auctions [MAX_SYMBOLS]bool
+	for symbol := range halted {
+		b := sr.byte()
+		halted[symbol], auctions[symbol] = b&1 != 0, b&2 != 0
+	}
+	var disabled [MAX_TRADERS / 64]uint64
+	for count := sr.uint32(); count > 0 && sr.ok(); count-- {
+		trader := sr.uint16()
+		disabled[trader/64] |= 1 << (trader % 64)
+	}
+	if !sr.ok() || len(sr.data) != 0 {
+		return ErrSnapshotCorrupt
+	}
+
+	// Everything decoded and checked: apply it
+	copy(e.pool.orders, orders)
+	e.pool.nextFreeSlot, e.pool.freeHead = nextFreeSlot, freeHead
+	e.pool.traderHeads = traderHeads
+	e.pool.clOrdIDs = clOrdIDs
+	e.pool.groups, e.pool.groupHeads = groups, groupHeads
+
+	for symbol := range books {
+		src, book := &books[symbol], &e.books[symbol]
+		if len(src.levels[Bid]) != 0 || len(src.levels[Ask]) != 0 || len(src.stops[Bid]) != 0 || len(src.stops[Ask]) != 0 {
+			book.allocate()
+		}
+		book.bidMax, book.askMin, book.lastPrice, book.lastSize = src.bidMax, src.askMin, src.lastPrice, src.lastSize
+		book.buyStops, book.sellStops = src.stops[Bid], src.stops[Ask]
+		book.trailing = 0
+		for _, stops := range src.stops {
+			for _, stop := range stops {
+				if stop.trail != 0 {
+					book.trailing++
+				}
+			}
+		}
+		for _, side := range []Side{Bid, Ask} {
+			for _, level := range src.levels[side] {
+				*book.level(side, level.price) = PriceLevel{headSlot: level.headSlot, tailSlot: level.tailSlot, volume: level.volume}
+				book.bits(side).set(level.price)
+				book.volumes(side).set(level.price, level.volume)
+			}
+		}
+	}
+
+	e.expiries = expiries
+	heap.Init(&e.expiries) // A no-op for a valid snapshot, which holds the heap in heap order
+	e.positions = positions
+	e.halted, e.auctions = halted, auctions
+	e.disabled = disabled
+	e.seq, e.lastTradeID = seq, lastTradeID
+	return nil
+}
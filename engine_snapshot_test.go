@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// Full engine state, as written by SaveSnapshot
+func engineState(t *testing.T, e *MatchingEngine) []byte {
+	var buf bytes.Buffer
+	if err := e.SaveSnapshot(&buf); err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestEngineSnapshot_RecoverFromSnapshotAndWAL(t *testing.T) {
+	dir := t.TempDir()
+	walPath, snapshotPath := filepath.Join(dir, "engine.wal"), filepath.Join(dir, "engine.snap")
+	wal, err := OpenWAL(walPath)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	live := newTestEngine()
+	cmds := append(walTestCommands(),
+		InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: 90, size: 4, trader: 7, stopPrice: 95, trailOffset: 3},
+		InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Ask, price: 104, size: 2, trader: 8, reduceOnly: true},
+	)
+	live.applyLogged(wal, cmds[:5])
+	if err := live.SaveSnapshotFile(snapshotPath); err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	live.applyLogged(wal, cmds[5:])
+	wal.Close() // Crash: the engine is lost, only the files remain
+
+	recovered := newTestEngine()
+	if err := recovered.Recover(snapshotPath, walPath); err != nil {
+		t.Fatalf("recover failed: %v", err)
+	}
+	if recovered.seq != uint64(len(cmds)) {
+		t.Fatalf("expected to recover to sequence %d, got %d", len(cmds), recovered.seq)
+	}
+	if !bytes.Equal(engineState(t, live), engineState(t, recovered)) {
+		t.Fatalf("recovered engine state differs from the live engine")
+	}
+
+	// Both engines go on to issue the same order ids
+	drainOutputEvents(live)
+	drainOutputEvents(recovered)
+	for _, e := range []*MatchingEngine{live, recovered} {
+		limit(e, 3, Bid, 10, 1, 1, GTC)
+	}
+	if a, b := drainOutputEvents(live), drainOutputEvents(recovered); len(a) != 2 || len(b) != 2 || a[0].orderID != b[0].orderID {
+		t.Fatalf("expected identical next order ids, got %v and %v", a, b)
+	}
+}
+
+func TestEngineSnapshot_LoadRejectsCorruptOrNonEmpty(t *testing.T) {
+	src := newTestEngine()
+	limit(src, 1, Bid, 100, 10, 1, GTC)
+	state := engineState(t, src)
+
+	e := newTestEngine()
+	if err := e.LoadSnapshot(bytes.NewReader(state[:len(state)-1])); err != ErrSnapshotCorrupt {
+		t.Fatalf("expected ErrSnapshotCorrupt for a truncated snapshot, got %v", err)
+	}
+	if e.pool.nextFreeSlot != 0 || e.books[1].bidMax != 0 {
+		t.Fatalf("expected a failed load to leave the engine untouched")
+	}
+	if err := src.LoadSnapshot(bytes.NewReader(state)); err != ErrSnapshotNotEmpty {
+		t.Fatalf("expected ErrSnapshotNotEmpty, got %v", err)
+	}
+}
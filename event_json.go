@@ -0,0 +1,161 @@
+package main
+
+import (
+	"io"
+	"strconv"
+)
+
+var eventTypeNames = [...]string{
+	INVALID_EVENT:     "invalid",
+	ORDER_EVENT:       "order",
+	CANCEL_EVENT:      "cancel",
+	EXECUTION_EVENT:   "execution",
+	REJECT_EVENT:      "reject",
+	AMEND_EVENT:       "amend",
+	REPLACE_EVENT:     "replace",
+	MARKET_EVENT:      "market",
+	EXPIRE_EVENT:      "expire",
+	HALT_EVENT:        "halt",
+	RESUME_EVENT:      "resume",
+	AUCTION_EVENT:     "auction",
+	UNCROSS_EVENT:     "uncross",
+	MASS_CANCEL_EVENT: "mass_cancel",
+	DISABLE_EVENT:     "disable",
+	ENABLE_EVENT:      "enable",
+	RESTED_EVENT:      "rested",
+	LEVEL_UPDATE:      "level_update",
+	AGG_FILL_EVENT:    "agg_fill",
+	QUERY_EVENT:       "query",
+}
+
+var rejectReasonNames = [...]string{
+	REJECT_UNSPECIFIED:     "unspecified",
+	REJECT_INVALID_TICK:    "invalid_tick",
+	REJECT_INVALID_SIZE:    "invalid_size",
+	REJECT_POOL_EXHAUSTED:  "pool_exhausted",
+	REJECT_HALTED:          "halted",
+	REJECT_PRICE_BAND:      "price_band",
+	REJECT_AUCTION:         "auction",
+	REJECT_INVALID_PRICE:   "invalid_price",
+	REJECT_UNKNOWN_SYMBOL:  "unknown_symbol",
+	REJECT_INVALID_EXPIRY:  "invalid_expiry",
+	REJECT_REDUCE_ONLY:     "reduce_only",
+	REJECT_FOK_UNFILLABLE:  "fok_unfillable",
+	REJECT_SELF_TRADE:      "self_trade",
+	REJECT_POST_ONLY_CROSS: "post_only_cross",
+	REJECT_UNKNOWN_ORDER:   "unknown_order",
+	REJECT_NOT_AMENDABLE:   "not_amendable",
+	REJECT_CROSS_SHARD:     "cross_shard",
+	REJECT_TRADER_DISABLED: "trader_disabled",
+	REJECT_RATE_LIMITED:    "rate_limited",
+	REJECT_NOT_OWNER:       "not_owner",
+	REJECT_UNKNOWN_COMMAND: "unknown_command",
+	REJECT_INVALID_SIDE:    "invalid_side",
+}
+
+func (t EventType) String() string {
+	if int(t) < len(eventTypeNames) {
+		return eventTypeNames[t]
+	}
+	return "unknown"
+}
+
+func (r RejectReason) String() string {
+	if int(r) < len(rejectReasonNames) {
+		return rejectReasonNames[r]
+	}
+	return "unknown"
+}
+
+func (s Side) String() string {
+	if s == Bid {
+		return "bid"
+	}
+	return "ask"
+}
+
+// AppendJSON appends ev to buf as a single JSON object. OrderIDs, and client order IDs (only
+// written when set), are written as strings since they can exceed the 2^53 integers a JavaScript
+// number holds exactly
+func (ev *OutputEvent) AppendJSON(buf []byte) []byte {
+	buf = append(buf, `{"type":"`...)
+	buf = append(buf, ev.eventType.String()...)
+	buf = append(buf, `","order_id":"`...)
+	buf = strconv.AppendUint(buf, uint64(ev.orderID), 10)
+	if ev.clOrdID != 0 {
+		buf = append(buf, `","cl_ord_id":"`...)
+		buf = strconv.AppendUint(buf, ev.clOrdID, 10)
+	}
+	buf = append(buf, `","symbol":`...)
+	buf = strconv.AppendUint(buf, uint64(ev.symbol), 10)
+	buf = append(buf, `,"trader":`...)
+	buf = strconv.AppendUint(buf, uint64(ev.trader), 10)
+	buf = append(buf, `,"side":"`...)
+	buf = append(buf, ev.side.String()...)
+	buf = append(buf, `","price":`...)
+	buf = strconv.AppendUint(buf, uint64(ev.price), 10)
+	buf = append(buf, `,"size":`...)
+	buf = strconv.AppendUint(buf, uint64(ev.size), 10)
+
+	switch ev.eventType {
+	case EXECUTION_EVENT:
+		buf = append(buf, `,"counter_order_id":"`...)
+		buf = strconv.AppendUint(buf, uint64(ev.counterOrderID), 10)
+		buf = append(buf, `","counter_trader":`...)
+		buf = strconv.AppendUint(buf, uint64(ev.counterTrader), 10)
+		buf = append(buf, `,"trade_id":"`...)
+		buf = strconv.AppendUint(buf, uint64(ev.tradeID), 10)
+		buf = append(buf, `","fee":`...)
+		buf = strconv.AppendInt(buf, ev.fee, 10)
+		buf = append(buf, `,"counter_fee":`...)
+		buf = strconv.AppendInt(buf, ev.counterFee, 10)
+		buf = append(buf, `,"liquidity":"`...)
+		if ev.maker {
+			buf = append(buf, "maker"...)
+		} else {
+			buf = append(buf, "taker"...)
+		}
+		buf = append(buf, '"')
+	case AGG_FILL_EVENT:
+		buf = append(buf, `,"notional":"`...)
+		buf = strconv.AppendUint(buf, ev.notional, 10)
+		buf = append(buf, `","fills":`...)
+		buf = strconv.AppendUint(buf, uint64(ev.fills), 10)
+		buf = append(buf, `,"fee":`...)
+		buf = strconv.AppendInt(buf, ev.fee, 10)
+	case AMEND_EVENT:
+		buf = append(buf, `,"prev_price":`...)
+		buf = strconv.AppendUint(buf, uint64(ev.prevPrice), 10)
+		buf = append(buf, `,"prev_size":`...)
+		buf = strconv.AppendUint(buf, uint64(ev.prevSize), 10)
+	case CANCEL_EVENT:
+		if ev.prevSize != 0 { // A partial cancel, leaving the order working
+			buf = append(buf, `,"prev_size":`...)
+			buf = strconv.AppendUint(buf, uint64(ev.prevSize), 10)
+		}
+	case REJECT_EVENT:
+		buf = append(buf, `,"reason":"`...)
+		buf = append(buf, ev.reason.String()...)
+		buf = append(buf, '"')
+	case REPLACE_EVENT:
+		buf = append(buf, `,"cancel_failed":`...)
+		buf = strconv.AppendBool(buf, ev.cancelFailed)
+	}
+	return append(buf, '}')
+}
+
+// MarshalJSON implements json.Marshaler, for callers going through encoding/json
+func (ev OutputEvent) MarshalJSON() ([]byte, error) {
+	return ev.AppendJSON(nil), nil
+}
+
+// NewJSONEventWriter returns a StartOutputDistributor callback that writes each event to w as
+// newline-delimited JSON, reusing one buffer so the per-event allocation is bounded. Write errors
+// are dropped, as the distributor has no way to act on them
+func NewJSONEventWriter(w io.Writer) func(OutputEvent) {
+	buf := make([]byte, 0, 256)
+	return func(ev OutputEvent) {
+		buf = append(ev.AppendJSON(buf[:0]), '\n')
+		w.Write(buf)
+	}
+}
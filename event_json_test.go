@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestEventJSON_Fields(t *testing.T) {
+	ev := OutputEvent{
+		eventType:      EXECUTION_EVENT,
+		orderID:        OrderID(1)<<60 | 3, // Beyond float64 precision
+		counterOrderID: 9,
+		price:          105,
+		size:           7,
+		trader:         2,
+		counterTrader:  5,
+		symbol:         4,
+		side:           Ask,
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(ev.AppendJSON(nil), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if decoded["type"] != "execution" || decoded["side"] != "ask" {
+		t.Fatalf("expected readable type and side, got %v", decoded)
+	}
+	if decoded["order_id"] != "1152921504606846979" || decoded["counter_order_id"] != "9" {
+		t.Fatalf("expected exact order ids, got %v", decoded)
+	}
+	if decoded["counter_trader"] != float64(5) || decoded["liquidity"] != "taker" {
+		t.Fatalf("expected the counterparty trader and taker liquidity, got %v", decoded)
+	}
+	if decoded["price"] != float64(105) || decoded["size"] != float64(7) {
+		t.Fatalf("expected price 105 and size 7, got %v", decoded)
+	}
+
+	reject, _ := json.Marshal(OutputEvent{eventType: REJECT_EVENT, reason: REJECT_INVALID_TICK})
+	if !bytes.Contains(reject, []byte(`"type":"reject"`)) || !bytes.Contains(reject, []byte(`"reason":"invalid_tick"`)) {
+		t.Fatalf("expected reject type and reason, got %s", reject)
+	}
+
+	summary, _ := json.Marshal(OutputEvent{eventType: AGG_FILL_EVENT, notional: 1<<60 + 1, fills: 3, fee: -2})
+	if !bytes.Contains(summary, []byte(`"notional":"1152921504606846977","fills":3,"fee":-2`)) {
+		t.Fatalf("expected an exact notional with the fill count and fee, got %s", summary)
+	}
+}
+
+func TestEventJSON_WriterIsNewlineDelimited(t *testing.T) {
+	var out bytes.Buffer
+	write := NewJSONEventWriter(&out)
+	write(OutputEvent{eventType: ORDER_EVENT, orderID: 1})
+	write(OutputEvent{eventType: CANCEL_EVENT, orderID: 1})
+
+	lines := bytes.Split(bytes.TrimSuffix(out.Bytes(), []byte("\n")), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), out.String())
+	}
+	for _, line := range lines {
+		if !json.Valid(line) {
+			t.Fatalf("invalid JSON line: %s", line)
+		}
+	}
+
+	ev := OutputEvent{eventType: ORDER_EVENT}
+	if allocs := testing.AllocsPerRun(100, func() { write(ev) }); allocs != 0 {
+		t.Fatalf("expected no per-event allocations, got %v", allocs)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Pending expiry of a GTD order
+type expiry struct {
+	expiresAt int64
+	id        OrderID
+}
+
+// Min-heap of GTD expiries, ordered by time then OrderID so sweeps are deterministic
+type expiryHeap []expiry
+
+func (h expiryHeap) Len() int { return len(h) }
+func (h expiryHeap) Less(i, j int) bool {
+	if h[i].expiresAt != h[j].expiresAt {
+		return h[i].expiresAt < h[j].expiresAt
+	}
+	return h[i].id < h[j].id
+}
+func (h expiryHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)   { *h = append(*h, x.(expiry)) }
+func (h *expiryHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Cancel every GTD order that has expired by now (unix nanos), emitting a CANCEL_EVENT for each.
+// Orders that already filled or were cancelled are skipped. Must run on the matching goroutine
+func (e *MatchingEngine) Expire(now int64) {
+	for len(e.expiries) > 0 && e.expiries[0].expiresAt <= now {
+		exp := heap.Pop(&e.expiries).(expiry)
+		if order := e.working(exp.id); order != nil {
+			if ev := cancelEvent(order); e.cancel(exp.id) {
+				e.emitCancel(ev)
+			}
+		}
+	}
+}
+
+// StartExpirySweeper periodically feeds EXPIRE_EVENT commands through the input ring, so GTD
+// orders are expired by the matching goroutine rather than by mutating the book concurrently.
+// The input ring is multi-producer, so this can run alongside the order flow. Returns once stop is closed
+func (e *MatchingEngine) StartExpirySweeper(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			e.inputRing.Push(InputCommand{eventType: EXPIRE_EVENT, expiresAt: now.UnixNano()})
+		case <-stop:
+			return
+		}
+	}
+}
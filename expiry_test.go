@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpire_CancelsOnlyExpiredOrders(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 10, size: 5, trader: 1, tif: GTD, expiresAt: 200})
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 9, size: 5, trader: 1, tif: GTD, expiresAt: 100})
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 8, size: 5, trader: 1, tif: GTD, expiresAt: 300})
+	events := drainOutputEvents(e)
+	late, early := events[0].orderID, events[2].orderID
+
+	e.Expire(200)
+
+	events = drainOutputEvents(e)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 CANCEL_EVENTs, got %+v", events)
+	}
+	if events[0].eventType != CANCEL_EVENT || events[0].orderID != early || events[1].orderID != late {
+		t.Fatalf("expected expiries in time order, got %+v", events)
+	}
+	if e.books[1].bidMax != 8 {
+		t.Fatalf("expected only the order at 8 left, bidMax %d", e.books[1].bidMax)
+	}
+}
+
+func TestExpire_SkipsFilledOrders(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 10, size: 5, trader: 1, tif: GTD, expiresAt: 100})
+	e.Limit(1, Ask, 10, 5, 2, GTC)
+	drainOutputEvents(e)
+
+	e.Expire(100)
+
+	if events := drainOutputEvents(e); len(events) != 0 {
+		t.Fatalf("expected no events for an already filled order, got %+v", events)
+	}
+}
+
+func TestExpire_NoCancelEventForAnOrderNotCancelled(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 10, size: 5, trader: 1, tif: GTD, expiresAt: 100})
+	e.Limit(1, Bid, 11, 5, 1, GTC)
+	id := drainOutputEvents(e)[0].orderID
+
+	// A stale price leaves the order naming a level whose queue it is not in, so cancel refuses it
+	e.pool.get(Slot(id & SLOT_MASK)).price = 11
+	e.Expire(100)
+	if events := drainOutputEvents(e); len(events) != 0 {
+		t.Fatalf("expected no CANCEL_EVENT for an order left in the book, got %+v", events)
+	}
+	if e.Stats().cancelled != 0 {
+		t.Fatalf("expected no cancel counted, got %d", e.Stats().cancelled)
+	}
+}
+
+func TestGTD_RequiresExpiry(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 10, size: 5, trader: 1, tif: GTD})
+
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT {
+		t.Fatalf("expected REJECT_EVENT for GTD without expiry, got %+v", events)
+	}
+}
+
+func TestStartExpirySweeper_FeedsInputRing(t *testing.T) {
+	e := newTestEngine()
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		e.StartExpirySweeper(time.Millisecond, stop)
+		close(stopped)
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+
+	// The sweeper must only enqueue commands, leaving the matching to the input distributor
+	buf := make([]InputCommand, 1)
+	done := make(chan struct{})
+	go func() {
+		e.inputRing.Read(buf)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("timed out waiting for an EXPIRE_EVENT command")
+	}
+	if buf[0].eventType != EXPIRE_EVENT || buf[0].expiresAt == 0 {
+		t.Fatalf("expected EXPIRE_EVENT with a sweep time, got %+v", buf[0])
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	SUBSCRIBER_BUFFER = 1 << 12 // Events queued per subscriber; one that falls further behind misses events
+)
+
+// One Subscribe registration: its own ring, drained by its own goroutine, so a slow or panicking
+// callback only ever holds up itself
+type subscriber struct {
+	fn   func(OutputEvent)
+	ring *RingBuffer[OutputEvent] // Single producer: the fan-out distributor
+}
+
+// Subscribers of the fan-out distributor (see Subscribe)
+type fanOut struct {
+	mu      sync.RWMutex                       // Held for reading while an event is handed out, so an unsubscribe never races a push
+	subs    [len(eventTypeNames)][]*subscriber // By the event type they receive; INVALID_EVENT's receive every event
+	stopped bool                               // The distributor has returned; later subscribers are never called
+	running sync.WaitGroup                     // Subscriber goroutines still draining
+}
+
+// Subscribe registers fn to receive every output event delivered by StartFanOutDistributor, in
+// order, on a goroutine of its own. Each subscriber has its own SUBSCRIBER_BUFFER-event queue: one
+// that falls that far behind misses events rather than stalling the others (see Stats.dropped), and
+// a panic in fn costs only the event it was handling. Returns a func that unsubscribes fn, after
+// which fn sees only the events already queued for it; safe to call more than once and from any
+// goroutine, including fn itself
+func (e *MatchingEngine) Subscribe(fn func(OutputEvent)) (unsubscribe func()) {
+	return e.subscribe(INVALID_EVENT, fn)
+}
+
+// OnEvent is Subscribe for the events of one type, so a consumer needs no switch on the event type
+// of its own. Events of a type with no callbacks cost the fan-out distributor nothing beyond the
+// lookup. Returns a func that unregisters fn, as for Subscribe.
+// Panics for INVALID_EVENT or an unknown event type
+func (e *MatchingEngine) OnEvent(eventType EventType, fn func(OutputEvent)) (unregister func()) {
+	if eventType == INVALID_EVENT || int(eventType) >= len(eventTypeNames) {
+		panic(fmt.Sprintf("cannot register for event type %d", eventType))
+	}
+	return e.subscribe(eventType, fn)
+}
+
+// Register fn for eventType's events (INVALID_EVENT for all of them), starting its goroutine
+func (e *MatchingEngine) subscribe(eventType EventType, fn func(OutputEvent)) func() {
+	f := &e.subscribers
+	s := &subscriber{fn: fn, ring: NewRingBuffer[OutputEvent](SUBSCRIBER_BUFFER)}
+
+	f.mu.Lock()
+	if !f.stopped {
+		f.subs[eventType] = append(f.subs[eventType], s)
+		f.running.Add(1)
+		go s.run(&f.running)
+	}
+	f.mu.Unlock()
+
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.subs[eventType] = slices.DeleteFunc(f.subs[eventType], func(other *subscriber) bool { return other == s })
+		s.ring.Close()
+	}
+}
+
+// StartFanOutDistributor is StartOutputDistributor for Subscribe's subscribers: it reads each event
+// once and queues it for every current subscriber it is for (see OnEvent). Returns once the input distributor has shut down
+// and every subscriber has been handed, and has finished with, every event queued for it
+func (e *MatchingEngine) StartFanOutDistributor() {
+	f := &e.subscribers
+	e.StartOutputDistributor(e.publish)
+
+	f.mu.Lock()
+	f.stopped = true
+	for i := range f.subs {
+		for _, s := range f.subs[i] {
+			s.ring.Close()
+		}
+		f.subs[i] = nil
+	}
+	f.mu.Unlock()
+	f.running.Wait()
+}
+
+// Queue one event for every subscriber to it, dropping it for any whose queue is full
+func (e *MatchingEngine) publish(ev OutputEvent) {
+	f := &e.subscribers
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	e.queue(f.subs[INVALID_EVENT], ev)
+	if ev.eventType != INVALID_EVENT && int(ev.eventType) < len(f.subs) {
+		e.queue(f.subs[ev.eventType], ev)
+	}
+}
+
+func (e *MatchingEngine) queue(subs []*subscriber, ev OutputEvent) {
+	for _, s := range subs {
+		if !s.ring.TryPush(ev) {
+			atomic.AddUint64(&e.stats.dropped, 1)
+		}
+	}
+}
+
+// Deliver queued events to the subscriber until its ring is closed and drained
+func (s *subscriber) run(running *sync.WaitGroup) {
+	defer running.Done()
+	buf := make([]OutputEvent, DISTRIBUTOR_BUFFER)
+	for {
+		n := s.ring.Read(buf)
+		if n == 0 {
+			return
+		}
+		for i := 0; uint32(i) < n; i++ {
+			s.deliver(buf[i])
+		}
+	}
+}
+
+// Call the subscriber for one event, recovering from a panic so its later events still arrive
+func (s *subscriber) deliver(ev OutputEvent) {
+	defer func() { recover() }()
+	s.fn(ev)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Helper to run StartFanOutDistributor, returning a channel closed once it returns
+func startFanOut(e *MatchingEngine) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		e.StartFanOutDistributor()
+		close(done)
+	}()
+	return done
+}
+
+func TestSubscribe_EverySubscriberSeesEveryEvent(t *testing.T) {
+	e := newTestEngine()
+
+	var first, second []OutputEvent
+	e.Subscribe(func(ev OutputEvent) { first = append(first, ev) })
+	e.Subscribe(func(OutputEvent) { panic("subscriber bug") })
+	e.Subscribe(func(ev OutputEvent) { second = append(second, ev) })
+
+	for i := 0; i < 100; i++ {
+		e.inputRing.Push(InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: Price(10 + i), size: 1, trader: 1})
+	}
+	e.Stop()
+	go e.StartInputDistributor()
+
+	select {
+	case <-startFanOut(e):
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the fan-out distributor to return")
+	}
+
+	if len(first) != 200 || len(second) != 200 { // An ORDER_EVENT and a RESTED_EVENT per order
+		t.Fatalf("expected both subscribers to see all 200 events despite the panicking one, got %d and %d", len(first), len(second))
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("subscribers saw different events at %d: %+v vs %+v", i, first[i], second[i])
+		}
+	}
+	if first[0].eventType != ORDER_EVENT || first[199].price != 109 {
+		t.Fatalf("expected the events in order, got first %+v and last %+v", first[0], first[199])
+	}
+}
+
+func TestSubscribe_SlowSubscriberDoesNotStallOthers(t *testing.T) {
+	e := newTestEngine()
+	const rounds, perRound = 4, SUBSCRIBER_BUFFER / 2
+	const events = rounds * perRound
+
+	release := make(chan struct{})
+	var slow int
+	unsubscribe := e.Subscribe(func(OutputEvent) {
+		<-release
+		slow++
+	})
+	var seen uint64
+	e.Subscribe(func(OutputEvent) { atomic.AddUint64(&seen, 1) })
+
+	// Push in rounds the other subscriber's queue can hold, waiting for it to take each one
+	done := startFanOut(e)
+	for round := 1; round <= rounds; round++ {
+		for i := 0; i < perRound; i++ {
+			e.outputRing.Push(OutputEvent{eventType: REJECT_EVENT, orderID: OrderID(i)})
+		}
+		deadline := time.Now().Add(time.Second)
+		for atomic.LoadUint64(&seen) != uint64(round*perRound) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out in round %d: the blocked subscriber stalled the other one", round)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if dropped := e.Stats().dropped; dropped == 0 {
+		t.Fatal("expected the blocked subscriber's overflow to be counted as dropped")
+	}
+
+	unsubscribe()
+	unsubscribe() // Idempotent
+	close(release)
+	e.outputRing.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the fan-out distributor to return")
+	}
+	if slow == 0 || slow >= events {
+		t.Fatalf("expected the slow subscriber to get only what was queued before it fell behind, got %d of %d", slow, events)
+	}
+}
+
+func TestOnEvent_DeliversOnlyItsEventType(t *testing.T) {
+	e := newTestEngine()
+
+	var executions []OutputEvent
+	rejects := make(chan OrderID, 2)
+	e.OnEvent(EXECUTION_EVENT, func(ev OutputEvent) { executions = append(executions, ev) })
+	unregister := e.OnEvent(REJECT_EVENT, func(ev OutputEvent) { rejects <- ev.orderID })
+
+	done := startFanOut(e)
+	e.outputRing.Push(OutputEvent{eventType: ORDER_EVENT, orderID: 1})
+	e.outputRing.Push(OutputEvent{eventType: REJECT_EVENT, orderID: 2})
+	e.outputRing.Push(OutputEvent{eventType: EXECUTION_EVENT, orderID: 3})
+
+	select {
+	case id := <-rejects:
+		if id != 2 {
+			t.Fatalf("expected the reject of order 2, got order %d", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the reject")
+	}
+	unregister()
+	e.outputRing.Push(OutputEvent{eventType: REJECT_EVENT, orderID: 4})
+	e.outputRing.Push(OutputEvent{eventType: EXECUTION_EVENT, orderID: 5})
+	e.outputRing.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the fan-out distributor to return")
+	}
+	if len(executions) != 2 || executions[0].orderID != 3 || executions[1].orderID != 5 {
+		t.Fatalf("expected the executions of orders 3 and 5, got %+v", executions)
+	}
+	if len(rejects) != 0 {
+		t.Fatalf("expected no reject after unregistering, got order %d", <-rejects)
+	}
+}
+
+func TestOnEvent_PanicsForInvalidEventType(t *testing.T) {
+	e := newTestEngine()
+	for _, eventType := range []EventType{INVALID_EVENT, EventType(len(eventTypeNames))} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected OnEvent(%d) to panic", eventType)
+				}
+			}()
+			e.OnEvent(eventType, func(OutputEvent) {})
+		}()
+	}
+}
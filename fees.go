@@ -0,0 +1,26 @@
+package main
+
+const MAX_FEE_BPS = 10_000 // Fee rates are limited to 100% of notional either way
+
+// Set the maker (resting order) and taker (aggressor) fee rates, in basis points of each fill's
+// notional (price * size). A negative rate is a rebate, typically offered to makers. Rates are
+// clamped to ±MAX_FEE_BPS. Fees are reported on every EXECUTION_EVENT (see fee)
+func (e *MatchingEngine) SetFees(makerBps, takerBps int) {
+	e.makerBps = int32(max(-MAX_FEE_BPS, min(makerBps, MAX_FEE_BPS)))
+	e.takerBps = int32(max(-MAX_FEE_BPS, min(takerBps, MAX_FEE_BPS)))
+}
+
+// Fee on a fill at the given rate: price * size * bps / 10,000, in price-tick units, rounded up
+// towards +infinity. Charges therefore round up and rebates round towards zero, so rounding always
+// favours the exchange and a fill never pays out more than its rate. Exact integer arithmetic,
+// hence deterministic: the notional (under 2^56) is split into whole and part units of 10,000 before
+// the rate is applied, so neither product can overflow
+func fee(price Price, size Size, bps int32) int64 {
+	notional := int64(price) * int64(size)
+	part := notional % 10_000 * int64(bps)
+	amount := notional/10_000*int64(bps) + part/10_000 // Truncates towards zero, which is already upwards for a rebate
+	if part%10_000 > 0 {
+		amount++
+	}
+	return amount
+}
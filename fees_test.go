@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestFee_Rounding(t *testing.T) {
+	cases := []struct {
+		price Price
+		size  Size
+		bps   int32
+		want  int64
+	}{
+		{1000, 100, 5, 50},   // Exact: 100,000 * 5bp
+		{1000, 37, 5, 19},    // 18.5 rounds up
+		{1001, 23, 5, 12},    // 11.5115 rounds up
+		{1000, 37, -2, -7},   // A -7.4 rebate rounds towards zero
+		{1000, 100, -2, -20}, // Exact rebate
+		{100, 3, 5, 1},       // 0.15 still charges a tick
+		{100, 3, -2, 0},      // -0.06 pays nothing
+		{1000, 37, 0, 0},
+		{MAX_PRICE_LEVELS - 1, 1<<32 - 1, MAX_FEE_BPS, int64(MAX_PRICE_LEVELS-1) * (1<<32 - 1)}, // No overflow at the extremes
+		{MAX_PRICE_LEVELS - 1, 1<<32 - 1, -MAX_FEE_BPS, -int64(MAX_PRICE_LEVELS-1) * (1<<32 - 1)},
+		{MAX_PRICE_LEVELS - 1, 1<<32 - 1, 3, 21_617_276_917_856}, // 21,617,276,917,855.0275 rounds up
+	}
+	for _, c := range cases {
+		if got := fee(c.price, c.size, c.bps); got != c.want {
+			t.Fatalf("fee(%d, %d, %d): expected %d, got %d", c.price, c.size, c.bps, c.want, got)
+		}
+	}
+}
+
+func TestSetFees_AppliedToFills(t *testing.T) {
+	e := newTestEngine()
+	e.SetFees(-2, 5)
+
+	limit(e, 1, Ask, 1000, 37, 1, GTC)
+	limit(e, 1, Ask, 1001, 50, 1, GTC)
+	limit(e, 1, Bid, 1001, 60, 2, IOC) // Fills 37@1000 and 23@1001
+	limit(e, 1, Ask, 1000, 100, 3, GTC)
+	limit(e, 1, Bid, 1000, 100, 2, GTC) // Fills 100@1000
+
+	var fills int
+	var takerFees, makerFees, makerReported int64
+	for _, ev := range drainOutputEvents(e) {
+		switch {
+		case ev.eventType != EXECUTION_EVENT:
+		case ev.maker:
+			makerReported += ev.fee
+		default:
+			fills++
+			takerFees += ev.fee
+			makerFees += ev.counterFee
+		}
+	}
+	if fills != 3 || takerFees != 19+12+50 || makerFees != -7-4-20 {
+		t.Fatalf("expected 3 fills with taker fees 81 and maker rebates -31, got %d fills, %d and %d", fills, takerFees, makerFees)
+	}
+	if makerReported != makerFees {
+		t.Fatalf("expected the maker reports to carry the rebates %d, got %d", makerFees, makerReported)
+	}
+
+	// Rates are clamped to 100% of notional
+	e.SetFees(-20_000, 20_000)
+	if e.makerBps != -MAX_FEE_BPS || e.takerBps != MAX_FEE_BPS {
+		t.Fatalf("expected rates clamped to ±%d, got %d and %d", MAX_FEE_BPS, e.makerBps, e.takerBps)
+	}
+}
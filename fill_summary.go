@@ -0,0 +1,54 @@
+package main
+
+// SetFillSummaries turns aggressor fill summaries on or off (off by default, as they add an event to
+// every order that reaches the book). While on, each order matched on entry (or re-matched by an
+// amend) is followed, once matching ends and before any RESTED_EVENT or CANCEL_EVENT for its
+// remainder, by an AGG_FILL_EVENT for the order: size is the total filled, notional the sum of price
+// * size, fills the number of EXECUTION_EVENT pairs and fee the total charged to the aggressor, all
+// exactly the sums over its per-fill executions, and price is the average fill price rounded to the
+// nearest tick. An order that does not trade, or stops at a self-trade, still gets one, reporting
+// zero filled. Orders resting in a call auction are not matched, so get none; neither does the
+// uncross. Must run on the matching goroutine
+func (e *MatchingEngine) SetFillSummaries(enabled bool) {
+	e.fillSummaries = enabled
+}
+
+// Running totals of one aggressive order's fills
+type fillSummary struct {
+	filled   Size
+	fills    uint32
+	notional uint64
+	fee      int64
+}
+
+func (s *fillSummary) add(price Price, size Size, fee int64) {
+	s.filled += size
+	s.fills++
+	s.notional += uint64(price) * uint64(size)
+	s.fee += fee
+}
+
+// Emit the AGG_FILL_EVENT for the order just matched, if summaries are on
+func (e *MatchingEngine) summarizeFills(symbol Symbol, side Side, trader TraderID, id OrderID) {
+	if !e.fillSummaries {
+		return
+	}
+	s := &e.summary
+	var average Price
+	if s.filled != 0 {
+		average = Price((s.notional + uint64(s.filled)/2) / uint64(s.filled))
+	}
+	e.outputRing.Push(OutputEvent{
+		eventType: AGG_FILL_EVENT,
+		orderID:   id,
+		clOrdID:   e.pool.get(Slot(id & SLOT_MASK)).clOrdID,
+		price:     average,
+		size:      s.filled,
+		notional:  s.notional,
+		fills:     s.fills,
+		fee:       s.fee,
+		trader:    trader,
+		symbol:    symbol,
+		side:      side,
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFillSummary_SweepAndUnfilledOrder(t *testing.T) {
+	e := newTestEngine()
+	limit(e, 1, Ask, 100, 3, 1, GTC)
+	limit(e, 1, Ask, 101, 4, 2, GTC)
+	limit(e, 1, Bid, 99, 10, 4, GTC)
+	if events := drainOutputEvents(e); len(events) != 6 {
+		t.Fatalf("expected no summaries while off, got %+v", events)
+	}
+
+	e.SetFillSummaries(true)
+	e.SetFees(-1, 5)
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 101, size: 10, trader: 3, clOrdID: 42})
+	events := drainOutputEvents(e)
+	n := len(events)
+	if n < 2 || events[n-2].eventType != AGG_FILL_EVENT || events[n-1].eventType != RESTED_EVENT {
+		t.Fatalf("expected the summary between the fills and the rest, got %+v", events)
+	}
+	var fee int64
+	for _, ev := range takerEvents(events) {
+		if ev.eventType == EXECUTION_EVENT {
+			fee += ev.fee
+		}
+	}
+	want := OutputEvent{eventType: AGG_FILL_EVENT, orderID: events[0].orderID, clOrdID: 42, price: 101, size: 7,
+		notional: 3*100 + 4*101, fills: 2, fee: fee, trader: 3, symbol: 1, side: Bid}
+	if events[n-2] != want {
+		t.Fatalf("expected %+v, got %+v", want, events[n-2])
+	}
+
+	// An order that cannot trade still gets a summary, of nothing
+	limit(e, 1, Ask, 200, 5, 5, GTC)
+	events = drainOutputEvents(e)
+	last := events[len(events)-2]
+	if last.eventType != AGG_FILL_EVENT || last.size != 0 || last.fills != 0 || last.notional != 0 || last.price != 0 {
+		t.Fatalf("expected an empty summary for the passive ask, got %+v", last)
+	}
+}
+
+func TestFillSummary_ReconcilesWithExecutions(t *testing.T) {
+	e := newTestEngine()
+	e.SetFillSummaries(true)
+	e.SetFees(2, 7)
+	rng := rand.New(rand.NewSource(1))
+	var ids []OrderID
+	owners := make(map[OrderID]TraderID)
+
+	for i := 0; i < 2000; i++ {
+		side := Side(rng.Intn(2))
+		switch op := rng.Intn(10); {
+		case op < 6 || len(ids) == 0:
+			e.LimitCommand(&InputCommand{symbol: 1, side: side, price: Price(90 + rng.Intn(21)), size: Size(1 + rng.Intn(20)),
+				peakSize: Size(rng.Intn(4)), trader: TraderID(rng.Intn(5)), tif: TimeInForce(rng.Intn(2))})
+		case op < 8:
+			e.Market(&InputCommand{symbol: 1, side: side, size: Size(1 + rng.Intn(40)), trader: TraderID(rng.Intn(5))})
+		default:
+			id := ids[rng.Intn(len(ids))]
+			e.Amend(id, Price(90+rng.Intn(21)), Size(1+rng.Intn(30)), owners[id])
+		}
+
+		var sum fillSummary
+		for _, ev := range drainOutputEvents(e) {
+			switch {
+			case ev.eventType == ORDER_EVENT:
+				ids = append(ids, ev.orderID)
+				owners[ev.orderID] = ev.trader
+			case ev.eventType == EXECUTION_EVENT && !ev.maker:
+				sum.add(ev.price, ev.size, ev.fee)
+			case ev.eventType == AGG_FILL_EVENT:
+				if ev.size != sum.filled || ev.fills != sum.fills || ev.notional != sum.notional || ev.fee != sum.fee {
+					t.Fatalf("op %d: summary %+v does not match its executions %+v", i, ev, sum)
+				}
+				sum = fillSummary{}
+			}
+		}
+		if sum != (fillSummary{}) {
+			t.Fatalf("op %d: executions %+v without a summary", i, sum)
+		}
+	}
+}
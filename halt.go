@@ -0,0 +1,24 @@
+package main
+
+// Halt stops trading in a symbol: new orders, amends and replaces are rejected with REJECT_HALTED,
+// while cancels (and GTD expiry) still go through so traders can pull their orders. Resting orders
+// and pending stops stay in the book. Emits a HALT_EVENT if the symbol was trading. Must run on the
+// matching goroutine (or send a HALT_EVENT command through the input ring)
+func (e *MatchingEngine) Halt(symbol Symbol) {
+	if symbol >= MAX_SYMBOLS || e.halted[symbol] {
+		return
+	}
+	e.halted[symbol] = true
+	e.outputRing.Push(OutputEvent{eventType: HALT_EVENT, symbol: symbol})
+}
+
+// Resume re-opens a halted symbol for trading, emitting a RESUME_EVENT. Orders that rested through
+// the halt keep their queue positions. Must run on the matching goroutine (or send a RESUME_EVENT
+// command through the input ring)
+func (e *MatchingEngine) Resume(symbol Symbol) {
+	if symbol >= MAX_SYMBOLS || !e.halted[symbol] {
+		return
+	}
+	e.halted[symbol] = false
+	e.outputRing.Push(OutputEvent{eventType: RESUME_EVENT, symbol: symbol})
+}
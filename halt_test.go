@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestHalt_RejectsTradingButAllowsCancels(t *testing.T) {
+	e := newTestEngine()
+
+	limit(e, 1, Bid, 100, 5, 1, GTC)
+	limit(e, 1, Bid, 99, 5, 1, GTC)
+	resting := drainOutputEvents(e)
+
+	e.Halt(1)
+	e.Halt(1) // Already halted: no second event
+	if evs := drainOutputEvents(e); len(evs) != 1 || evs[0].eventType != HALT_EVENT || evs[0].symbol != 1 {
+		t.Fatalf("expected a single HALT_EVENT, got %+v", evs)
+	}
+
+	limit(e, 1, Ask, 100, 5, 2, GTC)
+	e.Market(&InputCommand{symbol: 1, side: Ask, size: 5, trader: 2})
+	e.Amend(resting[0].orderID, 101, 5, resting[0].trader)
+	e.ReplaceCommand(&InputCommand{orderID: resting[0].orderID, symbol: 1, side: Bid, price: 101, size: 5, trader: 1})
+	for i, ev := range drainOutputEvents(e) {
+		if ev.eventType != REJECT_EVENT || ev.reason != REJECT_HALTED {
+			t.Fatalf("event %d: expected REJECT_HALTED, got %+v", i, ev)
+		}
+	}
+
+	e.Cancel(resting[2].orderID, 1)
+	if evs := drainOutputEvents(e); len(evs) != 1 || evs[0].eventType != CANCEL_EVENT {
+		t.Fatalf("expected the cancel to go through while halted, got %+v", evs)
+	}
+
+	// Other symbols keep trading
+	limit(e, 2, Bid, 100, 1, 1, GTC)
+	if evs := drainOutputEvents(e); len(evs) != 2 || evs[0].eventType != ORDER_EVENT || evs[1].eventType != RESTED_EVENT {
+		t.Fatalf("expected symbol 2 to be unaffected, got %+v", evs)
+	}
+}
+
+func TestResume_RestoresMatchingAgainstPreHaltOrders(t *testing.T) {
+	e := newTestEngine()
+
+	limit(e, 1, Bid, 100, 5, 1, GTC)
+	bid := drainOutputEvents(e)[0].orderID
+
+	e.Halt(1)
+	e.Resume(1)
+	e.Resume(1) // Already trading: no second event
+	if evs := drainOutputEvents(e); len(evs) != 2 || evs[0].eventType != HALT_EVENT || evs[1].eventType != RESUME_EVENT {
+		t.Fatalf("expected HALT_EVENT then a single RESUME_EVENT, got %+v", evs)
+	}
+
+	limit(e, 1, Ask, 100, 5, 2, GTC)
+	fills := fillsByCounterOrder(drainOutputEvents(e))
+	if fills[bid] != 5 {
+		t.Fatalf("expected the pre-halt bid to fill 5 after resuming, got %d", fills[bid])
+	}
+}
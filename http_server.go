@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+const (
+	RECENT_TRADES = 1 << 7 // Prints kept per symbol for GET /trades
+	DEFAULT_DEPTH = 10     // Levels per side of GET /book without a depth parameter
+)
+
+// Read-only HTTP endpoints for dashboards and operations, all returning JSON:
+//
+//	GET /book/{symbol}?depth=N  the top N (default DEFAULT_DEPTH) price levels on each side, best first
+//	GET /trades/{symbol}        the symbol's last RECENT_TRADES prints, oldest first
+//	GET /stats                  the engine's counters (see Stats)
+//
+// Book snapshots are read by Query on the matching goroutine, so each is consistent between two
+// commands; a request made while the engine is stopped gets 503. Prints are recorded from the trade
+// tape, so register the server with OnTrade(server.RecordTrade) before starting the output
+// distributor. Serve it with http.ListenAndServe or any http.Server
+type HTTPServer struct {
+	engine *MatchingEngine
+	mux    *http.ServeMux
+
+	mu     sync.Mutex // Guards recent against RecordTrade on the output distributor
+	recent [MAX_SYMBOLS]recentTrades
+}
+
+// A symbol's last RECENT_TRADES prints, as a ring
+type recentTrades struct {
+	trades [RECENT_TRADES]Trade
+	count  uint64 // Prints recorded in all, the newest at (count-1) % RECENT_TRADES
+}
+
+// NewHTTPServer serves e's endpoints (see HTTPServer)
+func NewHTTPServer(e *MatchingEngine) *HTTPServer {
+	s := &HTTPServer{engine: e, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /book/{symbol}", s.book)
+	s.mux.HandleFunc("GET /trades/{symbol}", s.trades)
+	s.mux.HandleFunc("GET /stats", s.stats)
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// RecordTrade keeps a print for GET /trades; an OnTrade callback
+func (s *HTTPServer) RecordTrade(tr Trade) {
+	if tr.symbol >= MAX_SYMBOLS {
+		return
+	}
+	s.mu.Lock()
+	recent := &s.recent[tr.symbol]
+	recent.trades[recent.count%RECENT_TRADES] = tr
+	recent.count++
+	s.mu.Unlock()
+}
+
+func (s *HTTPServer) book(w http.ResponseWriter, r *http.Request) {
+	symbol, ok := parseSymbol(w, r)
+	if !ok {
+		return
+	}
+	depth := DEFAULT_DEPTH
+	if param := r.URL.Query().Get("depth"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n <= 0 {
+			http.Error(w, "depth must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		depth = n
+	}
+
+	var bids, asks []PriceLevelView
+	if err := s.engine.Query(func() { bids, asks = s.engine.Depth(symbol, depth) }); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	buf := append(make([]byte, 0, 64+32*(len(bids)+len(asks))), `{"symbol":`...)
+	buf = strconv.AppendUint(buf, uint64(symbol), 10)
+	buf = append(buf, `,"bids":`...)
+	buf = appendLevelsJSON(buf, bids)
+	buf = append(buf, `,"asks":`...)
+	buf = appendLevelsJSON(buf, asks)
+	writeJSON(w, append(buf, '}'))
+}
+
+func (s *HTTPServer) trades(w http.ResponseWriter, r *http.Request) {
+	symbol, ok := parseSymbol(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	recent := &s.recent[symbol]
+	buf := make([]byte, 0, 64+96*min(recent.count, RECENT_TRADES))
+	buf = append(buf, `{"symbol":`...)
+	buf = strconv.AppendUint(buf, uint64(symbol), 10)
+	buf = append(buf, `,"trades":[`...)
+	oldest := recent.count - min(recent.count, RECENT_TRADES)
+	for i := oldest; i < recent.count; i++ {
+		tr := &recent.trades[i%RECENT_TRADES]
+		if i > oldest {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, `{"trade_id":"`...)
+		buf = strconv.AppendUint(buf, uint64(tr.id), 10)
+		buf = append(buf, `","price":`...)
+		buf = strconv.AppendUint(buf, uint64(tr.price), 10)
+		buf = append(buf, `,"size":`...)
+		buf = strconv.AppendUint(buf, uint64(tr.size), 10)
+		buf = append(buf, `,"aggressor":"`...)
+		buf = append(buf, tr.aggressor.String()...)
+		buf = append(buf, `"}`...)
+	}
+	s.mu.Unlock()
+	writeJSON(w, append(buf, "]}"...))
+}
+
+func (s *HTTPServer) stats(w http.ResponseWriter, r *http.Request) {
+	stats := s.engine.Stats()
+	buf := append(make([]byte, 0, 160), `{"accepted":`...)
+	buf = strconv.AppendUint(buf, stats.accepted, 10)
+	buf = append(buf, `,"rejected":`...)
+	buf = strconv.AppendUint(buf, stats.rejected, 10)
+	buf = append(buf, `,"cancelled":`...)
+	buf = strconv.AppendUint(buf, stats.cancelled, 10)
+	buf = append(buf, `,"trades":`...)
+	buf = strconv.AppendUint(buf, stats.trades, 10)
+	buf = append(buf, `,"volume":`...)
+	buf = strconv.AppendUint(buf, stats.volume, 10)
+	buf = append(buf, `,"dropped":`...)
+	buf = strconv.AppendUint(buf, stats.dropped, 10)
+	writeJSON(w, append(buf, '}'))
+}
+
+// The request's {symbol}, or false once a 404 has been written for a malformed or unknown one
+func parseSymbol(w http.ResponseWriter, r *http.Request) (Symbol, bool) {
+	n, err := strconv.ParseUint(r.PathValue("symbol"), 10, 16)
+	if err != nil || n >= MAX_SYMBOLS {
+		http.Error(w, "unknown symbol", http.StatusNotFound)
+		return 0, false
+	}
+	return Symbol(n), true
+}
+
+// Append levels as a JSON array of {"price","size"} objects
+func appendLevelsJSON(buf []byte, levels []PriceLevelView) []byte {
+	buf = append(buf, '[')
+	for i, level := range levels {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, `{"price":`...)
+		buf = strconv.AppendUint(buf, uint64(level.price), 10)
+		buf = append(buf, `,"size":`...)
+		buf = strconv.AppendUint(buf, uint64(level.size), 10)
+		buf = append(buf, '}')
+	}
+	return append(buf, ']')
+}
+
+func writeJSON(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Helper to make a GET request of the server, returning the status and body
+func get(s *HTTPServer, target string) (int, string) {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w.Code, w.Body.String()
+}
+
+func TestHTTPServer_Book(t *testing.T) {
+	e := newTestEngine()
+	s := NewHTTPServer(e)
+	go e.StartInputDistributor()
+
+	for _, price := range []Price{8, 9, 10} {
+		e.inputRing.Push(InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: price, size: Size(price), trader: 1})
+	}
+	e.inputRing.Push(InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Ask, price: 12, size: 5, trader: 2})
+
+	code, body := get(s, "/book/1?depth=2")
+	if want := `{"symbol":1,"bids":[{"price":10,"size":10},{"price":9,"size":9}],"asks":[{"price":12,"size":5}]}`; code != http.StatusOK || body != want {
+		t.Fatalf("expected 200 %s, got %d %s", want, code, body)
+	}
+	if code, body := get(s, "/book/2"); code != http.StatusOK || body != `{"symbol":2,"bids":[],"asks":[]}` {
+		t.Fatalf("expected an empty book, got %d %s", code, body)
+	}
+
+	for target, want := range map[string]int{"/book/256": http.StatusNotFound, "/book/x": http.StatusNotFound, "/book/1?depth=0": http.StatusBadRequest} {
+		if code, _ := get(s, target); code != want {
+			t.Errorf("%s: expected %d, got %d", target, want, code)
+		}
+	}
+
+	e.Stop()
+	if code, _ := get(s, "/book/1"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 once the engine has stopped, got %d", code)
+	}
+}
+
+func TestHTTPServer_TradesKeepsTheMostRecent(t *testing.T) {
+	e := newTestEngine()
+	s := NewHTTPServer(e)
+
+	for i := 1; i <= RECENT_TRADES+2; i++ {
+		s.RecordTrade(Trade{id: TradeID(i), symbol: 1, price: 10, size: 1, aggressor: Ask})
+	}
+	s.RecordTrade(Trade{id: 99, symbol: 2, price: 20, size: 3, aggressor: Bid})
+
+	if code, body := get(s, "/trades/2"); code != http.StatusOK || body != `{"symbol":2,"trades":[{"trade_id":"99","price":20,"size":3,"aggressor":"bid"}]}` {
+		t.Fatalf("expected symbol 2's one print, got %d %s", code, body)
+	}
+	_, body := get(s, "/trades/1")
+	first := `{"symbol":1,"trades":[{"trade_id":"3","price":10,"size":1,"aggressor":"ask"},`
+	if len(body) < len(first) || body[:len(first)] != first {
+		t.Fatalf("expected the prints from trade 3 on, got %s", body)
+	}
+}
+
+func TestHTTPServer_Stats(t *testing.T) {
+	e := newTestEngine()
+	s := NewHTTPServer(e)
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	e.Limit(1, Bid, 10, 2, 2, GTC)
+	e.Limit(1, Bid, 10, 0, 2, GTC)
+
+	code, body := get(s, "/stats")
+	if want := `{"accepted":2,"rejected":1,"cancelled":0,"trades":1,"volume":2,"dropped":0}`; code != http.StatusOK || body != want {
+		t.Fatalf("expected 200 %s, got %d %s", want, code, body)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrBookInvalid = errors.New("orderbook: invariant violated")
+
+// Validate checks a book's structure against the pool holding its orders: every non-empty price
+// level (and no empty one) is marked in its side's bitmap, bidMax and askMin are the best non-empty
+// levels, and each level's queue is a correctly terminated doubly-linked list of resting orders at
+// that price and side whose visible sizes add up to the level's volume. A book keeping volume trees
+// must have each level's volume at its leaf and each inner node the sum of its children. It walks
+// every level, so it is a safety net for tests and staging rather than something to run per order.
+// The error wraps ErrBookInvalid, naming the first violation found
+func (book *OrderBook) Validate(pool *OrderPool) error {
+	bidMax, askMin := Price(0), book.priceLevels()
+	for _, side := range []Side{Bid, Ask} {
+		bits := book.bits(side)
+		for price := Price(0); price < book.priceLevels(); price++ {
+			level := book.level(side, price)
+			if marked := bits.next(price) == price; marked != (level.headSlot != 0) {
+				return fmt.Errorf("%w: side %d level %d has head %d but bitmap bit %t", ErrBookInvalid, side, price, level.headSlot, marked)
+			}
+			if level.headSlot == 0 {
+				if level.tailSlot != 0 || level.volume != 0 {
+					return fmt.Errorf("%w: side %d level %d is empty but has tail %d and volume %d", ErrBookInvalid, side, price, level.tailSlot, level.volume)
+				}
+				continue
+			}
+			if err := level.validate(pool, side, price); err != nil {
+				return err
+			}
+			if side == Bid {
+				bidMax = price
+			} else if askMin == book.priceLevels() {
+				askMin = price
+			}
+		}
+	}
+
+	if book.bidMax != bidMax || book.askMin != askMin {
+		return fmt.Errorf("%w: best prices are bid %d and ask %d, book has %d and %d", ErrBookInvalid, bidMax, askMin, book.bidMax, book.askMin)
+	}
+	if book.bidVolumes.nodes != nil {
+		return book.validateVolumes()
+	}
+	return nil
+}
+
+// Check both volume trees against the levels and the best prices
+func (book *OrderBook) validateVolumes() error {
+	for _, side := range []Side{Bid, Ask} {
+		tree := book.volumes(side)
+		for i := Price(1); i < 2*tree.leaves; i++ {
+			want := uint64(0)
+			if i < tree.leaves {
+				want = tree.nodes[2*i] + tree.nodes[2*i+1]
+			} else if price := i - tree.leaves; price < book.priceLevels() {
+				want = uint64(book.level(side, price).volume)
+			}
+			if tree.nodes[i] != want {
+				return fmt.Errorf("%w: side %d volume tree node %d holds %d, not %d", ErrBookInvalid, side, i, tree.nodes[i], want)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks the whole engine's structure, between commands (on the matching goroutine or while
+// it is idle): every allocated book passes OrderBook.Validate and, outside a call auction, is not
+// crossed; every pending stop list is in trigger order with its trailing count right; the free list
+// is a terminated list of distinct slots; every allocated slot is working in exactly one place (a
+// price level or a stop list of its own symbol and side), and no free slot is referenced from a book,
+// a trader's list of working orders, the client order ID index or an OCO group; and every working
+// order is in its trader's list. Like OrderBook.Validate it walks everything, so it is for tests and
+// staging. The error wraps ErrBookInvalid, naming the first violation found
+func (e *MatchingEngine) Validate() error {
+	p := e.pool
+	free := make([]bool, p.nextFreeSlot+1)
+	for slot := p.freeHead; slot != 0; slot = p.orders[slot].nextSlot {
+		if !p.isValid(slot) || free[slot] {
+			return fmt.Errorf("%w: free list reaches slot %d twice or outside the pool", ErrBookInvalid, slot)
+		}
+		free[slot] = true
+	}
+
+	// Every working order, claimed by the one place it is working in
+	working := make([]bool, p.nextFreeSlot+1)
+	claim := func(slot Slot, symbol Symbol, side Side) error {
+		if !p.isValid(slot) || free[slot] || working[slot] {
+			return fmt.Errorf("%w: symbol %d side %d references slot %d, which is free, outside the pool or working elsewhere", ErrBookInvalid, symbol, side, slot)
+		}
+		if order := p.get(slot); order.symbol != symbol || order.side != side {
+			return fmt.Errorf("%w: symbol %d side %d holds slot %d, an order for symbol %d side %d", ErrBookInvalid, symbol, side, slot, order.symbol, order.side)
+		}
+		working[slot] = true
+		return nil
+	}
+
+	for i := range e.books {
+		book, symbol := &e.books[i], Symbol(i)
+		if book.shared {
+			if len(book.buyStops) != 0 || len(book.sellStops) != 0 {
+				return fmt.Errorf("%w: symbol %d has pending stops but no price levels", ErrBookInvalid, symbol)
+			}
+			continue
+		}
+		if err := book.Validate(p); err != nil {
+			return fmt.Errorf("symbol %d: %w", symbol, err)
+		}
+		if !e.auctions[symbol] && book.bidMax >= book.askMin {
+			return fmt.Errorf("%w: symbol %d crossed outside an auction, bid %d at or above ask %d", ErrBookInvalid, symbol, book.bidMax, book.askMin)
+		}
+
+		for _, side := range []Side{Bid, Ask} {
+			for price := Price(1); price < book.priceLevels(); price++ {
+				for slot := book.level(side, price).headSlot; slot != 0; slot = p.get(slot).nextSlot {
+					if err := claim(slot, symbol, side); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		trailing := 0
+		for _, side := range []Side{Bid, Ask} {
+			stops := *book.stops(side)
+			for j, stop := range stops {
+				if err := claim(stop.slot, symbol, side); err != nil {
+					return err
+				}
+				if p.get(stop.slot).flags&FLAG_PENDING_STOP == 0 {
+					return fmt.Errorf("%w: symbol %d pending stop in slot %d is not flagged as one", ErrBookInvalid, symbol, stop.slot)
+				}
+				if j > 0 && (side == Bid && stops[j-1].stopPrice < stop.stopPrice || side == Ask && stops[j-1].stopPrice > stop.stopPrice) {
+					return fmt.Errorf("%w: symbol %d side %d stops out of trigger order at %d", ErrBookInvalid, symbol, side, j)
+				}
+				if stop.trail != 0 {
+					trailing++
+				}
+			}
+		}
+		if trailing != book.trailing {
+			return fmt.Errorf("%w: symbol %d has %d trailing stops but counts %d", ErrBookInvalid, symbol, trailing, book.trailing)
+		}
+	}
+
+	live := 0
+	for slot := Slot(1); slot <= p.nextFreeSlot; slot++ {
+		if !free[slot] && !working[slot] {
+			return fmt.Errorf("%w: slot %d is allocated but not working in any book", ErrBookInvalid, slot)
+		}
+		if working[slot] {
+			live++
+		}
+	}
+
+	tracked := 0
+	for trader, head := range p.traderHeads {
+		prev := Slot(0)
+		for slot := head; slot != 0; slot = p.get(slot).traderNext {
+			if tracked++; tracked > live || !working[slot] || p.get(slot).trader != TraderID(trader) || p.get(slot).traderPrev != prev {
+				return fmt.Errorf("%w: trader %d's working orders reach slot %d, which is not a correctly linked working order of theirs", ErrBookInvalid, trader, slot)
+			}
+			prev = slot
+		}
+	}
+	if tracked != live {
+		return fmt.Errorf("%w: %d working orders but %d in traders' lists", ErrBookInvalid, live, tracked)
+	}
+
+	for key, slot := range p.clOrdIDs {
+		if !p.isValid(slot) || !working[slot] || p.get(slot).clOrdID != key.clOrdID || p.get(slot).trader != key.trader {
+			return fmt.Errorf("%w: client order ID %d of trader %d indexes slot %d, which is not that working order", ErrBookInvalid, key.clOrdID, key.trader, slot)
+		}
+	}
+	for slot, link := range p.groups {
+		if !p.isValid(slot) || !working[slot] || p.get(slot).flags&FLAG_OCO == 0 || !p.isValid(link.next) || !working[link.next] {
+			return fmt.Errorf("%w: OCO group %d links slot %d to slot %d, not both working grouped orders", ErrBookInvalid, link.groupID, slot, link.next)
+		}
+	}
+	return nil
+}
+
+// Check one non-empty level's queue, bounding the walk by the pool size so a cycle is reported rather than followed forever
+func (level *PriceLevel) validate(pool *OrderPool, side Side, price Price) error {
+	var volume Size
+	prev, steps := Slot(0), 0
+	for slot := level.headSlot; slot != 0; slot = pool.get(slot).nextSlot {
+		order := pool.get(slot)
+		if steps++; steps > len(pool.orders) || !pool.isValid(slot) {
+			return fmt.Errorf("%w: side %d level %d queue reaches slot %d, outside the pool or in a cycle", ErrBookInvalid, side, price, slot)
+		}
+		if order.prevSlot != prev {
+			return fmt.Errorf("%w: side %d level %d slot %d links back to %d, not %d", ErrBookInvalid, side, price, slot, order.prevSlot, prev)
+		}
+		if order.side != side || order.price != price || Slot(order.id&SLOT_MASK) != slot || order.size == 0 || order.flags&FLAG_PENDING_STOP != 0 {
+			return fmt.Errorf("%w: side %d level %d slot %d holds order %d (side %d, price %d, size %d, flags %#x)",
+				ErrBookInvalid, side, price, slot, order.id, order.side, order.price, order.size, order.flags)
+		}
+		volume += order.size
+		prev = slot
+	}
+	if level.tailSlot != prev || level.volume != volume {
+		return fmt.Errorf("%w: side %d level %d ends at slot %d with volume %d, level has tail %d and volume %d",
+			ErrBookInvalid, side, price, prev, volume, level.tailSlot, level.volume)
+	}
+	return nil
+}
+
+// Panic if a book outside a call auction has crossed (its best bid at or above its best ask), which
+// no correct match can leave behind. Compiled in only by -tags bookcheck (see checkBooks), for tests
+// and staging
+func (e *MatchingEngine) checkUncrossed(book *OrderBook, symbol Symbol) {
+	if checkBooks && !e.auctions[symbol] && book.bidMax >= book.askMin {
+		panic(fmt.Sprintf("orderbook: symbol %d crossed, bid %d at or above ask %d", symbol, book.bidMax, book.askMin))
+	}
+}
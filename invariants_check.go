@@ -0,0 +1,6 @@
+//go:build bookcheck
+
+package main
+
+// Panic as soon as a continuous book crosses (see checkUncrossed). Selected with -tags bookcheck
+const checkBooks = true
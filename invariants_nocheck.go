@@ -0,0 +1,6 @@
+//go:build !bookcheck
+
+package main
+
+// No crossed-book check on the matching path (build with -tags bookcheck to enable it)
+const checkBooks = false
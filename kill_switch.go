@@ -0,0 +1,29 @@
+package main
+
+// Disable is a risk kill switch for a trader: new orders (limit, market and stop), amends and
+// replaces are rejected with REJECT_TRADER_DISABLED, while cancels still go through. Working orders
+// are left alone; follow with CancelAll (or a MASS_CANCEL_EVENT command) to pull them too. Emits a
+// DISABLE_EVENT if the trader was enabled. Must run on the matching goroutine (or send a
+// DISABLE_EVENT command through the input ring)
+func (e *MatchingEngine) Disable(trader TraderID) {
+	if e.isDisabled(trader) {
+		return
+	}
+	e.disabled[trader/64] |= 1 << (trader % 64)
+	e.outputRing.Push(OutputEvent{eventType: DISABLE_EVENT, trader: trader})
+}
+
+// Enable lets a disabled trader enter orders again, emitting an ENABLE_EVENT. Must run on the
+// matching goroutine (or send an ENABLE_EVENT command through the input ring)
+func (e *MatchingEngine) Enable(trader TraderID) {
+	if !e.isDisabled(trader) {
+		return
+	}
+	e.disabled[trader/64] &^= 1 << (trader % 64)
+	e.outputRing.Push(OutputEvent{eventType: ENABLE_EVENT, trader: trader})
+}
+
+// A single bit test, so the check costs next to nothing for the usual enabled trader
+func (e *MatchingEngine) isDisabled(trader TraderID) bool {
+	return e.disabled[trader/64]&(1<<(trader%64)) != 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisable_RejectsNewOrdersButAllowsCancels(t *testing.T) {
+	e := newTestEngine()
+
+	limit(e, 1, Bid, 100, 5, 1, GTC)
+	limit(e, 1, Bid, 99, 5, 1, GTC)
+	resting := takerEvents(drainOutputEvents(e))
+
+	e.Disable(1)
+	e.Disable(1) // Already disabled: no second event
+	if evs := takerEvents(drainOutputEvents(e)); len(evs) != 1 || evs[0].eventType != DISABLE_EVENT || evs[0].trader != 1 {
+		t.Fatalf("expected a single DISABLE_EVENT, got %+v", evs)
+	}
+
+	limit(e, 1, Ask, 110, 5, 1, GTC)
+	limit(e, 2, Ask, 110, 5, 1, GTC)
+	e.Market(&InputCommand{symbol: 1, side: Ask, size: 5, trader: 1})
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 121, stopPrice: 120, size: 5, trader: 1})
+	e.Amend(resting[0].orderID, 101, 5, resting[0].trader)
+	e.ReplaceCommand(&InputCommand{orderID: resting[0].orderID, symbol: 1, side: Bid, price: 101, size: 5, trader: 1})
+	for i, ev := range takerEvents(drainOutputEvents(e)) {
+		if ev.eventType != REJECT_EVENT || ev.reason != REJECT_TRADER_DISABLED {
+			t.Fatalf("event %d: expected REJECT_TRADER_DISABLED, got %+v", i, ev)
+		}
+	}
+
+	// Other traders are unaffected and can still trade against the disabled trader's resting orders
+	limit(e, 1, Ask, 100, 2, 2, GTC)
+	if evs := takerEvents(drainOutputEvents(e)); len(evs) != 2 || evs[1].eventType != EXECUTION_EVENT {
+		t.Fatalf("expected trader 2 to trade, got %+v", evs)
+	}
+
+	e.Cancel(resting[1].orderID, 1)
+	if evs := takerEvents(drainOutputEvents(e)); len(evs) != 1 || evs[0].eventType != CANCEL_EVENT {
+		t.Fatalf("expected the cancel to go through while disabled, got %+v", evs)
+	}
+
+	// Disabled traders survive a snapshot
+	var snap bytes.Buffer
+	if err := e.SaveSnapshot(&snap); err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	restored := newTestEngine()
+	if err := restored.LoadSnapshot(&snap); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !restored.isDisabled(1) || restored.isDisabled(2) {
+		t.Fatalf("expected only trader 1 disabled after a reload")
+	}
+}
+
+func TestEnable_ThroughInputRing(t *testing.T) {
+	e := newTestEngine()
+
+	e.dispatch(&InputCommand{eventType: DISABLE_EVENT, trader: 7})
+	e.dispatch(&InputCommand{eventType: ENABLE_EVENT, trader: 7})
+	e.dispatch(&InputCommand{eventType: ENABLE_EVENT, trader: 7}) // Already enabled: no event
+	limit(e, 1, Bid, 100, 5, 7, GTC)
+
+	evs := drainOutputEvents(e)
+	if len(evs) != 4 || evs[0].eventType != DISABLE_EVENT || evs[1].eventType != ENABLE_EVENT || evs[2].eventType != ORDER_EVENT {
+		t.Fatalf("expected DISABLE_EVENT, ENABLE_EVENT, then an accepted order, got %+v", evs)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+// SetLevelUpdates turns the incremental market-data feed on or off (it is off by default, as it adds
+// an event to most order operations). While on, every change to a price level's visible volume, from
+// an order resting, filling, being amended or being cancelled, is followed by a LEVEL_UPDATE with the
+// symbol, side, price and the level's new aggregate size, 0 once the level has cleared. A consumer
+// seeds its book from Depth and then applies the updates in order. Must run on the matching goroutine
+func (e *MatchingEngine) SetLevelUpdates(enabled bool) {
+	e.levelUpdates = enabled
+}
+
+// Follow a change to a level's volume: update the book's volume tree, if it keeps them, and emit a
+// LEVEL_UPDATE if the feed is on and the volume is no longer before
+func (e *MatchingEngine) levelChanged(symbol Symbol, side Side, price Price, before Size) {
+	if !e.levelUpdates && !e.volumeTrees {
+		return
+	}
+	book := &e.books[symbol]
+	volume := book.level(side, price).volume
+	book.volumes(side).set(price, volume)
+	if e.levelUpdates && volume != before {
+		e.outputRing.Push(OutputEvent{eventType: LEVEL_UPDATE, symbol: symbol, side: side, price: price, size: volume})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import "testing"
+
+// Helper to apply LEVEL_UPDATEs to a consumer-side book, failing on an update that changes nothing
+func applyLevelUpdates(t *testing.T, book map[Side]map[Price]Size, events []OutputEvent) {
+	t.Helper()
+	for _, ev := range events {
+		if ev.eventType != LEVEL_UPDATE {
+			continue
+		}
+		if book[ev.side][ev.price] == ev.size {
+			t.Fatalf("LEVEL_UPDATE without a volume change: %+v", ev)
+		}
+		if ev.size == 0 {
+			delete(book[ev.side], ev.price)
+		} else {
+			book[ev.side][ev.price] = ev.size
+		}
+	}
+}
+
+func TestLevelUpdates_ReplayMatchesDepth(t *testing.T) {
+	e := newTestEngine()
+	e.SetLevelUpdates(true)
+	e.SetSTPMode(STP_CANCEL_RESTING)
+	book := map[Side]map[Price]Size{Bid: {}, Ask: {}}
+
+	check := func(step string) {
+		applyLevelUpdates(t, book, drainOutputEvents(e))
+		bids, asks := e.Depth(1, DEFAULT_PRICE_LEVELS)
+		for side, levels := range map[Side][]PriceLevelView{Bid: bids, Ask: asks} {
+			if len(levels) != len(book[side]) {
+				t.Fatalf("%s: expected %d %v levels, replayed %v", step, len(levels), side, book[side])
+			}
+			for _, level := range levels {
+				if book[side][level.price] != level.size {
+					t.Fatalf("%s: expected %v %d @ %d, replayed %d", step, side, level.size, level.price, book[side][level.price])
+				}
+			}
+		}
+	}
+
+	limit(e, 1, Ask, 101, 5, 1, GTC)
+	limit(e, 1, Ask, 101, 3, 2, GTC)
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 102, size: 9, peakSize: 3, trader: 3})
+	limit(e, 1, Bid, 99, 4, 4, GTC)
+	check("resting")
+
+	limit(e, 1, Bid, 101, 6, 5, GTC) // Clears 101, one order partly
+	check("sweep")
+
+	limit(e, 1, Bid, 102, 3, 5, IOC) // Consumes the iceberg peak, which refills to the same size
+	check("iceberg refill")
+
+	id, _ := e.TryLimit(1, Bid, 98, 2, 6, GTC)
+	check("second bid")
+
+	e.Amend(id, 98, 5, 6) // Requeued at the same price
+	check("amend up")
+	e.Amend(id, 98, 1, 6) // Reduced in place
+	check("amend down")
+	e.Amend(id, 102, 1, 6) // Moves level and trades
+	check("amend across")
+
+	limit(e, 1, Ask, 99, 6, 4, GTC) // Cancels trader 4's own bid under STP, then rests
+	check("self-trade cancel")
+
+	e.CancelSymbol(1)
+	check("cancel symbol")
+	if len(book[Bid]) != 0 || len(book[Ask]) != 0 {
+		t.Fatalf("expected every replayed level cleared, got %v", book)
+	}
+}
+
+func TestLevelUpdates_ClearedLevelReportsZero(t *testing.T) {
+	e := newTestEngine()
+	e.SetLevelUpdates(true)
+
+	limit(e, 1, Bid, 50, 5, 1, GTC)
+	id := drainOutputEvents(e)[0].orderID
+	e.Cancel(id, 1)
+
+	events := drainOutputEvents(e)
+	if len(events) != 2 || events[0].eventType != LEVEL_UPDATE || events[0].side != Bid || events[0].price != 50 || events[0].size != 0 {
+		t.Fatalf("expected a LEVEL_UPDATE clearing 50 then the CANCEL_EVENT, got %+v", events)
+	}
+}
+
+func TestLevelUpdates_OffByDefault(t *testing.T) {
+	e := newTestEngine()
+
+	limit(e, 1, Ask, 101, 5, 1, GTC)
+	limit(e, 1, Bid, 101, 2, 2, GTC)
+	for _, ev := range drainOutputEvents(e) {
+		if ev.eventType == LEVEL_UPDATE {
+			t.Fatalf("expected no LEVEL_UPDATE unless enabled, got %+v", ev)
+		}
+	}
+}
@@ -29,8 +29,9 @@ func main() {
 	var totalInputs uint64
 	var totalOutputs uint64
 
-	// Track the recent OrderIDs for generating valid CANCELs
+	// Track the recent OrderIDs (and their owners) for generating valid CANCELs
 	var recentIDs [DISTRIBUTOR_BUFFER]OrderID
+	var recentTraders [DISTRIBUTOR_BUFFER]TraderID
 	var recentCount int
 
 	// Start input / output distributors
@@ -43,6 +44,7 @@ func main() {
 		// Keep recent OrderIDs updated on order events
 		if ev.eventType == ORDER_EVENT {
 			recentIDs[recentCount%DISTRIBUTOR_BUFFER] = ev.orderID
+			recentTraders[recentCount%DISTRIBUTOR_BUFFER] = ev.trader
 			recentCount++
 		}
 	})
@@ -58,6 +60,7 @@ func main() {
 			cmd = InputCommand{
 				eventType: CANCEL_EVENT,
 				orderID:   recentIDs[idx],
+				trader:    recentTraders[idx],
 			}
 		} else {
 			cmd = InputCommand{
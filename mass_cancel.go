@@ -0,0 +1,82 @@
+package main
+
+// CancelAll cancels every working order of a trader across all symbols, resting orders and pending
+// stops alike (a risk kill switch, or cancel-on-disconnect when sent as a MASS_CANCEL_EVENT command).
+// It walks the trader's own list of working orders rather than the books, emitting a CANCEL_EVENT
+// per order (newest first) and then a MASS_CANCEL_EVENT whose size is how many were cancelled, so a
+// trader with nothing open just gets a zero summary. Must run on the matching goroutine
+func (e *MatchingEngine) CancelAll(trader TraderID) {
+	var count Size
+	for slot := e.pool.traderHeads[trader]; slot != 0; {
+		order := e.pool.get(slot)
+		next := order.traderNext // Cancelling frees the slot and unlinks it from the list
+
+		ev := cancelEvent(order)
+		if e.cancel(order.id) {
+			e.emitCancel(ev)
+			count++
+		}
+		slot = next
+	}
+
+	e.outputRing.Push(OutputEvent{eventType: MASS_CANCEL_EVENT, trader: trader, size: count})
+}
+
+// CancelSymbol clears a symbol's book, for halts and market resets: every resting order and pending
+// stop is cancelled with a CANCEL_EVENT, best bid first and then best ask first, followed by the
+// stops. Only non-empty levels are visited, found through the price bitmaps, and each level is
+// dropped whole rather than unlinking its orders one by one. Must run on the matching goroutine
+func (e *MatchingEngine) CancelSymbol(symbol Symbol) {
+	if symbol >= MAX_SYMBOLS {
+		return
+	}
+	book := &e.books[symbol]
+
+	for price := book.bidBits.prev(book.bidMax); price > 0; price = book.bidBits.prev(price - 1) {
+		e.cancelLevel(symbol, Bid, price)
+	}
+	for price := book.askBits.next(book.askMin); price < book.priceLevels(); price = book.askBits.next(price + 1) {
+		e.cancelLevel(symbol, Ask, price)
+	}
+	book.bidMax, book.askMin = 0, book.priceLevels()
+
+	for _, stops := range []*[]pendingStop{&book.buyStops, &book.sellStops} {
+		for _, stop := range *stops {
+			e.emitCancel(cancelEvent(e.pool.get(stop.slot)))
+			e.pool.free(stop.slot)
+		}
+		*stops = (*stops)[:0]
+	}
+	book.trailing = 0
+}
+
+// Cancel and free every order queued at a price level, then empty it
+func (e *MatchingEngine) cancelLevel(symbol Symbol, side Side, price Price) {
+	book := &e.books[symbol]
+	level := book.level(side, price)
+	before := level.volume
+	for slot := level.headSlot; slot != 0; {
+		order := e.pool.get(slot)
+		next := order.nextSlot
+		e.emitCancel(cancelEvent(order))
+		e.pool.free(slot)
+		slot = next
+	}
+	*level = PriceLevel{}
+	book.bits(side).clear(price)
+	e.levelChanged(symbol, side, price, before)
+}
+
+// CANCEL_EVENT reporting a working order's full open quantity (visible plus any iceberg reserve)
+func cancelEvent(order *Order) OutputEvent {
+	return OutputEvent{
+		eventType: CANCEL_EVENT,
+		orderID:   order.id,
+		clOrdID:   order.clOrdID,
+		price:     order.price,
+		size:      order.size + order.reserve,
+		trader:    order.trader,
+		symbol:    order.symbol,
+		side:      order.side,
+	}
+}
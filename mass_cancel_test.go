@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestCancelAll_AcrossSymbols(t *testing.T) {
+	e := newTestEngine()
+
+	limit(e, 1, Bid, 100, 5, 1, GTC)
+	limit(e, 2, Ask, 200, 5, 1, GTC)
+	e.LimitCommand(&InputCommand{symbol: 3, side: Bid, price: 151, stopPrice: 150, size: 5, trader: 1})
+	limit(e, 4, Ask, 50, 10, 1, GTC)
+	limit(e, 4, Bid, 50, 4, 3, GTC) // Partially fills trader 1's ask, which keeps 6 open
+	limit(e, 5, Bid, 80, 5, 1, GTC)
+	limit(e, 1, Ask, 110, 5, 2, GTC) // Another trader's order is untouched
+	events := drainOutputEvents(e)
+	e.Cancel(events[len(events)-4].orderID, 1) // Trader 1's symbol 5 bid is already gone
+	drainOutputEvents(e)
+
+	// Restore into another engine first, to check the trader lists survive a snapshot
+	var snap bytes.Buffer
+	if err := e.SaveSnapshot(&snap); err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	restored := newTestEngine()
+	if err := restored.LoadSnapshot(&snap); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	for _, eng := range []*MatchingEngine{e, restored} {
+		eng.CancelAll(1)
+
+		cancelled := map[Symbol]Size{}
+		events = drainOutputEvents(eng)
+		for _, ev := range events[:len(events)-1] {
+			if ev.eventType != CANCEL_EVENT || ev.trader != 1 {
+				t.Fatalf("expected only CANCEL_EVENTs for trader 1, got %+v", ev)
+			}
+			cancelled[ev.symbol] = ev.size
+		}
+		if len(cancelled) != 4 || cancelled[1] != 5 || cancelled[2] != 5 || cancelled[3] != 5 || cancelled[4] != 6 {
+			t.Fatalf("expected the 4 working orders cancelled with their open sizes, got %v", cancelled)
+		}
+		if last := events[len(events)-1]; last.eventType != MASS_CANCEL_EVENT || last.trader != 1 || last.size != 4 {
+			t.Fatalf("expected a MASS_CANCEL_EVENT summary of 4, got %+v", last)
+		}
+
+		if bids, _ := eng.Depth(1, 10); len(bids) != 0 {
+			t.Fatalf("expected trader 1's bid gone, got %v", bids)
+		}
+		if _, asks := eng.Depth(1, 10); len(asks) != 1 || asks[0].size != 5 {
+			t.Fatalf("expected trader 2's ask to remain, got %v", asks)
+		}
+		if len(eng.books[3].buyStops) != 0 {
+			t.Fatalf("expected the pending stop cancelled")
+		}
+	}
+}
+
+func TestCancelAll_IdempotentThroughInputRing(t *testing.T) {
+	e := newTestEngine()
+	limit(e, 1, Bid, 100, 5, 1, GTC)
+	drainOutputEvents(e)
+
+	for _, want := range []Size{1, 0} {
+		e.dispatch(&InputCommand{eventType: MASS_CANCEL_EVENT, trader: 1})
+		events := drainOutputEvents(e)
+		if last := events[len(events)-1]; last.eventType != MASS_CANCEL_EVENT || last.size != want || len(events) != int(want)+1 {
+			t.Fatalf("expected %d cancels and a summary, got %+v", want, events)
+		}
+	}
+
+	// The slot is reused by a new order, which is tracked afresh
+	limit(e, 1, Bid, 100, 5, 1, GTC)
+	drainOutputEvents(e)
+	e.CancelAll(1)
+	if events := drainOutputEvents(e); len(events) != 2 || events[0].eventType != CANCEL_EVENT {
+		t.Fatalf("expected the new order cancelled, got %+v", events)
+	}
+}
+
+func TestCancelSymbol_ClearsBook(t *testing.T) {
+	e := newTestEngine()
+
+	limit(e, 1, Bid, 100, 5, 1, GTC)
+	limit(e, 1, Bid, 100, 3, 2, GTC)
+	limit(e, 1, Bid, 90, 4, 1, GTC)
+	limit(e, 1, Ask, 110, 2, 2, GTC)
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 120, size: 10, peakSize: 4, trader: 1})
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 131, stopPrice: 130, size: 5, trader: 2})
+	limit(e, 2, Bid, 100, 7, 1, GTC) // Another symbol is untouched
+	drainOutputEvents(e)
+
+	e.CancelSymbol(1)
+
+	events := takerEvents(drainOutputEvents(e))
+	var prices []Price
+	var total Size
+	for _, ev := range events {
+		if ev.eventType != CANCEL_EVENT || ev.symbol != 1 {
+			t.Fatalf("expected only CANCEL_EVENTs for symbol 1, got %+v", ev)
+		}
+		if exists, _, _, _, _ := e.OrderStatus(ev.orderID); exists {
+			t.Fatalf("expected cancelled order %d to be gone", ev.orderID)
+		}
+		prices = append(prices, ev.price)
+		total += ev.size
+	}
+	if got := fmt.Sprint(prices); got != "[100 100 90 110 120 131]" || total != 29 {
+		t.Fatalf("expected cancels best bid first, then best ask first, then stops, totalling 29; got %s totalling %d", got, total)
+	}
+
+	book := &e.books[1]
+	if book.bidMax != 0 || book.askMin != DEFAULT_PRICE_LEVELS || len(book.buyStops) != 0 {
+		t.Fatalf("expected an empty book with sentinel best prices, got bidMax %d askMin %d", book.bidMax, book.askMin)
+	}
+	if bids, asks := e.Depth(1, 10); len(bids) != 0 || len(asks) != 0 {
+		t.Fatalf("expected no depth, got %v %v", bids, asks)
+	}
+
+	// Trader 1 is left with only its symbol 2 order, and the cleared book trades normally again
+	e.CancelAll(1)
+	if events := takerEvents(drainOutputEvents(e)); len(events) != 2 || events[0].symbol != 2 {
+		t.Fatalf("expected only the symbol 2 order left for trader 1, got %+v", events)
+	}
+	limit(e, 1, Ask, 100, 5, 3, GTC)
+	limit(e, 1, Bid, 100, 5, 4, GTC)
+	if events := takerEvents(drainOutputEvents(e)); len(events) != 4 || events[3].eventType != EXECUTION_EVENT {
+		t.Fatalf("expected a fresh match on the cleared book, got %+v", events)
+	}
+}
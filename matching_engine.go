@@ -1,90 +1,1063 @@
 package main
 
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
 const (
-	MAX_SYMBOLS      = 1 << 8  // 256 trading symbols
-	MAX_PRICE_LEVELS = 1 << 14 // 16,384 price ticks
+	MAX_SYMBOLS          = 1 << 8  // 256 trading symbols
+	DEFAULT_PRICE_LEVELS = 1 << 14 // 16,384 price ticks per book unless configured (see EngineConfig)
+	MAX_PRICE_LEVELS     = 1 << 24 // 16,777,216 price ticks, the most per book
+	MAX_TRADERS          = 1 << 16 // Every possible TraderID
 
 	SLOT_BITS = 26
 	SLOT_MASK = (1 << SLOT_BITS) - 1
 
 	MAX_ORDERS = 1 << SLOT_BITS // 67M total orders
+
+	SHARD_SHIFT = SLOT_BITS + 32          // OrderID bits above the slot and 32-bit generation hold the shard
+	MAX_SHARDS  = 1 << (64 - SHARD_SHIFT) // 64 engines in a ShardedEngine
+)
+
+// Self-trade prevention policies, applied when an incoming order meets a resting order from the same trader
+type STPMode uint8
+
+const (
+	STP_NONE             STPMode = iota // Allow self-trades (default)
+	STP_CANCEL_RESTING                  // Cancel the resting order and keep matching
+	STP_CANCEL_NEWEST                   // Stop matching and cancel the incoming order's remainder (earlier fills stand)
+	STP_REJECT_AGGRESSOR                // Reject the incoming order outright, before any execution
+)
+
+// Allocation of an incoming order across the resting orders at a price level
+type MatchMode uint8
+
+const (
+	FIFO     MatchMode = iota // Strict price-time priority (default)
+	PRO_RATA                  // Proportional to resting size within each price level
+	LIFO                      // Newest order first within each price level, for simulation studies (see OrderBook.add)
 )
 
 type MatchingEngine struct {
-	books [MAX_SYMBOLS]OrderBook
-	pool  *OrderPool
+	books       [MAX_SYMBOLS]OrderBook
+	pool        *OrderPool
+	priceLevels Price // Price levels per side of every book; valid prices are 1..priceLevels-1
+	lockThreads bool  // Pin the distributors to OS threads (see EngineConfig)
+	volumeTrees bool  // Keep each book's volume trees (see EngineConfig)
+	cpus        []int // CPUs to bind the pinned distributors to (see EngineConfig)
+
+	stpMode   STPMode
+	matchMode MatchMode
+
+	tickSizes     [MAX_SYMBOLS]Price // Minimum price increment per symbol (defaults to 1)
+	minSizes      [MAX_SYMBOLS]Size  // Smallest accepted order size per symbol (defaults to 1)
+	maxSizes      [MAX_SYMBOLS]Size  // Largest accepted order size per symbol (defaults to the full Size range)
+	priceDecimals [MAX_SYMBOLS]uint8 // Decimal places of a price unit per symbol, for text prices only (see SetPriceDecimals)
+
+	makerBps, takerBps int32       // Fee rates in basis points of notional (see SetFees)
+	levelUpdates       bool        // Emit a LEVEL_UPDATE per change in a level's volume (see SetLevelUpdates)
+	fillSummaries      bool        // Emit an AGG_FILL_EVENT after matching each aggressive order (see SetFillSummaries)
+	summary            fillSummary // Fills so far of the order being matched, while fillSummaries is on
+
+	bandBps         [MAX_SYMBOLS]uint32 // Price band half-width per symbol in basis points (0 disables)
+	referencePrices [MAX_SYMBOLS]Price  // Band reference price per symbol (0 falls back to the last trade)
+
+	positions [MAX_SYMBOLS]map[TraderID]int64 // Net position per symbol and trader (buys positive)
+	halted    [MAX_SYMBOLS]bool               // Symbols halted for trading (see Halt)
+	disabled  [MAX_TRADERS / 64]uint64        // Bitset of traders stopped by the kill switch (see Disable)
+	auctions  [MAX_SYMBOLS]bool               // Symbols in a call auction (see StartAuction)
+
+	symbols symbolRegistry // Ticker names (see RegisterSymbol)
+
+	expiries expiryHeap // Pending GTD expiries, soonest first
 
-	inputRing  *RingBuffer[InputCommand]
+	seq uint64 // Sequence number of the last write-ahead log record applied
+
+	shardID OrderID // This engine's shard number shifted to SHARD_SHIFT, stamped on every OrderID it issues
+
+	stats Stats // Activity counters (see Stats)
+
+	lastTradeID TradeID     // Counter behind each execution's trade id
+	onTrade     func(Trade) // Trade tape subscriber (see OnTrade)
+	subscribers fanOut      // Output event subscribers (see Subscribe)
+
+	groupCancels []OrderID // OCO orders to cancel once the current match is done (see groupExecuted)
+
+	sim *MatchingEngine // Scratch engine behind Simulate, built on first use
+
+	lastToken uint64   // Counter behind each Submit's and Query's correlation token (atomic)
+	waiters   sync.Map // Submit and Query callers awaiting their command, by token
+
+	inputRing  *MPSCRingBuffer[InputCommand] // Multi-producer: order flow and the expiry sweeper push concurrently
 	outputRing *RingBuffer[OutputEvent]
 }
 
+// Engine construction options. The zero value is the default configuration
+type EngineConfig struct {
+	// Price levels per side of every book, so valid prices are 1..priceLevels-1 (0 for the default,
+	// DEFAULT_PRICE_LEVELS; at most MAX_PRICE_LEVELS). Every book allocates two PriceLevels per tick
+	// up front, so an engine that only needs a few hundred ticks saves almost all of that memory. The
+	// levels are slices sized here rather than fixed arrays inside each book, which costs a pointer
+	// load and a bounds check per level access; the default engine pays that too, but keeps the same
+	// dense indexing by price.
+	//
+	// A wide range, for instruments quoted in cents over thousands of units, costs 24 bytes plus a
+	// bitmap bit per tick and book: about 400MB per book at MAX_PRICE_LEVELS, so 100GB for a dense
+	// engine. Pair it with sparseBooks so only the symbols that trade pay. The best price stays a
+	// couple of bit scans away, except that a side emptying its best level searches the bitmap's
+	// summary word by word, 4,096 words across the full range
+	priceLevels Price
+
+	// Order slots in the engine's pool, so it holds up to maxOrders-1 working orders at once (0 for
+	// the default, MAX_ORDERS; at least 2 and at most MAX_ORDERS). The pool is allocated up front at
+	// 64 bytes per slot, about 4GB at MAX_ORDERS, though the OS only commits the pages orders have
+	// touched. An engine that never holds more than a few thousand orders, or one of many in a
+	// process, can reserve far less. Like the price levels, the pool is a slice sized here, at the
+	// cost of a bounds check per slot access
+	maxOrders Slot
+
+	// Allocate each book's price levels on the symbol's first order rather than up front, for
+	// deployments trading few of the MAX_SYMBOLS symbols. Until then the book shares one empty,
+	// read-only set of levels, so every lookup works on it unchanged and matching on a book that
+	// exists stays allocation-free; the first order (or restore) for a symbol pays the allocation
+	sparseBooks bool
+
+	// Keep a segment tree of the visible volume at each price on both sides of every book, so
+	// VolumeBetween is a range query costing O(log priceLevels) rather than a walk over the levels in
+	// range. Every change to a level's volume then updates log2(priceLevels) tree nodes, and each
+	// book allocates 16 bytes per tick and side on top of its levels (512KB at DEFAULT_PRICE_LEVELS),
+	// so it is off by default. The best prices are still found with the bitmaps, which are faster
+	volumeTrees bool
+
+	// Lock the input and output distributors each to an OS thread of its own for as long as they
+	// run (runtime.LockOSThread), so the Go scheduler never moves the matching loop or the output
+	// consumer to another thread or runs other goroutines on theirs. This trades two dedicated
+	// threads for steadier latency, so it is off by default (and in tests)
+	lockThreads bool
+
+	// CPUs to bind the locked distributor threads to: the input distributor's at INPUT_THREAD and
+	// the output distributor's at OUTPUT_THREAD, either or both left unbound if the slice is shorter.
+	// Binding stops the OS migrating a thread between cores as well. Only applied on Linux (through
+	// sched_setaffinity) and only with lockThreads; elsewhere the threads are locked but unbound.
+	// Isolating the CPUs from other work (eg. isolcpus) is up to the deployment
+	cpus []int
+}
+
 func NewMatchingEngine() *MatchingEngine {
+	return NewMatchingEngineWithConfig(EngineConfig{})
+}
+
+// NewMatchingEngineWithConfig builds an engine with non-default options (see EngineConfig). It
+// panics if the price levels are outside 2..MAX_PRICE_LEVELS, or a CPU is outside 0..CPU_SET_SIZE-1
+func NewMatchingEngineWithConfig(config EngineConfig) *MatchingEngine {
+	if config.priceLevels == 0 {
+		config.priceLevels = DEFAULT_PRICE_LEVELS
+	}
+	if config.priceLevels < 2 || config.priceLevels > MAX_PRICE_LEVELS {
+		panic(fmt.Sprintf("price levels %d outside 2..%d", config.priceLevels, MAX_PRICE_LEVELS))
+	}
+	if config.maxOrders == 0 {
+		config.maxOrders = MAX_ORDERS
+	}
+	if config.maxOrders < 2 || config.maxOrders > MAX_ORDERS {
+		panic(fmt.Sprintf("max orders %d outside 2..%d", config.maxOrders, MAX_ORDERS))
+	}
+	for _, cpu := range config.cpus {
+		if cpu < 0 || cpu >= CPU_SET_SIZE {
+			panic(fmt.Sprintf("cpu %d outside 0..%d", cpu, CPU_SET_SIZE-1))
+		}
+	}
+
 	e := &MatchingEngine{
-		pool:       NewOrderPool(),
-		inputRing:  NewRingBuffer[InputCommand](),
-		outputRing: NewRingBuffer[OutputEvent](),
+		pool:        NewOrderPool(config.maxOrders),
+		priceLevels: config.priceLevels,
+		lockThreads: config.lockThreads,
+		volumeTrees: config.volumeTrees,
+		cpus:        config.cpus,
+		inputRing:   NewMPSCRingBuffer[InputCommand](RING_SIZE),
+		outputRing:  NewRingBuffer[OutputEvent](RING_SIZE),
 	}
 
 	// Initialize order books for each symbol
+	empty := OrderBook{volumeTrees: config.volumeTrees}
+	if config.sparseBooks {
+		empty.init(config.priceLevels)
+	}
 	for i := range e.books {
-		e.books[i] = OrderBook{askMin: MAX_PRICE_LEVELS, bidMax: 0}
+		if config.sparseBooks {
+			e.books[i] = empty
+			e.books[i].shared = true
+		} else {
+			e.books[i].volumeTrees = config.volumeTrees
+			e.books[i].init(config.priceLevels)
+		}
+		e.positions[i] = make(map[TraderID]int64)
+		e.tickSizes[i] = 1
+		e.minSizes[i], e.maxSizes[i] = 1, math.MaxUint32
 	}
 	return e
 }
 
+// Select the self-trade prevention policy applied when matching
+func (e *MatchingEngine) SetSTPMode(mode STPMode) {
+	e.stpMode = mode
+}
+
+// Select how an incoming order is allocated across the resting orders at each price level
+func (e *MatchingEngine) SetMatchMode(mode MatchMode) {
+	e.matchMode = mode
+}
+
+// Set the minimum price increment for a symbol (a tick size of 0 is ignored)
+func (e *MatchingEngine) SetTickSize(symbol Symbol, tick Price) {
+	if symbol < MAX_SYMBOLS && tick > 0 {
+		e.tickSizes[symbol] = tick
+	}
+}
+
+// Set the smallest and largest order size accepted for a symbol
+func (e *MatchingEngine) SetSizeLimits(symbol Symbol, min, max Size) {
+	if symbol < MAX_SYMBOLS {
+		e.minSizes[symbol], e.maxSizes[symbol] = min, max
+	}
+}
+
+// Report whether price is a whole number of ticks for the symbol
+func (e *MatchingEngine) validTick(symbol Symbol, price Price) bool {
+	return price%e.tickSizes[symbol] == 0
+}
+
 // Add a new limit order to the order book
-func (e *MatchingEngine) Limit(symbol Symbol, side Side, price Price, size Size, trader TraderID) {
-	if price == 0 || size == 0 || price >= MAX_PRICE_LEVELS || symbol >= MAX_SYMBOLS {
-		e.outputRing.Push(OutputEvent{eventType: REJECT_EVENT, orderID: 0, trader: trader})
-		return
+func (e *MatchingEngine) Limit(symbol Symbol, side Side, price Price, size Size, trader TraderID, tif TimeInForce) {
+	e.LimitCommand(&InputCommand{symbol: symbol, side: side, price: price, size: size, trader: trader, tif: tif})
+}
+
+// Add a new limit order described by a full command, including the optional order flags (post-only,
+// iceberg peak, reduce-only, GTD expiry), or a dormant stop-limit order if cmd.stopPrice is set (or a
+// trailing one if cmd.trailOffset is)
+func (e *MatchingEngine) LimitCommand(cmd *InputCommand) {
+	e.limitCommand(cmd)
+}
+
+// Validate and submit a limit order, returning its new ID, or 0 and the reason it was rejected
+func (e *MatchingEngine) limitCommand(cmd *InputCommand) (OrderID, RejectReason) {
+	var adjusted InputCommand
+	admitted, reason := e.admitLimit(cmd, nil, &adjusted)
+	if admitted == nil {
+		return 0, e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: 0, clOrdID: cmd.clOrdID, trader: cmd.trader, reason: reason})
+	}
+	return e.accept(admitted)
+}
+
+// Check a new limit order's price, then everything else admit checks
+func (e *MatchingEngine) admitLimit(cmd *InputCommand, except *Order, adjusted *InputCommand) (*InputCommand, RejectReason) {
+	if cmd.price == 0 || cmd.price >= e.priceLevels {
+		return nil, REJECT_INVALID_PRICE
+	}
+	if cmd.symbol < MAX_SYMBOLS && !e.validTick(cmd.symbol, cmd.price) {
+		return nil, REJECT_INVALID_TICK
+	}
+	if cmd.symbol < MAX_SYMBOLS && !e.withinBand(cmd.symbol, cmd.price) {
+		return nil, REJECT_PRICE_BAND
 	}
+	return e.admit(cmd, except, adjusted)
+}
+
+// Execute a market order against the best available prices, cancelling any unfilled remainder
+// (or add a dormant stop-market order if cmd.stopPrice is set). cmd.price is ignored
+func (e *MatchingEngine) Market(cmd *InputCommand) {
+	e.marketCommand(cmd)
+}
+
+// Submit a market order, returning its new ID, or 0 and the reason it was rejected
+func (e *MatchingEngine) marketCommand(cmd *InputCommand) (OrderID, RejectReason) {
+	market := *cmd
+	market.price = 0 // Internally, a zero price marks a market order
+	return e.submit(&market)
+}
+
+// Validate and accept a new order, then either match it or hold it as a pending stop. Returns the new
+// order's ID, or 0 and the reason it was rejected
+func (e *MatchingEngine) submit(cmd *InputCommand) (OrderID, RejectReason) {
+	var adjusted InputCommand
+	admitted, reason := e.admit(cmd, nil, &adjusted)
+	if admitted == nil {
+		return 0, e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: 0, clOrdID: cmd.clOrdID, trader: cmd.trader, reason: reason})
+	}
+	return e.accept(admitted)
+}
+
+// Check a new order against everything that would reject it on entry, without emitting anything.
+// Returns the order as it would be accepted: cmd itself, or a copy in adjusted with a trailing stop's
+// start or a reduce-only cut filled in. Otherwise returns nil and the reason it would be rejected. The
+// book checks pass over except, a resting order about to be cancelled in the new one's favour (see
+// Replace), unless it is nil
+func (e *MatchingEngine) admit(cmd *InputCommand, except *Order, adjusted *InputCommand) (*InputCommand, RejectReason) {
+	symbol, side, size, trader, tif := cmd.symbol, cmd.side, cmd.size, cmd.trader, cmd.tif
+
+	if symbol >= MAX_SYMBOLS {
+		return nil, REJECT_UNKNOWN_SYMBOL
+	}
+	if side != Bid && side != Ask {
+		return nil, REJECT_INVALID_SIDE
+	}
+	if cmd.trailOffset >= e.priceLevels {
+		return nil, REJECT_INVALID_PRICE
+	}
+	// A trailing stop entered without a stopPrice starts trailOffset behind the last trade
+	if cmd.trailOffset != 0 && cmd.stopPrice == 0 {
+		*adjusted = *cmd
+		adjusted.stopPrice = e.books[symbol].trailStart(side, cmd.trailOffset)
+		cmd = adjusted
+		if cmd.stopPrice == 0 {
+			return nil, REJECT_INVALID_PRICE
+		}
+	}
+	if cmd.stopPrice >= e.priceLevels {
+		return nil, REJECT_INVALID_PRICE
+	}
+	if tif == GTD && cmd.expiresAt == 0 {
+		return nil, REJECT_INVALID_EXPIRY
+	}
+	if size == 0 || size < e.minSizes[symbol] || size > e.maxSizes[symbol] {
+		return nil, REJECT_INVALID_SIZE
+	}
+	if e.halted[symbol] {
+		return nil, REJECT_HALTED
+	}
+	if e.isDisabled(trader) {
+		return nil, REJECT_TRADER_DISABLED
+	}
+
+	// Reduce-only orders are truncated to what brings the trader flat, and rejected if already flat
+	// or on the wrong side. The position is read as the order is accepted: commands are processed
+	// sequentially, so no fills are in flight at that point, but a resting reduce-only remainder is
+	// not re-checked if later fills change the position (resting reduce-only orders can overshoot flat)
+	if cmd.reduceOnly {
+		if size = e.reducibleSize(symbol, side, size, trader); size == 0 {
+			return nil, REJECT_REDUCE_ONLY
+		}
+		if size != cmd.size {
+			*adjusted = *cmd
+			adjusted.size = size
+			cmd = adjusted
+		}
+	}
+
+	book := &e.books[symbol]
+	book.allocate()
+	bound := book.limitPrice(side, cmd.price)
+
+	// A call auction only collects resting orders, so anything that must trade (or must not) on entry is refused
+	if e.auctions[symbol] && cmd.stopPrice == 0 && (cmd.price == 0 || tif == IOC || tif == FOK || cmd.postOnly) {
+		return nil, REJECT_AUCTION
+	}
+
+	// Pre-trade checks only apply to orders that trade on entry (stops are checked when they trigger)
+	if cmd.stopPrice == 0 && !e.auctions[symbol] {
+		if tif == FOK && !e.canFill(book, side, bound, size, trader, except) {
+			return nil, REJECT_FOK_UNFILLABLE
+		}
+
+		if e.stpMode == STP_REJECT_AGGRESSOR && e.wouldSelfTrade(book, side, bound, size, trader, except) {
+			return nil, REJECT_SELF_TRADE
+		}
+
+		// Post-only orders must add liquidity, so reject any that would execute on entry
+		if cmd.postOnly && e.wouldCross(book, side, bound, except) {
+			return nil, REJECT_POST_ONLY_CROSS
+		}
+	}
+	return cmd, REJECT_UNSPECIFIED
+}
+
+// Accept an order admit has passed, then either match it or hold it as a pending stop. Returns the
+// new order's ID, or 0 and REJECT_POOL_EXHAUSTED if there is no slot for it
+func (e *MatchingEngine) accept(cmd *InputCommand) (OrderID, RejectReason) {
+	symbol, side, size, trader, tif := cmd.symbol, cmd.side, cmd.size, cmd.trader, cmd.tif
+	book := &e.books[symbol]
 
 	// Allocate a new order slot and generate a unique order ID
-	slot, gen := e.pool.alloc()
-	newOrderID := OrderID(uint64(gen)<<SLOT_BITS | uint64(slot))
+	slot, gen, ok := e.pool.alloc()
+	if !ok {
+		return 0, e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: 0, clOrdID: cmd.clOrdID, trader: trader, reason: REJECT_POOL_EXHAUSTED})
+	}
+	newOrderID := e.shardID | OrderID(uint64(gen)<<SLOT_BITS|uint64(slot))
+	e.pool.track(slot, trader)
+	e.pool.tag(slot, cmd.clOrdID)
+	if cmd.groupID != 0 {
+		e.pool.group(slot, cmd.groupID)
+	}
 
+	atomic.AddUint64(&e.stats.accepted, 1)
 	e.outputRing.Push(OutputEvent{
 		eventType: ORDER_EVENT,
 		orderID:   newOrderID,
-		price:     price,
+		clOrdID:   cmd.clOrdID,
+		price:     cmd.price,
 		size:      size,
 		trader:    trader,
 		symbol:    symbol,
 		side:      side,
 	})
 
-	book := &e.books[symbol]
+	if tif == GTD {
+		heap.Push(&e.expiries, expiry{expiresAt: cmd.expiresAt, id: newOrderID})
+	}
+
+	if cmd.stopPrice != 0 {
+		e.addStop(book, cmd, slot, newOrderID)
+	} else {
+		e.place(book, cmd, slot, newOrderID)
+	}
+	e.triggerStops(book)
+	return newOrderID, REJECT_UNSPECIFIED
+}
+
+// Position returns a trader's net position in a symbol: positive when long (bought more than sold),
+// negative when short. Both sides of every fill move by the same size, so positions in a symbol sum
+// to zero. Must run on the matching thread (or while it is idle), like Depth
+func (e *MatchingEngine) Position(trader TraderID, symbol Symbol) int64 {
+	if symbol >= MAX_SYMBOLS {
+		return 0
+	}
+	return e.positions[symbol][trader]
+}
+
+// Largest size (up to size) a reduce-only order can have without growing or flipping the trader's position
+func (e *MatchingEngine) reducibleSize(symbol Symbol, side Side, size Size, trader TraderID) Size {
+	position := e.positions[symbol][trader]
+	if side == Bid && position < 0 {
+		return Size(min(-position, int64(size)))
+	}
+	if side == Ask && position > 0 {
+		return Size(min(position, int64(size)))
+	}
+	return 0
+}
 
-	remaining := book.match(e.pool, e.outputRing, size, symbol, side, price, trader, newOrderID)
+// Match an accepted order, then rest, cancel or free whatever remains of it
+func (e *MatchingEngine) place(book *OrderBook, cmd *InputCommand, slot Slot, id OrderID) {
+	symbol, side, price, size, trader, tif := cmd.symbol, cmd.side, cmd.price, cmd.size, cmd.trader, cmd.tif
 
-	if remaining > 0 {
-		book.add(e.pool, side, price, newOrderID, slot, remaining, symbol)
+	remaining, selfTrade := size, false
+	if !e.auctions[symbol] { // Orders just rest during a call auction
+		remaining, selfTrade = e.match(book, size, symbol, side, book.limitPrice(side, price), trader, id)
+	}
+
+	if remaining > 0 && (tif == IOC || tif == FOK || selfTrade || price == 0) {
+		e.cancelRemainder(slot, id, symbol, side, price, remaining, trader)
+	} else if remaining > 0 {
+		order := e.pool.get(slot)
+		order.filled, order.peak = size-remaining, cmd.peakSize
+		if cmd.reduceOnly {
+			order.flags |= FLAG_REDUCE_ONLY
+		}
+
+		visible, reserve := order.split(remaining)
+		before := book.level(side, price).volume
+		book.add(e.pool, side, price, id, slot, visible, symbol, trader, e.matchMode == LIFO)
+		e.checkUncrossed(book, symbol)
+		order.reserve = reserve
+		e.outputRing.Push(OutputEvent{eventType: RESTED_EVENT, orderID: id, clOrdID: order.clOrdID, price: price, size: visible, trader: trader, symbol: symbol, side: side})
+		e.levelChanged(symbol, side, price, before)
 	} else {
 		e.pool.free(slot) // Free the slot if the order was fully matched
 	}
 }
 
-func (e *MatchingEngine) Cancel(id OrderID) {
+// Price bound used when matching: a market order (zero price) accepts any price on the opposite side
+func (book *OrderBook) limitPrice(side Side, price Price) Price {
+	if price != 0 {
+		return price
+	}
+	if side == Bid {
+		return book.priceLevels() - 1
+	}
+	return 1
+}
+
+// Match an incoming order against the opposite side, returning the unfilled size and whether
+// matching was stopped by self-trade prevention (in which case the remainder must not rest)
+func (e *MatchingEngine) match(book *OrderBook, size Size, symbol Symbol, side Side, price Price, trader TraderID, id OrderID) (Size, bool) {
+	remaining := size
+	selfTrade := false
+	if e.fillSummaries {
+		e.summary = fillSummary{}
+	}
+
+	if side == Bid {
+		for remaining > 0 && !selfTrade && book.askMin < book.priceLevels() && book.askMin <= price {
+			remaining, selfTrade = e.matchAt(book, &book.askLevels[book.askMin], remaining, book.askMin, symbol, trader, id)
+			if book.askLevels[book.askMin].headSlot == 0 {
+				book.updateAskMin()
+			}
+		}
+	} else {
+		for remaining > 0 && !selfTrade && book.bidMax > 0 && book.bidMax >= price {
+			remaining, selfTrade = e.matchAt(book, &book.bidLevels[book.bidMax], remaining, book.bidMax, symbol, trader, id)
+			if book.bidLevels[book.bidMax].headSlot == 0 {
+				book.updateBidMax()
+			}
+		}
+	}
+	e.summarizeFills(symbol, side, trader, id)
+	return remaining, selfTrade
+}
+
+// Match against a single price level using the engine's match mode
+func (e *MatchingEngine) matchAt(book *OrderBook, level *PriceLevel, remaining Size, price Price, symbol Symbol, trader TraderID, id OrderID) (Size, bool) {
+	if e.matchMode == PRO_RATA {
+		return e.matchLevelProRata(book, level, remaining, price, symbol, trader, id)
+	}
+	return e.matchLevel(book, level, remaining, price, symbol, trader, id)
+}
+
+func (e *MatchingEngine) matchLevel(book *OrderBook, level *PriceLevel, remaining Size, price Price, symbol Symbol, trader TraderID, id OrderID) (Size, bool) {
+	for counterSlot := level.headSlot; counterSlot != 0 && remaining > 0; {
+		counterOrder := e.pool.get(counterSlot)
+		nextCounterSlot := counterOrder.nextSlot
+
+		if e.stpMode != STP_NONE && counterOrder.trader == trader {
+			if e.stpMode != STP_CANCEL_RESTING {
+				return remaining, true
+			}
+
+			// Cancel the resting order and carry on down the queue
+			side, before := counterOrder.side, level.volume
+			e.emitCancel(OutputEvent{
+				eventType: CANCEL_EVENT,
+				orderID:   counterOrder.id,
+				clOrdID:   counterOrder.clOrdID,
+				price:     price,
+				size:      counterOrder.size + counterOrder.reserve,
+				trader:    counterOrder.trader,
+				symbol:    symbol,
+				side:      counterOrder.side,
+			})
+			level.remove(e.pool, counterSlot)
+			e.levelChanged(symbol, side, price, before)
+			counterSlot = nextCounterSlot
+			continue
+		}
+
+		fillSize := min(remaining, counterOrder.size)
+		e.fill(book, level, counterSlot, fillSize, price, symbol, trader, id)
+
+		remaining -= fillSize
+		counterSlot = nextCounterSlot
+	}
+	return remaining, false
+}
+
+// Execute fillSize of a resting order against an incoming order, removing the resting order
+// once it is exhausted (or re-queuing an iceberg with a replenished peak). Each fill is reported
+// twice under the same trade id: first to the taker, then to the resting maker (flagged maker),
+// with the order and counterparty fields swapped, so both traders get a fill report even when the
+// resting order is only partly consumed
+func (e *MatchingEngine) fill(book *OrderBook, level *PriceLevel, counterSlot Slot, fillSize Size, price Price, symbol Symbol, trader TraderID, id OrderID) {
+	counterOrder := e.pool.get(counterSlot)
+
+	e.lastTradeID++
+	tradeID := TradeID(e.shardID) | e.lastTradeID
+	takerFee, makerFee := fee(price, fillSize, e.takerBps), fee(price, fillSize, e.makerBps)
+	if e.fillSummaries {
+		e.summary.add(price, fillSize, takerFee)
+	}
+	e.outputRing.Push(OutputEvent{
+		eventType:      EXECUTION_EVENT,
+		orderID:        id,
+		counterOrderID: counterOrder.id,
+		tradeID:        tradeID,
+		clOrdID:        e.pool.get(Slot(id & SLOT_MASK)).clOrdID, // The taker's slot stays allocated while it matches
+		price:          price,
+		size:           fillSize,
+		trader:         trader,
+		counterTrader:  counterOrder.trader,
+		fee:            takerFee,
+		counterFee:     makerFee,
+		symbol:         symbol,
+		side:           1 - counterOrder.side, // The aggressor takes the other side of the resting order
+	})
+	e.outputRing.Push(OutputEvent{
+		eventType:      EXECUTION_EVENT,
+		orderID:        counterOrder.id,
+		counterOrderID: id,
+		tradeID:        tradeID,
+		clOrdID:        counterOrder.clOrdID,
+		price:          price,
+		size:           fillSize,
+		trader:         counterOrder.trader,
+		counterTrader:  trader,
+		fee:            makerFee,
+		counterFee:     takerFee,
+		symbol:         symbol,
+		side:           counterOrder.side,
+		maker:          true,
+	})
+
+	book.lastPrice, book.lastSize = price, fillSize
+	book.trail(price)
+	atomic.AddUint64(&e.stats.trades, 1)
+	atomic.AddUint64(&e.stats.volume, uint64(fillSize))
+
+	// Update net positions: the aggressor trades against the resting order's side
+	delta := int64(fillSize)
+	if counterOrder.side == Bid {
+		delta = -delta
+	}
+	e.positions[symbol][trader] += delta
+	e.positions[symbol][counterOrder.trader] -= delta
+
+	if taker := Slot(id & SLOT_MASK); e.pool.get(taker).flags&FLAG_OCO != 0 {
+		e.groupExecuted(taker)
+	}
+	if counterOrder.flags&FLAG_OCO != 0 {
+		e.groupExecuted(counterSlot)
+	}
+	e.reduceResting(level, counterSlot, fillSize)
+}
+
+// Take an executed quantity off a resting order, replenishing an iceberg or freeing a filled order
+func (e *MatchingEngine) reduceResting(level *PriceLevel, slot Slot, fillSize Size) {
+	order := e.pool.get(slot)
+	symbol, side, price, before := order.symbol, order.side, order.price, level.volume
+	order.size -= fillSize
+	order.filled += fillSize
+	level.volume -= fillSize
+
+	if order.size == 0 && order.reserve > 0 {
+		// Replenish an iceberg's visible peak from its reserve, re-queuing it at the back
+		level.unlink(e.pool, slot)
+		order.size, order.reserve = order.split(order.reserve)
+		level.pushBack(e.pool, slot)
+	} else if order.size == 0 {
+		level.remove(e.pool, slot)
+	}
+	e.levelChanged(symbol, side, price, before)
+}
+
+// Cancel the unfilled remainder of an incoming order instead of resting it
+func (e *MatchingEngine) cancelRemainder(slot Slot, id OrderID, symbol Symbol, side Side, price Price, remaining Size, trader TraderID) {
+	clOrdID := e.pool.get(slot).clOrdID
+	e.pool.free(slot)
+	e.emitCancel(OutputEvent{
+		eventType: CANCEL_EVENT,
+		orderID:   id,
+		clOrdID:   clOrdID,
+		price:     price,
+		size:      remaining,
+		trader:    trader,
+		symbol:    symbol,
+		side:      side,
+	})
+}
+
+// Visit the resting orders an incoming order could match, in price-time priority, until visit
+// returns false. Walks the same price bounds as match, but only reads the book
+func (e *MatchingEngine) walkCrossing(book *OrderBook, side Side, price Price, visit func(order *Order) bool) {
+	if side == Bid {
+		for p := book.askMin; p < book.priceLevels() && p <= price; p++ {
+			if !e.walkLevel(&book.askLevels[p], visit) {
+				return
+			}
+		}
+	} else {
+		for p := book.bidMax; p > 0 && p >= price; p-- {
+			if !e.walkLevel(&book.bidLevels[p], visit) {
+				return
+			}
+		}
+	}
+}
+
+func (e *MatchingEngine) walkLevel(level *PriceLevel, visit func(order *Order) bool) bool {
+	for slot := level.headSlot; slot != 0; {
+		order := e.pool.get(slot)
+		if !visit(order) {
+			return false
+		}
+		slot = order.nextSlot
+	}
+	return true
+}
+
+// Check whether the opposite side holds enough volume at acceptable prices to fill size completely
+// (without unlinking anything). Under self-trade prevention the trader's own resting orders never
+// fill: they are skipped when matching would cancel them, and otherwise end the fill there. The order
+// except (if any) is passed over, as it will be gone before matching
+func (e *MatchingEngine) canFill(book *OrderBook, side Side, price Price, size Size, trader TraderID, except *Order) bool {
+	remaining := size
+	e.walkCrossing(book, side, price, func(order *Order) bool {
+		if order == except {
+			return true
+		}
+		if e.stpMode != STP_NONE && order.trader == trader {
+			return e.stpMode == STP_CANCEL_RESTING
+		}
+		remaining -= min(remaining, order.size+order.reserve)
+		return remaining > 0
+	})
+	return remaining == 0
+}
+
+// Check whether an incoming order would meet one of the trader's own resting orders (other than
+// except, if any) before being filled
+func (e *MatchingEngine) wouldSelfTrade(book *OrderBook, side Side, price Price, size Size, trader TraderID, except *Order) bool {
+	remaining := size
+	selfTrade := false
+	e.walkCrossing(book, side, price, func(order *Order) bool {
+		if order == except {
+			return true
+		}
+		if order.trader == trader {
+			selfTrade = true
+			return false
+		}
+		remaining -= min(remaining, order.size+order.reserve)
+		return remaining > 0
+	})
+	return selfTrade
+}
+
+// Check whether an incoming order would execute on entry against a resting order other than except
+// (if any). Without except this is book.crosses; with it, the crossing orders are walked until one
+// other than except is found
+func (e *MatchingEngine) wouldCross(book *OrderBook, side Side, price Price, except *Order) bool {
+	if !book.crosses(side, price) {
+		return false
+	}
+	if except == nil {
+		return true
+	}
+	crosses := false
+	e.walkCrossing(book, side, price, func(order *Order) bool {
+		crosses = order != except
+		return !crosses
+	})
+	return crosses
+}
+
+// Cancel one of trader's working orders. Only the trader who placed an order may cancel it; a
+// cancel naming another trader's order is rejected with REJECT_NOT_OWNER and leaves it working
+func (e *MatchingEngine) Cancel(id OrderID, trader TraderID) {
+	e.cancelCommand(id, trader)
+}
+
+// Cancel an order on behalf of trader and report the outcome as an event, returning false and the
+// reason if it was rejected
+func (e *MatchingEngine) cancelCommand(id OrderID, trader TraderID) (bool, RejectReason) {
+	order := e.working(id)
+	if order == nil {
+		return false, e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, trader: trader, reason: REJECT_UNKNOWN_ORDER})
+	}
+	if order.trader != trader {
+		return false, e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, trader: trader, reason: REJECT_NOT_OWNER})
+	}
+
+	ev := cancelEvent(order)
+	if !e.cancel(id) {
+		return false, e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, trader: trader, reason: REJECT_UNKNOWN_ORDER})
+	}
+	e.emitCancel(ev)
+	return true, REJECT_UNSPECIFIED
+}
+
+// Cancel a trader's working order by its client order ID (see InputCommand.clOrdID). If the trader
+// has reused the ID, the newest order given it is cancelled
+func (e *MatchingEngine) CancelByClOrdID(trader TraderID, clOrdID uint64) {
+	slot, ok := e.pool.lookup(trader, clOrdID)
+	if !ok {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, clOrdID: clOrdID, trader: trader, reason: REJECT_UNKNOWN_ORDER})
+		return
+	}
+	e.cancelCommand(e.pool.get(slot).id, trader)
+}
+
+// Cancel qty of one of trader's working orders, keeping its queue position (an iceberg's reserve is
+// drawn down before its visible peak). The CANCEL_EVENT reports the quantity cancelled, with prevSize
+// set to the open quantity before the cut. Cancelling the whole open quantity or more is a full
+// Cancel, freeing the order's slot
+func (e *MatchingEngine) CancelQty(id OrderID, qty Size, trader TraderID) {
+	order := e.working(id)
+	if order == nil {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, trader: trader, reason: REJECT_UNKNOWN_ORDER})
+		return
+	}
+	if order.trader != trader {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, trader: trader, reason: REJECT_NOT_OWNER})
+		return
+	}
+	if qty == 0 {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, trader: trader, reason: REJECT_INVALID_SIZE})
+		return
+	}
+
+	open := order.size + order.reserve
+	if qty >= open {
+		e.cancelCommand(id, trader)
+		return
+	}
+
+	ev := cancelEvent(order)
+	ev.size, ev.prevSize = qty, open
+	if qty <= order.reserve {
+		order.reserve -= qty
+	} else {
+		cut := qty - order.reserve
+		order.size -= cut
+		order.reserve = 0
+
+		// A pending stop is not in a level yet
+		if order.flags&FLAG_PENDING_STOP == 0 {
+			level := e.books[order.symbol].level(order.side, order.price)
+			before := level.volume
+			level.volume -= cut
+			e.levelChanged(order.symbol, order.side, order.price, before)
+		}
+	}
+	e.emitCancel(ev)
+}
+
+// Cancel an existing order and submit a replacement limit order in one step, so there is no window
+// where neither is live. The replacement is placed even if the old order is already gone, in which
+// case the REPLACE_EVENT is flagged with cancelFailed. Replacing another trader's working order is
+// rejected with REJECT_NOT_OWNER, and a replacement that would itself be rejected (for its price,
+// size, or any other new-order check) is rejected before the old order is touched, leaving it live
+func (e *MatchingEngine) Replace(oldID OrderID, symbol Symbol, side Side, price Price, size Size, trader TraderID, tif TimeInForce) {
+	e.ReplaceCommand(&InputCommand{orderID: oldID, symbol: symbol, side: side, price: price, size: size, trader: trader, tif: tif})
+}
+
+// Replace the order cmd.orderID with the limit order described by cmd (see Replace and LimitCommand)
+func (e *MatchingEngine) ReplaceCommand(cmd *InputCommand) {
+	old := e.working(cmd.orderID)
+	if old != nil && old.trader != cmd.trader {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: cmd.orderID, trader: cmd.trader, reason: REJECT_NOT_OWNER})
+		return
+	}
+
+	// Check the replacement as if the old order were already gone (a halted symbol and a disabled
+	// trader included), so it is only cancelled once the new one is known to be accepted
+	var adjusted InputCommand
+	admitted, reason := e.admitLimit(cmd, old, &adjusted)
+	if admitted == nil {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: cmd.orderID, clOrdID: cmd.clOrdID, trader: cmd.trader, reason: reason})
+		return
+	}
+	cancelled := e.cancel(cmd.orderID)
+
+	e.outputRing.Push(OutputEvent{
+		eventType:    REPLACE_EVENT,
+		orderID:      cmd.orderID,
+		trader:       cmd.trader,
+		symbol:       cmd.symbol,
+		side:         cmd.side,
+		cancelFailed: !cancelled,
+	})
+
+	e.accept(admitted)
+}
+
+// The working order (resting, or a pending stop) an ID names, or nil for unknown or stale IDs
+func (e *MatchingEngine) working(id OrderID) *Order {
 	// Extract the slot from the order ID
 	slot := Slot(id & SLOT_MASK)
 
 	if !e.pool.isValid(slot) {
-		e.outputRing.Push(OutputEvent{eventType: REJECT_EVENT, orderID: id})
+		return nil
+	}
+
+	order := e.pool.get(slot)
+
+	// Check if the order is valid (same generation and shard) and not already canceled
+	if order.id != id || order.size == 0 {
+		return nil
+	}
+	return order
+}
+
+// Remove a live order from the book and free its slot, reporting false for unknown or stale IDs.
+// A resting order not linked into the level its side and price name is also refused, leaving it
+// and the level untouched, rather than unlinking it from a queue it is not in
+func (e *MatchingEngine) cancel(id OrderID) bool {
+	order := e.working(id)
+	if order == nil {
+		return false
+	}
+	slot := Slot(id & SLOT_MASK)
+	book := &e.books[order.symbol]
+	if order.flags&FLAG_PENDING_STOP == 0 && !book.level(order.side, order.price).holds(e.pool, slot) {
+		return false
+	}
+
+	if order.flags&FLAG_PENDING_STOP != 0 {
+		book.removeStop(e.pool, slot)
+	} else {
+		symbol, side, price, before := order.symbol, order.side, order.price, book.level(order.side, order.price).volume
+		book.unlink(e.pool, slot)
+		e.levelChanged(symbol, side, price, before)
+	}
+	e.pool.free(slot)
+	return true
+}
+
+// Report whether an order is still working (resting, or a pending stop) and, if so, its open
+// quantity (visible plus any iceberg reserve), limit price (0 for a stop-market), symbol and side.
+// Filled, cancelled and never-issued IDs all report exists=false: a finished order's slot is freed
+// and its generation bumped, so once the slot is recycled the new occupant has a different ID and
+// the old ID stays unknown. Must run on the matching goroutine
+func (e *MatchingEngine) OrderStatus(id OrderID) (exists bool, remaining Size, price Price, symbol Symbol, side Side) {
+	order := e.working(id)
+	if order == nil {
+		return false, 0, 0, 0, 0
+	}
+	return true, order.size + order.reserve, order.price, order.symbol, order.side
+}
+
+// Report how many orders, and how much visible size, are queued ahead of a resting order at its
+// price level. ok is false unless the order is resting: filled, cancelled and never-issued IDs, and
+// pending stops (which are in no queue), all report false. An iceberg ahead counts only its shown
+// peak, as its reserve is requeued at the back of the level. Must run on the matching goroutine
+func (e *MatchingEngine) QueuePosition(id OrderID) (ordersAhead int, volumeAhead Size, ok bool) {
+	order := e.working(id)
+	if order == nil || order.flags&FLAG_PENDING_STOP != 0 {
+		return 0, 0, false
+	}
+	for slot := order.prevSlot; slot != 0; slot = e.pool.get(slot).prevSlot {
+		ordersAhead++
+		volumeAhead += e.pool.get(slot).size
+	}
+	return ordersAhead, volumeAhead, true
+}
+
+// Amend the price and/or total size (including any filled quantity) of a resting order.
+// Reducing the size at the same price keeps the order's queue position; a price change or
+// size increase re-queues it at the back of its (possibly new) level, losing time priority. Only the
+// trader who placed an order may amend it; an amend naming another trader's order is rejected with
+// REJECT_NOT_OWNER and leaves it unchanged
+func (e *MatchingEngine) Amend(id OrderID, newPrice Price, newSize Size, trader TraderID) {
+	slot := Slot(id & SLOT_MASK)
+
+	if newPrice == 0 || newPrice >= e.priceLevels {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, reason: REJECT_INVALID_PRICE})
+		return
+	}
+	if !e.pool.isValid(slot) {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, reason: REJECT_UNKNOWN_ORDER})
 		return
 	}
 
 	order := e.pool.get(slot)
 
-	// Check if the order is valid and not already canceled
-	if order.gen != Gen(id>>SLOT_BITS) || order.size == 0 {
-		e.outputRing.Push(OutputEvent{eventType: REJECT_EVENT, orderID: id})
+	// Reject stale or dead orders, pending stops, and sizes that would leave nothing open (use Cancel instead)
+	if order.id != id || order.size == 0 {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, reason: REJECT_UNKNOWN_ORDER})
+		return
+	}
+	if order.trader != trader {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, trader: trader, reason: REJECT_NOT_OWNER})
+		return
+	}
+	if order.flags&FLAG_PENDING_STOP != 0 {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, reason: REJECT_NOT_AMENDABLE})
+		return
+	}
+	if newSize <= order.filled {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, reason: REJECT_INVALID_SIZE})
+		return
+	}
+	if !e.validTick(order.symbol, newPrice) {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, reason: REJECT_INVALID_TICK})
+		return
+	}
+	if !e.withinBand(order.symbol, newPrice) {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, reason: REJECT_PRICE_BAND})
+		return
+	}
+	if newSize < e.minSizes[order.symbol] || newSize > e.maxSizes[order.symbol] {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, reason: REJECT_INVALID_SIZE})
+		return
+	}
+	if e.halted[order.symbol] {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, reason: REJECT_HALTED})
+		return
+	}
+	if e.isDisabled(order.trader) {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, reason: REJECT_TRADER_DISABLED})
 		return
 	}
 
+	oldPrice := order.price
+	newRemaining := newSize - order.filled
 	book := &e.books[order.symbol]
 
-	level := book.level(order.side, order.price)
-	level.remove(e.pool, slot)
+	// A reduce-only order may shrink but never grow, which could take the position past flat
+	if order.flags&FLAG_REDUCE_ONLY != 0 && newRemaining > order.size+order.reserve {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, reason: REJECT_REDUCE_ONLY})
+		return
+	}
 
-	e.outputRing.Push(OutputEvent{eventType: CANCEL_EVENT, orderID: id})
+	if e.stpMode == STP_REJECT_AGGRESSOR && !e.auctions[order.symbol] && e.wouldSelfTrade(book, order.side, newPrice, newRemaining, order.trader, nil) {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: id, reason: REJECT_SELF_TRADE})
+		return
+	}
+
+	e.outputRing.Push(OutputEvent{
+		eventType: AMEND_EVENT,
+		orderID:   id,
+		price:     newPrice,
+		size:      newSize,
+		prevPrice: oldPrice,
+		prevSize:  order.filled + order.size + order.reserve,
+		clOrdID:   order.clOrdID,
+		trader:    order.trader,
+		symbol:    order.symbol,
+		side:      order.side,
+	})
+
+	symbol, side := order.symbol, order.side
+	oldBefore, newBefore := book.level(side, oldPrice).volume, book.level(side, newPrice).volume
+	if newPrice == oldPrice && newRemaining <= order.size+order.reserve {
+		// Reduce in place, keeping queue position (drawing down any iceberg reserve first)
+		if newRemaining > order.size {
+			order.reserve = newRemaining - order.size
+		} else {
+			book.level(order.side, order.price).volume -= order.size - newRemaining
+			order.size, order.reserve = newRemaining, 0
+		}
+		e.levelChanged(symbol, side, oldPrice, oldBefore)
+		return
+	}
+
+	book.unlink(e.pool, slot)
+
+	// The new price may cross the spread, so match before re-queuing (except in a call auction)
+	remaining, selfTrade := newRemaining, false
+	if !e.auctions[order.symbol] {
+		remaining, selfTrade = e.match(book, newRemaining, order.symbol, order.side, newPrice, order.trader, id)
+	}
+
+	if remaining > 0 && selfTrade {
+		e.cancelRemainder(slot, id, order.symbol, order.side, newPrice, remaining, order.trader)
+	} else if remaining > 0 {
+		order.filled += newRemaining - remaining
+
+		visible, reserve := order.split(remaining)
+		book.add(e.pool, order.side, newPrice, id, slot, visible, order.symbol, order.trader, e.matchMode == LIFO)
+		e.checkUncrossed(book, symbol)
+		order.reserve = reserve
+	} else {
+		e.pool.free(slot)
+	}
+
+	// Report the old level once the order is back in the book, so a same-price requeue is a single update
+	e.levelChanged(symbol, side, oldPrice, oldBefore)
+	if newPrice != oldPrice {
+		e.levelChanged(symbol, side, newPrice, newBefore)
+	}
+	e.triggerStops(book)
 }
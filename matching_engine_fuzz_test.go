@@ -0,0 +1,104 @@
+package main
+
+import "testing"
+
+// Engine shared by every input of FuzzMatchingEngine in a process. Each input starts from an empty
+// book, but with the pool's free list and generations as earlier inputs left them, so it also
+// exercises slot recycling across inputs
+var fuzzEngine *MatchingEngine
+
+// Each 4-byte step of the input is one command: limits (IOC and icebergs among them) and markets,
+// cancels and amends, with out-of-range prices and sizes and stale, bogus or misattributed IDs
+// mixed in. After every command the engine must pass Validate, and every quantity ever submitted must
+// be accounted for: submitted (including amended size changes) = filled + resting + cancelled
+func FuzzMatchingEngine(f *testing.F) {
+	f.Add([]byte{0, 0, 5, 10, 0, 1, 5, 10, 1, 0, 0, 0})
+	// Fill the free list and drain it again, out of order, then cancel the recycled slots' old IDs
+	f.Add([]byte{
+		0, 0, 1, 5, 0, 0, 2, 5, 0, 0, 3, 5, 0, 0, 4, 5,
+		1, 2, 0, 0, 1, 0, 0, 0, 1, 3, 0, 0, 1, 1, 0, 0,
+		0, 1, 1, 5, 0, 1, 2, 5, 0, 1, 3, 5,
+		1, 0, 0, 0, 1, 1, 0, 0, 1, 2, 0, 0, 1, 3, 1, 0,
+	})
+	// Cross, partly fill an iceberg, amend it up and down, then sweep the book with a market order
+	f.Add([]byte{
+		0, 0x40, 10, 30, 0, 1, 10, 4, 2, 0, 12, 40, 2, 0, 10, 6,
+		0, 1, 5, 7, 3, 1, 0, 50, 2, 0, 3, 2, 1, 0, 1, 0,
+	})
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		if fuzzEngine == nil {
+			fuzzEngine = newTestEngineWithConfig(EngineConfig{priceLevels: 256, sparseBooks: true})
+		}
+		e := fuzzEngine
+		defer func() {
+			e.CancelSymbol(1)
+			drainOutputEvents(e)
+		}()
+
+		var ids []OrderID
+		var submitted, filled, cancelled int64
+		for step := 0; step+4 <= len(input); step += 4 {
+			op, a, b, c := input[step], input[step+1], input[step+2], input[step+3]
+			side, trader := Side(a&1), TraderID(a>>1&3)
+			price := Price(90 + b%21)
+			if b >= 250 {
+				price = Price(b-250) * 128 // 0, or an unknown price level
+			}
+			size := Size(c % 40) // Sometimes 0, which is rejected
+
+			id := OrderID(b) << 32 // Bogus
+			if len(ids) > 0 && a&0x80 == 0 {
+				id = ids[int(b)%len(ids)] // Possibly filled, cancelled or its slot recycled
+			}
+
+			switch op % 4 {
+			case 0:
+				cmd := &InputCommand{symbol: 1, side: side, price: price, size: size, trader: trader}
+				if a&0x40 != 0 {
+					cmd.peakSize = 1 + size/4
+				}
+				if a&0x20 != 0 {
+					cmd.tif = IOC
+				}
+				e.LimitCommand(cmd)
+			case 1:
+				e.Cancel(id, trader)
+			case 2:
+				e.Amend(id, price, size, trader)
+			case 3:
+				e.Market(&InputCommand{symbol: 1, side: side, size: size, trader: trader})
+			}
+
+			for _, ev := range drainOutputEvents(e) {
+				switch ev.eventType {
+				case ORDER_EVENT:
+					ids = append(ids, ev.orderID)
+					submitted += int64(ev.size)
+				case AMEND_EVENT:
+					submitted += int64(ev.size) - int64(ev.prevSize)
+				case EXECUTION_EVENT:
+					filled += int64(ev.size)
+				case CANCEL_EVENT:
+					cancelled += int64(ev.size)
+				}
+			}
+
+			if err := e.Validate(); err != nil {
+				t.Fatalf("after step %d: %v", step/4, err)
+			}
+			var resting int64
+			book := &e.books[1]
+			for _, side := range []Side{Bid, Ask} {
+				for price := Price(1); price < book.priceLevels(); price++ {
+					for slot := book.level(side, price).headSlot; slot != 0; slot = e.pool.get(slot).nextSlot {
+						resting += int64(e.pool.get(slot).size + e.pool.get(slot).reserve)
+					}
+				}
+			}
+			if submitted != filled+resting+cancelled {
+				t.Fatalf("after step %d: submitted %d, but filled %d + resting %d + cancelled %d", step/4, submitted, filled, resting, cancelled)
+			}
+		}
+	})
+}
@@ -0,0 +1,1592 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+// Order slots in each test engine's pool: plenty for any test, and a few MB rather than the
+// default's 4GB, so the hundreds of engines the suite builds are cheap to allocate and collect
+const TEST_MAX_ORDERS = 1 << 16
+
+// Helper to create a MatchingEngine for a test
+func newTestEngine() *MatchingEngine {
+	return newTestEngineWithConfig(EngineConfig{})
+}
+
+// Helper to create a MatchingEngine with non-default options for a test (and a TEST_MAX_ORDERS
+// pool unless config sets maxOrders)
+func newTestEngineWithConfig(config EngineConfig) *MatchingEngine {
+	if config.maxOrders == 0 {
+		config.maxOrders = TEST_MAX_ORDERS
+	}
+	return NewMatchingEngineWithConfig(config)
+}
+
+// Helper to submit a limit order directly to the engine
+func limit(e *MatchingEngine, symbol Symbol, side Side, price Price, size Size, trader TraderID, tif TimeInForce) {
+	e.LimitCommand(&InputCommand{symbol: symbol, side: side, price: price, size: size, trader: trader, tif: tif})
+}
+
+// Helper to collect every OutputEvent currently in the engine.outputRing without blocking.
+func drainOutputEvents(e *MatchingEngine) []OutputEvent {
+	available := atomic.LoadUint64(&e.outputRing.writePos) - atomic.LoadUint64(&e.outputRing.readPos)
+	if available == 0 {
+		return nil
+	}
+	buf := make([]OutputEvent, available)
+	n := e.outputRing.Read(buf)
+	return buf[:n]
+}
+
+// Helper to drop the maker's report of each fill, leaving the aggressor's view of the events
+func takerEvents(events []OutputEvent) []OutputEvent {
+	var taker []OutputEvent
+	for _, ev := range events {
+		if !(ev.eventType == EXECUTION_EVENT && ev.maker) {
+			taker = append(taker, ev)
+		}
+	}
+	return taker
+}
+
+func TestLimitIOC_EmptyBookCancelsFullSize(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 5, 7, IOC)
+
+	events := drainOutputEvents(e)
+	if len(events) != 2 {
+		t.Fatalf("expected ORDER_EVENT and CANCEL_EVENT, got %+v", events)
+	}
+	if events[0].eventType != ORDER_EVENT || events[0].size != 5 {
+		t.Fatalf("expected ORDER_EVENT of size 5 first, got %+v", events[0])
+	}
+	if events[1].eventType != CANCEL_EVENT || events[1].orderID != events[0].orderID || events[1].size != 5 {
+		t.Fatalf("expected CANCEL_EVENT for full size 5, got %+v", events[1])
+	}
+
+	// Nothing should be resting on the bid side
+	if e.books[1].bidMax != 0 || e.books[1].bidLevels[10].headSlot != 0 {
+		t.Fatalf("IOC order should not rest, bidMax %d", e.books[1].bidMax)
+	}
+}
+
+func TestLimitIOC_PartialFillCancelsRemainder(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 3, 1, GTC)
+	e.Limit(1, Bid, 11, 5, 2, IOC)
+
+	events := takerEvents(drainOutputEvents(e))
+	if len(events) != 5 {
+		t.Fatalf("expected 5 events, got %+v", events)
+	}
+	if events[3].eventType != EXECUTION_EVENT || events[3].size != 3 || events[3].price != 10 {
+		t.Fatalf("expected execution of 3 at 10, got %+v", events[3])
+	}
+	if events[4].eventType != CANCEL_EVENT || events[4].orderID != events[2].orderID || events[4].size != 2 {
+		t.Fatalf("expected CANCEL_EVENT for remaining 2, got %+v", events[4])
+	}
+	if e.books[1].bidMax != 0 {
+		t.Fatalf("IOC remainder should not rest, bidMax %d", e.books[1].bidMax)
+	}
+}
+
+func TestLimitGTC_RestsRemainder(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 5, 7, GTC)
+
+	events := drainOutputEvents(e)
+	if len(events) != 2 || events[0].eventType != ORDER_EVENT || events[1].eventType != RESTED_EVENT {
+		t.Fatalf("expected ORDER_EVENT then RESTED_EVENT, got %+v", events)
+	}
+	if rested := events[1]; rested.orderID != events[0].orderID || rested.price != 10 || rested.size != 5 || rested.side != Bid {
+		t.Fatalf("expected the RESTED_EVENT to report 5 @ 10 on the bid, got %+v", rested)
+	}
+	if e.books[1].bidMax != 10 || e.books[1].bidLevels[10].headSlot == 0 {
+		t.Fatalf("GTC order should rest at 10, bidMax %d", e.books[1].bidMax)
+	}
+}
+
+func TestLimitFOK_InsufficientVolumeRejects(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 3, 1, GTC)
+	e.Limit(1, Ask, 12, 5, 1, GTC) // Beyond the FOK limit price, must not count
+	drainOutputEvents(e)
+
+	e.Limit(1, Bid, 11, 5, 2, FOK)
+
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT {
+		t.Fatalf("expected a single REJECT_EVENT, got %+v", events)
+	}
+
+	// Resting asks must be untouched
+	head := e.pool.get(e.books[1].askLevels[10].headSlot)
+	if head.size != 3 {
+		t.Fatalf("expected resting ask size 3 at 10, got %d", head.size)
+	}
+	if e.books[1].bidMax != 0 {
+		t.Fatalf("FOK order should not rest, bidMax %d", e.books[1].bidMax)
+	}
+}
+
+func TestLimitFOK_FillsAcrossLevels(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 3, 1, GTC)
+	e.Limit(1, Bid, 9, 4, 1, GTC)
+	drainOutputEvents(e)
+
+	e.Limit(1, Ask, 9, 6, 2, FOK)
+
+	events := takerEvents(drainOutputEvents(e))
+	if len(events) != 3 || events[0].eventType != ORDER_EVENT {
+		t.Fatalf("expected ORDER_EVENT and two executions, got %+v", events)
+	}
+	if events[1].eventType != EXECUTION_EVENT || events[1].price != 10 || events[1].size != 3 {
+		t.Fatalf("expected execution of 3 at 10, got %+v", events[1])
+	}
+	if events[2].eventType != EXECUTION_EVENT || events[2].price != 9 || events[2].size != 3 {
+		t.Fatalf("expected execution of 3 at 9, got %+v", events[2])
+	}
+	if e.books[1].askMin != DEFAULT_PRICE_LEVELS {
+		t.Fatalf("FOK order should not rest, askMin %d", e.books[1].askMin)
+	}
+}
+
+func TestAmend_SizeReductionKeepsPriority(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	e.Limit(1, Ask, 10, 5, 2, GTC)
+	events := drainOutputEvents(e)
+	first, second := events[0].orderID, events[2].orderID
+
+	e.Amend(first, 10, 2, 1)
+
+	events = drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != AMEND_EVENT {
+		t.Fatalf("expected a single AMEND_EVENT, got %+v", events)
+	}
+	if events[0].prevSize != 5 || events[0].size != 2 || events[0].prevPrice != 10 || events[0].price != 10 {
+		t.Fatalf("amend event old/new values mismatch: %+v", events[0])
+	}
+
+	// The amended order should still be first in the queue
+	e.Limit(1, Bid, 10, 3, 3, GTC)
+	events = takerEvents(drainOutputEvents(e))
+	if len(events) != 3 || events[1].counterOrderID != first || events[1].size != 2 || events[2].counterOrderID != second {
+		t.Fatalf("expected fills against amended order first, got %+v", events)
+	}
+}
+
+func TestAmend_SizeIncreaseLosesPriority(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	e.Limit(1, Ask, 10, 5, 2, GTC)
+	events := drainOutputEvents(e)
+	first, second := events[0].orderID, events[2].orderID
+
+	e.Amend(first, 10, 8, 1)
+	drainOutputEvents(e)
+
+	e.Limit(1, Bid, 10, 5, 3, GTC)
+	events = takerEvents(drainOutputEvents(e))
+	if len(events) != 2 || events[1].counterOrderID != second {
+		t.Fatalf("expected fill against the unamended order first, got %+v", events)
+	}
+
+	head := e.pool.get(e.books[1].askLevels[10].headSlot)
+	if head.id != first || head.size != 8 {
+		t.Fatalf("expected amended order resting with size 8, got %+v", head)
+	}
+}
+
+func TestAmend_PriceChangeMovesLevel(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 5, 1, GTC)
+	id := drainOutputEvents(e)[0].orderID
+
+	e.Amend(id, 8, 5, 1)
+	drainOutputEvents(e)
+
+	book := &e.books[1]
+	if book.bidLevels[10].headSlot != 0 {
+		t.Fatalf("expected level 10 to be empty after amend")
+	}
+	if book.bidMax != 8 || book.bidLevels[8].headSlot != Slot(id&SLOT_MASK) {
+		t.Fatalf("expected order resting at 8, bidMax %d", book.bidMax)
+	}
+}
+
+func TestAmend_CrossingPriceMatches(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 12, 3, 1, GTC)
+	e.Limit(1, Bid, 10, 5, 2, GTC)
+	events := drainOutputEvents(e)
+	ask, bid := events[0].orderID, events[2].orderID
+
+	e.Amend(bid, 12, 5, 2)
+
+	events = takerEvents(drainOutputEvents(e))
+	if len(events) != 2 || events[1].eventType != EXECUTION_EVENT || events[1].counterOrderID != ask || events[1].size != 3 {
+		t.Fatalf("expected amend followed by an execution of 3, got %+v", events)
+	}
+	if events[1].orderID != bid || events[1].trader != 2 {
+		t.Fatalf("execution should be attributed to the amended order, got %+v", events[1])
+	}
+
+	book := &e.books[1]
+	order := e.pool.get(book.bidLevels[12].headSlot)
+	if book.bidMax != 12 || order.size != 2 || order.filled != 3 {
+		t.Fatalf("expected remaining 2 resting at 12, got %+v", order)
+	}
+}
+
+func TestAmend_BelowFilledRejects(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	e.Limit(1, Bid, 10, 3, 2, GTC)
+	id := drainOutputEvents(e)[0].orderID
+
+	e.Amend(id, 10, 2, 1) // 3 already filled
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT || events[0].orderID != id {
+		t.Fatalf("expected REJECT_EVENT, got %+v", events)
+	}
+
+	// Order should be untouched
+	order := e.pool.get(Slot(id & SLOT_MASK))
+	if order.size != 2 || order.filled != 3 {
+		t.Fatalf("expected order untouched (size 2, filled 3), got %+v", order)
+	}
+}
+
+func TestReplace_CancelsOldAndPlacesNew(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 5, 1, GTC)
+	oldID := drainOutputEvents(e)[0].orderID
+
+	e.Replace(oldID, 1, Bid, 11, 6, 1, GTC)
+
+	events := drainOutputEvents(e)
+	if len(events) != 3 || events[2].eventType != RESTED_EVENT {
+		t.Fatalf("expected REPLACE_EVENT, ORDER_EVENT and RESTED_EVENT, got %+v", events)
+	}
+	if events[0].eventType != REPLACE_EVENT || events[0].orderID != oldID || events[0].cancelFailed {
+		t.Fatalf("expected successful REPLACE_EVENT for old order, got %+v", events[0])
+	}
+	if events[1].eventType != ORDER_EVENT || events[1].price != 11 || events[1].size != 6 {
+		t.Fatalf("expected ORDER_EVENT for replacement, got %+v", events[1])
+	}
+
+	book := &e.books[1]
+	if book.bidLevels[10].headSlot != 0 || book.bidMax != 11 {
+		t.Fatalf("expected only the replacement resting, bidMax %d", book.bidMax)
+	}
+}
+
+func TestEngineConfig_FewerPriceLevels(t *testing.T) {
+	e := newTestEngineWithConfig(EngineConfig{priceLevels: 512})
+	if len(e.books[1].bidLevels) != 512 || e.books[1].askMin != 512 {
+		t.Fatalf("expected books of 512 levels, got %d (askMin %d)", len(e.books[1].bidLevels), e.books[1].askMin)
+	}
+
+	limit(e, 1, Bid, 512, 5, 1, GTC)
+	if events := drainOutputEvents(e); len(events) != 1 || events[0].reason != REJECT_INVALID_PRICE {
+		t.Fatalf("expected REJECT_INVALID_PRICE at 512, got %+v", events)
+	}
+
+	// A market order reaches the top level
+	limit(e, 1, Ask, 511, 5, 1, GTC)
+	e.Market(&InputCommand{symbol: 1, side: Bid, size: 5, trader: 2})
+	if events := takerEvents(drainOutputEvents(e)); len(events) != 4 || events[3].eventType != EXECUTION_EVENT || events[3].price != 511 {
+		t.Fatalf("expected the market bid to fill at 511, got %+v", events)
+	}
+	if _, ok := e.Spread(1); ok || e.books[1].askMin != 512 {
+		t.Fatalf("expected an empty book, askMin %d", e.books[1].askMin)
+	}
+
+	// A snapshot loads into an engine with a different range
+	limit(e, 1, Bid, 100, 5, 1, GTC)
+	var buf bytes.Buffer
+	if err := e.SaveSnapshot(&buf); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	loaded := newTestEngine()
+	if err := loaded.LoadSnapshot(&buf); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loaded.books[1].askMin != DEFAULT_PRICE_LEVELS || loaded.books[1].VolumeAt(Bid, 100) != 5 {
+		t.Fatalf("expected the bid and no asks, askMin %d", loaded.books[1].askMin)
+	}
+	limit(loaded, 1, Ask, 5000, 5, 2, GTC)
+	if bids, asks := loaded.Depth(1, 5); len(bids) != 1 || len(asks) != 1 || asks[0].price != 5000 {
+		t.Fatalf("expected a bid at 100 and an ask at 5000, got %+v %+v", bids, asks)
+	}
+}
+
+func TestEngineConfig_WidePriceRange(t *testing.T) {
+	e := newTestEngineWithConfig(EngineConfig{priceLevels: MAX_PRICE_LEVELS, sparseBooks: true})
+
+	limit(e, 1, Bid, 10_000_000, 5, 1, GTC)
+	limit(e, 1, Ask, MAX_PRICE_LEVELS-1, 5, 2, GTC)
+	limit(e, 1, Ask, 12_345_678, 3, 2, GTC)
+	if spread, ok := e.Spread(1); !ok || spread != 2_345_678 {
+		t.Fatalf("expected a spread of 2,345,678 ticks, got %d (%v)", spread, ok)
+	}
+
+	// A sweep leaves the far ask as the best, found across the whole range
+	e.Market(&InputCommand{symbol: 1, side: Bid, size: 3, trader: 3})
+	if e.books[1].askMin != MAX_PRICE_LEVELS-1 {
+		t.Fatalf("expected the best ask at %d, got %d", MAX_PRICE_LEVELS-1, e.books[1].askMin)
+	}
+	limit(e, 1, Ask, MAX_PRICE_LEVELS, 5, 2, GTC)
+	if events := drainOutputEvents(e); events[len(events)-1].reason != REJECT_INVALID_PRICE {
+		t.Fatalf("expected REJECT_INVALID_PRICE beyond the range, got %+v", events[len(events)-1])
+	}
+}
+
+func TestEngineConfig_RejectsInvalidPriceLevels(t *testing.T) {
+	for _, levels := range []Price{1, MAX_PRICE_LEVELS + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic for %d price levels", levels)
+				}
+			}()
+			NewMatchingEngineWithConfig(EngineConfig{priceLevels: levels})
+		}()
+	}
+}
+
+func TestEngineConfig_RejectsInvalidMaxOrders(t *testing.T) {
+	for _, orders := range []Slot{1, MAX_ORDERS + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic for %d max orders", orders)
+				}
+			}()
+			NewMatchingEngineWithConfig(EngineConfig{maxOrders: orders})
+		}()
+	}
+}
+
+func TestEngineConfig_RejectsInvalidCPUs(t *testing.T) {
+	for _, cpu := range []int{-1, CPU_SET_SIZE} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic for cpu %d", cpu)
+				}
+			}()
+			NewMatchingEngineWithConfig(EngineConfig{lockThreads: true, cpus: []int{0, cpu}})
+		}()
+	}
+}
+
+func TestEngineConfig_SparseBooksAllocateOnFirstOrder(t *testing.T) {
+	e := newTestEngineWithConfig(EngineConfig{sparseBooks: true})
+
+	// Books not yet allocated read as empty
+	if bids, asks := e.Depth(1, 5); len(bids) != 0 || len(asks) != 0 || e.books[1].VolumeAt(Bid, 100) != 0 {
+		t.Fatalf("expected an empty book, got %+v %+v", bids, asks)
+	}
+	if _, ok := e.Spread(1); ok {
+		t.Fatal("expected no spread on an empty book")
+	}
+
+	limit(e, 1, Bid, 100, 5, 1, GTC)
+	limit(e, 1, Ask, 100, 2, 2, GTC)
+	if events := takerEvents(drainOutputEvents(e)); len(events) != 4 || events[3].eventType != EXECUTION_EVENT {
+		t.Fatalf("expected the ask to trade with the bid, got %+v", events)
+	}
+	if e.books[1].shared || !e.books[2].shared || &e.books[1].bidLevels[0] == &e.books[2].bidLevels[0] {
+		t.Fatal("expected only symbol 1's book to be allocated")
+	}
+	if e.books[1].VolumeAt(Bid, 100) != 3 || e.books[2].VolumeAt(Bid, 100) != 0 {
+		t.Fatalf("expected 3 resting on symbol 1 only, got %d and %d", e.books[1].VolumeAt(Bid, 100), e.books[2].VolumeAt(Bid, 100))
+	}
+
+	// Once a book exists, matching on it does not allocate
+	allocs := testing.AllocsPerRun(100, func() {
+		limit(e, 1, Bid, 99, 1, 1, GTC)
+		limit(e, 1, Ask, 99, 1, 2, GTC)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations per order, got %v", allocs)
+	}
+}
+
+func TestCancel_OnlyTheOwnerCanCancel(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 5, 1, GTC)
+	id := drainOutputEvents(e)[0].orderID
+
+	e.Cancel(id, 2)
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT || events[0].reason != REJECT_NOT_OWNER || events[0].trader != 2 {
+		t.Fatalf("expected REJECT_NOT_OWNER for trader 2, got %+v", events)
+	}
+	if exists, remaining, _, _, _ := e.OrderStatus(id); !exists || remaining != 5 {
+		t.Fatalf("expected the order to stay working with 5, got %v %d", exists, remaining)
+	}
+
+	e.Cancel(id, 1)
+	events = drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != CANCEL_EVENT || events[0].orderID != id {
+		t.Fatalf("expected the owner's cancel to go through, got %+v", events)
+	}
+}
+
+func TestAmend_OnlyTheOwnerCanAmend(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 5, 1, GTC)
+	id := drainOutputEvents(e)[0].orderID
+
+	e.Amend(id, 11, 8, 2)
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT || events[0].reason != REJECT_NOT_OWNER || events[0].trader != 2 {
+		t.Fatalf("expected REJECT_NOT_OWNER for trader 2, got %+v", events)
+	}
+	if exists, remaining, _, _, _ := e.OrderStatus(id); !exists || remaining != 5 {
+		t.Fatalf("expected the order to stay working with 5, got %v %d", exists, remaining)
+	}
+	if bids, _ := e.Depth(1, 1); len(bids) != 1 || bids[0].price != 10 {
+		t.Fatalf("expected the order to stay at 10, got %+v", bids)
+	}
+
+	e.Amend(id, 11, 8, 1)
+	events = drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != AMEND_EVENT || events[0].price != 11 || events[0].size != 8 {
+		t.Fatalf("expected the owner's amend to go through, got %+v", events)
+	}
+}
+
+func TestReplace_OnlyTheOwnerCanReplace(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 5, 1, GTC)
+	id := drainOutputEvents(e)[0].orderID
+
+	e.Replace(id, 1, Bid, 11, 8, 2, GTC)
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT || events[0].reason != REJECT_NOT_OWNER || events[0].trader != 2 {
+		t.Fatalf("expected only REJECT_NOT_OWNER for trader 2, got %+v", events)
+	}
+	if exists, remaining, _, _, _ := e.OrderStatus(id); !exists || remaining != 5 {
+		t.Fatalf("expected the order to stay working with 5, got %v %d", exists, remaining)
+	}
+	if bids, _ := e.Depth(1, 5); len(bids) != 1 || bids[0].price != 10 || bids[0].size != 5 {
+		t.Fatalf("expected nothing placed for trader 2, got %+v", bids)
+	}
+
+	e.Replace(id, 1, Bid, 11, 8, 1, GTC)
+	events = drainOutputEvents(e)
+	if len(events) != 3 || events[0].eventType != REPLACE_EVENT || events[0].cancelFailed || events[1].eventType != ORDER_EVENT || events[2].eventType != RESTED_EVENT {
+		t.Fatalf("expected the owner's replace to go through, got %+v", events)
+	}
+}
+
+func TestCancel_RejectsOrderNotLinkedAtItsLevel(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 100, 5, 1, GTC)
+	id := drainOutputEvents(e)[0].orderID
+	e.Limit(1, Bid, 100, 3, 1, GTC)
+	e.Limit(1, Bid, 101, 4, 1, GTC)
+	drainOutputEvents(e)
+
+	// A stale price leaves the order naming a level whose queue it is not in
+	e.pool.get(Slot(id & SLOT_MASK)).price = 101
+	e.Cancel(id, 1)
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT || events[0].reason != REJECT_UNKNOWN_ORDER {
+		t.Fatalf("expected REJECT_UNKNOWN_ORDER, got %+v", events)
+	}
+	book := &e.books[1]
+	if book.VolumeAt(Bid, 101) != 4 || book.VolumeAt(Bid, 100) != 8 || book.bidMax != 101 {
+		t.Fatalf("expected both levels untouched, got 101: %d, 100: %d, bidMax %d", book.VolumeAt(Bid, 101), book.VolumeAt(Bid, 100), book.bidMax)
+	}
+
+	e.pool.get(Slot(id & SLOT_MASK)).price = 100
+	e.Cancel(id, 1)
+	if events := drainOutputEvents(e); len(events) != 1 || events[0].eventType != CANCEL_EVENT {
+		t.Fatalf("expected the cancel to go through once the order is back at its level, got %+v", events)
+	}
+	if err := e.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCancelQty_KeepsQueuePosition(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	e.Limit(1, Ask, 10, 5, 2, GTC)
+	first := drainOutputEvents(e)[0].orderID
+
+	e.CancelQty(first, 3, 1)
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != CANCEL_EVENT || events[0].orderID != first || events[0].size != 3 || events[0].prevSize != 5 {
+		t.Fatalf("expected a CANCEL_EVENT for 3 of 5, got %+v", events)
+	}
+	if got := e.books[1].VolumeAt(Ask, 10); got != 7 {
+		t.Fatalf("expected 7 left at the level, got %d", got)
+	}
+
+	// The reduced order is still first in the queue
+	e.Limit(1, Bid, 10, 2, 3, IOC)
+	events = takerEvents(drainOutputEvents(e))
+	if len(events) != 2 || events[1].eventType != EXECUTION_EVENT || events[1].counterOrderID != first || events[1].size != 2 {
+		t.Fatalf("expected the reduced order to fill first, got %+v", events)
+	}
+	if exists, _, _, _, _ := e.OrderStatus(first); exists {
+		t.Fatal("expected the reduced order to be filled")
+	}
+}
+
+func TestCancelQty_DrawsDownIcebergReserveFirst(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 10, size: 10, peakSize: 2, trader: 1})
+	id := drainOutputEvents(e)[0].orderID
+
+	e.CancelQty(id, 7, 1)
+	drainOutputEvents(e)
+	order := e.pool.get(Slot(id & SLOT_MASK))
+	if order.size != 2 || order.reserve != 1 || e.books[1].VolumeAt(Bid, 10) != 2 {
+		t.Fatalf("expected 2 visible and 1 in reserve, got %d and %d", order.size, order.reserve)
+	}
+
+	e.CancelQty(id, 2, 1)
+	drainOutputEvents(e)
+	if order.size != 1 || order.reserve != 0 || e.books[1].VolumeAt(Bid, 10) != 1 {
+		t.Fatalf("expected 1 visible and no reserve, got %d and %d", order.size, order.reserve)
+	}
+}
+
+func TestCancelQty_WholeOpenSizeIsAFullCancel(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 5, 1, GTC)
+	id := drainOutputEvents(e)[0].orderID
+
+	e.CancelQty(id, 1, 2)
+	e.CancelQty(id, 0, 1)
+	events := drainOutputEvents(e)
+	if len(events) != 2 || events[0].reason != REJECT_NOT_OWNER || events[1].reason != REJECT_INVALID_SIZE {
+		t.Fatalf("expected REJECT_NOT_OWNER then REJECT_INVALID_SIZE, got %+v", events)
+	}
+
+	e.CancelQty(id, 5, 1)
+	events = drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != CANCEL_EVENT || events[0].size != 5 || events[0].prevSize != 0 {
+		t.Fatalf("expected a full CANCEL_EVENT for 5, got %+v", events)
+	}
+	if exists, _, _, _, _ := e.OrderStatus(id); exists || e.books[1].bidMax != 0 {
+		t.Fatal("expected the order gone from the book")
+	}
+
+	// Its slot is recycled for the next order
+	e.Limit(1, Bid, 10, 5, 1, GTC)
+	if next := drainOutputEvents(e)[0].orderID; next&SLOT_MASK != id&SLOT_MASK || next == id {
+		t.Fatalf("expected slot %d reused under a new ID, got %d", id&SLOT_MASK, next)
+	}
+}
+
+func TestReplace_GoneOrderStillPlacesReplacement(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 5, 1, GTC)
+	oldID := drainOutputEvents(e)[0].orderID
+	e.Cancel(oldID, 1)
+	drainOutputEvents(e)
+
+	e.Replace(oldID, 1, Bid, 11, 6, 1, GTC)
+
+	events := drainOutputEvents(e)
+	if len(events) != 3 || events[0].eventType != REPLACE_EVENT || !events[0].cancelFailed {
+		t.Fatalf("expected REPLACE_EVENT flagged cancelFailed, got %+v", events)
+	}
+	if events[1].eventType != ORDER_EVENT || e.books[1].bidMax != 11 {
+		t.Fatalf("expected replacement to rest at 11, got %+v", events[1])
+	}
+}
+
+func TestReplace_RejectedReplacementLeavesOldOrder(t *testing.T) {
+	e := newTestEngine()
+	e.SetSizeLimits(1, 1, 100)
+
+	e.Limit(1, Bid, 10, 5, 1, GTC)
+	oldID := drainOutputEvents(e)[0].orderID
+
+	for _, tc := range []struct {
+		price  Price
+		size   Size
+		reason RejectReason
+	}{
+		{price: 0, size: 6, reason: REJECT_INVALID_PRICE},
+		{price: 11, size: 0, reason: REJECT_INVALID_SIZE},
+		{price: 11, size: 101, reason: REJECT_INVALID_SIZE},
+	} {
+		e.Replace(oldID, 1, Bid, tc.price, tc.size, 1, GTC)
+		events := drainOutputEvents(e)
+		if len(events) != 1 || events[0].eventType != REJECT_EVENT || events[0].reason != tc.reason || events[0].orderID != oldID {
+			t.Fatalf("price %d size %d: expected only %v for the old order, got %+v", tc.price, tc.size, tc.reason, events)
+		}
+		if exists, remaining, _, _, _ := e.OrderStatus(oldID); !exists || remaining != 5 {
+			t.Fatalf("price %d size %d: expected the old order to stay working with 5, got %v %d", tc.price, tc.size, exists, remaining)
+		}
+	}
+}
+
+func TestReplace_ChecksPassOverTheOrderBeingReplaced(t *testing.T) {
+	e := newTestEngine()
+
+	// The trader's own ask is the only one a post-only bid at 10 would meet, and it is the one replaced
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	oldID := drainOutputEvents(e)[0].orderID
+
+	e.ReplaceCommand(&InputCommand{orderID: oldID, symbol: 1, side: Bid, price: 10, size: 5, trader: 1, tif: GTC, postOnly: true})
+	events := drainOutputEvents(e)
+	if len(events) != 3 || events[0].eventType != REPLACE_EVENT || events[0].cancelFailed || events[2].eventType != RESTED_EVENT {
+		t.Fatalf("expected the post-only bid to replace the ask and rest, got %+v", events)
+	}
+	if book := &e.books[1]; book.bidMax != 10 || book.askMin != book.priceLevels() {
+		t.Fatalf("expected only the bid at 10 resting, got bidMax %d askMin %d", book.bidMax, book.askMin)
+	}
+}
+
+func TestSTP_NoneAllowsSelfTrade(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	e.Limit(1, Bid, 10, 5, 1, GTC)
+
+	events := takerEvents(drainOutputEvents(e))
+	if len(events) != 4 || events[3].eventType != EXECUTION_EVENT || events[3].size != 5 {
+		t.Fatalf("expected a self-trade execution, got %+v", events)
+	}
+}
+
+func TestSTP_CancelRestingSkipsOwnOrder(t *testing.T) {
+	e := newTestEngine()
+	e.SetSTPMode(STP_CANCEL_RESTING)
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	e.Limit(1, Ask, 10, 5, 2, GTC)
+	events := drainOutputEvents(e)
+	own, other := events[0].orderID, events[2].orderID
+
+	e.Limit(1, Bid, 10, 5, 1, GTC)
+
+	events = takerEvents(drainOutputEvents(e))
+	if len(events) != 3 {
+		t.Fatalf("expected ORDER, CANCEL and EXECUTION events, got %+v", events)
+	}
+	if events[1].eventType != CANCEL_EVENT || events[1].orderID != own || events[1].size != 5 {
+		t.Fatalf("expected own resting order cancelled, got %+v", events[1])
+	}
+	if events[2].eventType != EXECUTION_EVENT || events[2].counterOrderID != other || events[2].size != 5 {
+		t.Fatalf("expected execution against other trader, got %+v", events[2])
+	}
+	if e.books[1].askMin != DEFAULT_PRICE_LEVELS || e.books[1].bidMax != 0 {
+		t.Fatalf("expected empty book, askMin %d bidMax %d", e.books[1].askMin, e.books[1].bidMax)
+	}
+}
+
+func TestSTP_CancelNewestKeepsEarlierFills(t *testing.T) {
+	e := newTestEngine()
+	e.SetSTPMode(STP_CANCEL_NEWEST)
+
+	e.Limit(1, Ask, 10, 3, 2, GTC)
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	events := drainOutputEvents(e)
+	own := events[2].orderID
+
+	e.Limit(1, Bid, 10, 6, 1, GTC)
+
+	events = takerEvents(drainOutputEvents(e))
+	if len(events) != 3 {
+		t.Fatalf("expected ORDER, EXECUTION and CANCEL events, got %+v", events)
+	}
+	if events[1].eventType != EXECUTION_EVENT || events[1].size != 3 {
+		t.Fatalf("expected execution of 3 against other trader, got %+v", events[1])
+	}
+	if events[2].eventType != CANCEL_EVENT || events[2].orderID != events[0].orderID || events[2].size != 3 {
+		t.Fatalf("expected incoming remainder of 3 cancelled, got %+v", events[2])
+	}
+
+	// Own resting order is untouched and nothing rests on the bid side
+	if head := e.pool.get(e.books[1].askLevels[10].headSlot); head.id != own || head.size != 5 {
+		t.Fatalf("expected own resting order untouched, got %+v", head)
+	}
+	if e.books[1].bidMax != 0 {
+		t.Fatalf("incoming remainder should not rest, bidMax %d", e.books[1].bidMax)
+	}
+}
+
+func TestSTP_RejectAggressorBeforeExecution(t *testing.T) {
+	e := newTestEngine()
+	e.SetSTPMode(STP_REJECT_AGGRESSOR)
+
+	e.Limit(1, Ask, 10, 3, 2, GTC)
+	e.Limit(1, Ask, 11, 5, 1, GTC)
+	drainOutputEvents(e)
+
+	// Would trade with trader 2 first, then reach own order at 11
+	e.Limit(1, Bid, 11, 6, 1, GTC)
+	events := takerEvents(drainOutputEvents(e))
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT {
+		t.Fatalf("expected a single REJECT_EVENT, got %+v", events)
+	}
+
+	// Filled before reaching own order, so accepted
+	e.Limit(1, Bid, 11, 3, 1, GTC)
+	events = takerEvents(drainOutputEvents(e))
+	if len(events) != 2 || events[1].eventType != EXECUTION_EVENT || events[1].size != 3 {
+		t.Fatalf("expected execution of 3, got %+v", events)
+	}
+}
+
+func TestSTP_CancelRestingFOKExcludesOwnOrders(t *testing.T) {
+	e := newTestEngine()
+	e.SetSTPMode(STP_CANCEL_RESTING)
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	e.Limit(1, Ask, 10, 3, 2, GTC)
+	drainOutputEvents(e)
+
+	// Only 3 is available once the own order is set aside, so the FOK is rejected untouched
+	e.Limit(1, Bid, 10, 8, 1, FOK)
+	events := takerEvents(drainOutputEvents(e))
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT {
+		t.Fatalf("expected a single REJECT_EVENT, got %+v", events)
+	}
+	if volume := e.books[1].VolumeAt(Ask, 10); volume != 8 || e.books[1].bidMax != 0 {
+		t.Fatalf("expected the book untouched, ask volume %d bidMax %d", volume, e.books[1].bidMax)
+	}
+
+	e.Limit(1, Bid, 10, 3, 1, FOK)
+	events = takerEvents(drainOutputEvents(e))
+	if len(events) != 3 || events[2].eventType != EXECUTION_EVENT || events[2].size != 3 {
+		t.Fatalf("expected own order cancelled and 3 executed, got %+v", events)
+	}
+}
+
+func TestSTP_CancelNewestFOKStopsAtOwnOrder(t *testing.T) {
+	e := newTestEngine()
+	e.SetSTPMode(STP_CANCEL_NEWEST)
+
+	e.Limit(1, Ask, 10, 3, 2, GTC)
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	e.Limit(1, Ask, 10, 4, 2, GTC)
+	drainOutputEvents(e)
+
+	// Matching would stop at the own order after 3, so the FOK is rejected untouched
+	e.Limit(1, Bid, 10, 7, 1, FOK)
+	events := takerEvents(drainOutputEvents(e))
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT {
+		t.Fatalf("expected a single REJECT_EVENT, got %+v", events)
+	}
+	if volume := e.books[1].VolumeAt(Ask, 10); volume != 12 || e.books[1].bidMax != 0 {
+		t.Fatalf("expected the book untouched, ask volume %d bidMax %d", volume, e.books[1].bidMax)
+	}
+
+	e.Limit(1, Bid, 10, 3, 1, FOK)
+	events = takerEvents(drainOutputEvents(e))
+	if len(events) != 2 || events[1].eventType != EXECUTION_EVENT || events[1].size != 3 {
+		t.Fatalf("expected 3 executed ahead of the own order, got %+v", events)
+	}
+}
+
+func TestPostOnly_AtOppositeBestRejects(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	drainOutputEvents(e)
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 10, size: 5, trader: 2, postOnly: true})
+
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT {
+		t.Fatalf("expected a single REJECT_EVENT, got %+v", events)
+	}
+	if head := e.pool.get(e.books[1].askLevels[10].headSlot); head.size != 5 {
+		t.Fatalf("expected resting ask untouched, got %+v", head)
+	}
+	if e.books[1].bidMax != 0 {
+		t.Fatalf("rejected post-only order should not rest, bidMax %d", e.books[1].bidMax)
+	}
+}
+
+func TestPostOnly_NonCrossingRests(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 5, 1, GTC)
+	drainOutputEvents(e)
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 11, size: 5, trader: 2, postOnly: true})
+
+	events := drainOutputEvents(e)
+	if len(events) != 2 || events[0].eventType != ORDER_EVENT || events[1].eventType != RESTED_EVENT {
+		t.Fatalf("expected ORDER_EVENT then RESTED_EVENT, got %+v", events)
+	}
+	if e.books[1].askMin != 11 {
+		t.Fatalf("expected post-only ask resting at 11, askMin %d", e.books[1].askMin)
+	}
+}
+
+func TestIceberg_RestsOnlyPeak(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 10, size: 10, peakSize: 3, trader: 1})
+	drainOutputEvents(e)
+
+	order := e.pool.get(e.books[1].askLevels[10].headSlot)
+	if order.size != 3 || order.reserve != 7 {
+		t.Fatalf("expected visible 3 and reserve 7, got size %d reserve %d", order.size, order.reserve)
+	}
+}
+
+func TestIceberg_RefillLosesPriority(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 10, size: 10, peakSize: 3, trader: 1})
+	e.Limit(1, Ask, 10, 4, 2, GTC)
+	events := drainOutputEvents(e)
+	iceberg, other := events[0].orderID, events[2].orderID
+
+	// Fills the visible peak, then the other order, then the refilled peak
+	e.Limit(1, Bid, 10, 9, 3, GTC)
+
+	events = takerEvents(drainOutputEvents(e))
+	if len(events) != 4 {
+		t.Fatalf("expected ORDER_EVENT and 3 executions, got %+v", events)
+	}
+	expected := []struct {
+		counter OrderID
+		size    Size
+	}{{iceberg, 3}, {other, 4}, {iceberg, 2}}
+	for i, exp := range expected {
+		ev := events[i+1]
+		if ev.eventType != EXECUTION_EVENT || ev.counterOrderID != exp.counter || ev.size != exp.size {
+			t.Fatalf("execution %d: expected %d against %d, got %+v", i, exp.size, exp.counter, ev)
+		}
+	}
+
+	order := e.pool.get(Slot(iceberg & SLOT_MASK))
+	if order.size != 1 || order.reserve != 4 || order.filled != 5 {
+		t.Fatalf("expected size 1, reserve 4, filled 5, got %+v", order)
+	}
+}
+
+func TestIceberg_FullyConsumed(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 10, size: 7, peakSize: 2, trader: 1})
+	drainOutputEvents(e)
+
+	// FOK should see the hidden reserve as fillable
+	e.Limit(1, Ask, 10, 7, 2, FOK)
+
+	events := takerEvents(drainOutputEvents(e))
+	var filled Size
+	for _, ev := range events {
+		if ev.eventType == EXECUTION_EVENT {
+			filled += ev.size
+		}
+	}
+	if filled != 7 {
+		t.Fatalf("expected 7 filled against the iceberg, got %d in %+v", filled, events)
+	}
+	if e.books[1].bidMax != 0 || e.books[1].bidLevels[10].headSlot != 0 {
+		t.Fatalf("expected iceberg fully consumed, bidMax %d", e.books[1].bidMax)
+	}
+}
+
+func TestPosition_PartialFillsUpdateBothSides(t *testing.T) {
+	e := newTestEngine()
+
+	// Trader 2 rests 10 on the ask, trader 1 lifts 4 then trader 3 lifts 3
+	e.Limit(1, Ask, 10, 10, 2, GTC)
+	e.Limit(1, Bid, 10, 4, 1, GTC)
+	e.Limit(1, Bid, 11, 3, 3, IOC)
+
+	if pos := e.Position(1, 1); pos != 4 {
+		t.Fatalf("expected trader 1 long 4, got %d", pos)
+	}
+	if pos := e.Position(3, 1); pos != 3 {
+		t.Fatalf("expected trader 3 long 3, got %d", pos)
+	}
+	if pos := e.Position(2, 1); pos != -7 {
+		t.Fatalf("expected trader 2 short 7, got %d", pos)
+	}
+	if pos := e.Position(1, 2); pos != 0 {
+		t.Fatalf("expected no position in an untraded symbol, got %d", pos)
+	}
+	if pos := e.Position(1, MAX_SYMBOLS); pos != 0 {
+		t.Fatalf("expected 0 for an out-of-range symbol, got %d", pos)
+	}
+}
+
+func TestReduceOnly_RejectedWhenFlat(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 10, size: 5, trader: 1, reduceOnly: true})
+
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT {
+		t.Fatalf("expected REJECT_EVENT for a flat trader, got %+v", events)
+	}
+}
+
+func TestReduceOnly_TruncatedToFlat(t *testing.T) {
+	e := newTestEngine()
+
+	// Trader 1 buys 3, ending long 3
+	e.Limit(1, Ask, 10, 3, 2, GTC)
+	e.Limit(1, Bid, 10, 3, 1, GTC)
+	if pos := e.positions[1][1]; pos != 3 {
+		t.Fatalf("expected trader 1 long 3, got %d", pos)
+	}
+	if pos := e.positions[1][2]; pos != -3 {
+		t.Fatalf("expected trader 2 short 3, got %d", pos)
+	}
+	drainOutputEvents(e)
+
+	// A reduce-only buy would grow the long position
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 9, size: 5, trader: 1, reduceOnly: true})
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT {
+		t.Fatalf("expected REJECT_EVENT for a reduce-only buy while long, got %+v", events)
+	}
+
+	// A reduce-only sell of 5 is truncated to 3
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 11, size: 5, trader: 1, reduceOnly: true})
+	events = drainOutputEvents(e)
+	if len(events) != 2 || events[0].eventType != ORDER_EVENT || events[0].size != 3 || events[1].size != 3 {
+		t.Fatalf("expected ORDER_EVENT with adjusted size 3, got %+v", events)
+	}
+	if order := e.pool.get(e.books[1].askLevels[11].headSlot); order.size != 3 {
+		t.Fatalf("expected 3 resting at 11, got %+v", order)
+	}
+}
+
+// Helper to collect the fill size per resting order from a batch of events
+func fillsByCounterOrder(events []OutputEvent) map[OrderID]Size {
+	fills := make(map[OrderID]Size)
+	for _, ev := range events {
+		if ev.eventType == EXECUTION_EVENT {
+			fills[ev.counterOrderID] += ev.size
+		}
+	}
+	return fills
+}
+
+func TestProRata_AllocatesProportionally(t *testing.T) {
+	e := newTestEngine()
+	e.SetMatchMode(PRO_RATA)
+
+	e.Limit(1, Ask, 10, 50, 1, GTC)
+	e.Limit(1, Ask, 10, 30, 2, GTC)
+	e.Limit(1, Ask, 10, 20, 3, GTC)
+	resting := drainOutputEvents(e)
+
+	e.Limit(1, Bid, 10, 10, 4, GTC)
+	fills := fillsByCounterOrder(drainOutputEvents(e))
+
+	for i, want := range []Size{5, 3, 2} {
+		if got := fills[resting[2*i].orderID]; got != want {
+			t.Fatalf("resting order %d: expected fill %d, got %d", i, want, got)
+		}
+	}
+	if e.books[1].bidMax != 0 {
+		t.Fatalf("fully filled bid should not rest, bidMax %d", e.books[1].bidMax)
+	}
+}
+
+func TestProRata_LeftoverGoesToOldest(t *testing.T) {
+	e := newTestEngine()
+	e.SetMatchMode(PRO_RATA)
+
+	e.Limit(1, Ask, 10, 1, 1, GTC)
+	e.Limit(1, Ask, 10, 1, 2, GTC)
+	e.Limit(1, Ask, 10, 1, 3, GTC)
+	resting := drainOutputEvents(e)
+
+	// Each share rounds down to 0, so both lots go to the two oldest orders
+	e.Limit(1, Bid, 10, 2, 4, GTC)
+	fills := fillsByCounterOrder(drainOutputEvents(e))
+
+	if fills[resting[0].orderID] != 1 || fills[resting[2].orderID] != 1 || fills[resting[4].orderID] != 0 {
+		t.Fatalf("expected fills of 1, 1, 0 oldest first, got %v", fills)
+	}
+	if order := e.pool.get(e.books[1].askLevels[10].headSlot); order.id != resting[4].orderID {
+		t.Fatalf("expected only the newest order left resting, got %+v", order)
+	}
+}
+
+func TestProRata_FIFOIsDefault(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	e.Limit(1, Ask, 10, 5, 2, GTC)
+	resting := drainOutputEvents(e)
+
+	e.Limit(1, Bid, 10, 5, 3, GTC)
+	fills := fillsByCounterOrder(drainOutputEvents(e))
+
+	if fills[resting[0].orderID] != 5 || fills[resting[2].orderID] != 0 {
+		t.Fatalf("expected FIFO to fill the first order entirely, got %v", fills)
+	}
+}
+
+func TestLIFO_NewestOrderMatchesFirst(t *testing.T) {
+	for _, mode := range []MatchMode{FIFO, LIFO} {
+		e := newTestEngine()
+		e.SetMatchMode(mode)
+
+		e.Limit(1, Ask, 10, 5, 1, GTC)
+		e.Limit(1, Ask, 10, 5, 2, GTC)
+		e.Limit(1, Ask, 10, 5, 3, GTC)
+		resting := drainOutputEvents(e)
+		oldest, newest := resting[0].orderID, resting[4].orderID
+
+		e.Limit(1, Bid, 10, 7, 4, GTC)
+		fills := fillsByCounterOrder(drainOutputEvents(e))
+
+		first, last := oldest, newest
+		if mode == LIFO {
+			first, last = newest, oldest
+		}
+		if fills[first] != 5 || fills[resting[2].orderID] != 2 || fills[last] != 0 {
+			t.Fatalf("mode %d: expected fills of 5 then 2, got %v", mode, fills)
+		}
+		if err := e.Validate(); err != nil {
+			t.Fatalf("mode %d: %v", mode, err)
+		}
+	}
+}
+
+func TestLIFO_CancelAndIcebergKeepTheQueueLinked(t *testing.T) {
+	e := newTestEngine()
+	e.SetMatchMode(LIFO)
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 10, size: 6, peakSize: 2, trader: 1})
+	iceberg := drainOutputEvents(e)[0].orderID
+	var ids []OrderID
+	for i := 0; i < 4; i++ {
+		e.Limit(1, Ask, 10, 1, 2, GTC)
+		ids = append(ids, drainOutputEvents(e)[0].orderID)
+	}
+
+	// Cancel the head (newest), a middle order and the tail (the iceberg, oldest)
+	e.Cancel(ids[3], 2)
+	e.Cancel(ids[1], 2)
+	if err := e.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if head := e.pool.get(e.books[1].askLevels[10].headSlot); head.id != ids[2] {
+		t.Fatalf("expected the newest remaining order at the head, got %d", head.id)
+	}
+
+	// Taking both remaining 1-lots and the iceberg's peak replenishes it, at the back
+	e.Limit(1, Bid, 10, 4, 3, GTC)
+	fills := fillsByCounterOrder(drainOutputEvents(e))
+	if fills[ids[2]] != 1 || fills[ids[0]] != 1 || fills[iceberg] != 2 {
+		t.Fatalf("expected the 1-lots newest first, then the iceberg's peak, got %v", fills)
+	}
+	e.Limit(1, Ask, 10, 1, 2, GTC)
+	newest := drainOutputEvents(e)[0].orderID
+	e.Limit(1, Bid, 10, 1, 3, GTC)
+	if fills := fillsByCounterOrder(drainOutputEvents(e)); fills[newest] != 1 {
+		t.Fatalf("expected a new order to match ahead of the replenished iceberg, got %v", fills)
+	}
+	if err := e.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTickSize_RejectsOffTickPrice(t *testing.T) {
+	e := newTestEngine()
+	e.SetTickSize(1, 5)
+
+	e.Limit(1, Bid, 12, 1, 1, GTC)
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT || events[0].reason != REJECT_INVALID_TICK {
+		t.Fatalf("expected REJECT_EVENT with REJECT_INVALID_TICK, got %+v", events)
+	}
+
+	e.Limit(1, Bid, 15, 1, 1, GTC)
+	events = drainOutputEvents(e)
+	if len(events) != 2 || events[0].eventType != ORDER_EVENT {
+		t.Fatalf("expected ORDER_EVENT for an on-tick price, got %+v", events)
+	}
+
+	// Other symbols keep the default tick size of 1
+	e.Limit(2, Bid, 12, 1, 1, GTC)
+	events = drainOutputEvents(e)
+	if len(events) != 2 || events[0].eventType != ORDER_EVENT {
+		t.Fatalf("expected ORDER_EVENT on a symbol with the default tick, got %+v", events)
+	}
+}
+
+func TestSizeLimits_RejectOutsideRange(t *testing.T) {
+	e := newTestEngine()
+	e.SetSizeLimits(1, 10, 100)
+
+	for _, size := range []Size{9, 101} {
+		e.Limit(1, Bid, 10, size, 1, GTC)
+		events := drainOutputEvents(e)
+		if len(events) != 1 || events[0].eventType != REJECT_EVENT || events[0].reason != REJECT_INVALID_SIZE {
+			t.Fatalf("size %d: expected REJECT_EVENT with REJECT_INVALID_SIZE, got %+v", size, events)
+		}
+	}
+
+	for _, size := range []Size{10, 100} {
+		e.Limit(1, Bid, 10, size, 1, GTC)
+		events := drainOutputEvents(e)
+		if len(events) != 2 || events[0].eventType != ORDER_EVENT {
+			t.Fatalf("size %d: expected ORDER_EVENT within limits, got %+v", size, events)
+		}
+	}
+}
+
+func TestOrderStatus_LiveFilledAndUnknown(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	id := drainOutputEvents(e)[0].orderID
+
+	exists, remaining, price, symbol, side := e.OrderStatus(id)
+	if !exists || remaining != 5 || price != 10 || symbol != 1 || side != Ask {
+		t.Fatalf("expected live ask of 5 at 10, got %v %d %d %d %d", exists, remaining, price, symbol, side)
+	}
+
+	e.Limit(1, Bid, 10, 2, 2, GTC)
+	if exists, remaining, _, _, _ := e.OrderStatus(id); !exists || remaining != 3 {
+		t.Fatalf("expected 3 remaining after a partial fill, got %v %d", exists, remaining)
+	}
+
+	e.Limit(1, Bid, 10, 3, 2, GTC)
+	if exists, _, _, _, _ := e.OrderStatus(id); exists {
+		t.Fatalf("expected a filled order to no longer exist")
+	}
+
+	// Recycling freed slots issues new IDs; the old one stays unknown
+	for i := 0; i < 3; i++ {
+		e.Limit(1, Ask, 10, 5, 1, GTC)
+	}
+	for _, ev := range drainOutputEvents(e) {
+		if ev.eventType == ORDER_EVENT && ev.orderID == id {
+			t.Fatalf("expected a recycled slot to get a new ID")
+		}
+	}
+	if exists, _, _, _, _ := e.OrderStatus(id); exists {
+		t.Fatalf("expected the old ID to stay unknown after its slot is recycled")
+	}
+
+	if exists, _, _, _, _ := e.OrderStatus(OrderID(12345)); exists {
+		t.Fatalf("expected a never-issued ID to not exist")
+	}
+}
+
+func TestReduceOnly_AmendCannotGrow(t *testing.T) {
+	e := newTestEngine()
+
+	// Trader 1 ends long 3, then rests a reduce-only sell of 3
+	e.Limit(1, Ask, 10, 3, 2, GTC)
+	e.Limit(1, Bid, 10, 3, 1, GTC)
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 11, size: 3, trader: 1, reduceOnly: true})
+	id := drainOutputEvents(e)[5].orderID
+
+	e.Amend(id, 11, 5, 1)
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT {
+		t.Fatalf("expected REJECT_EVENT for growing a reduce-only order, got %+v", events)
+	}
+
+	e.Amend(id, 12, 2, 1)
+	events = drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != AMEND_EVENT {
+		t.Fatalf("expected AMEND_EVENT for shrinking a reduce-only order, got %+v", events)
+	}
+}
+
+func TestRejectReasons_EveryPath(t *testing.T) {
+	e := newTestEngine()
+	e.SetSTPMode(STP_REJECT_AGGRESSOR)
+	e.SetTickSize(3, 5)
+	e.SetPriceBand(4, 100)
+	e.SetReferencePrice(4, 100)
+	e.Halt(2)
+	e.StartAuction(5)
+	e.Disable(9)
+
+	// Trader 4 buys 2 of trader 1's ask, then rests a reduce-only sell; trader 1 also rests a bid
+	// and trader 3 a dormant buy stop
+	limit(e, 1, Ask, 100, 10, 1, GTC)
+	limit(e, 1, Bid, 100, 2, 4, GTC)
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 120, size: 2, trader: 4, reduceOnly: true})
+	limit(e, 1, Bid, 90, 5, 1, GTC)
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 151, stopPrice: 150, size: 5, trader: 3})
+
+	var ids []OrderID
+	for _, ev := range drainOutputEvents(e) {
+		if ev.eventType == ORDER_EVENT {
+			ids = append(ids, ev.orderID)
+		}
+	}
+	ask, reduceOnly, bid, stop := ids[0], ids[2], ids[3], ids[4]
+
+	cases := []struct {
+		name string
+		want RejectReason
+		run  func()
+	}{
+		{"zero price", REJECT_INVALID_PRICE, func() { limit(e, 1, Bid, 0, 5, 2, GTC) }},
+		{"price beyond levels", REJECT_INVALID_PRICE, func() { limit(e, 1, Bid, DEFAULT_PRICE_LEVELS, 5, 2, GTC) }},
+		{"stop price beyond levels", REJECT_INVALID_PRICE, func() {
+			e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 10, stopPrice: DEFAULT_PRICE_LEVELS, size: 5, trader: 2})
+		}},
+		{"unknown symbol", REJECT_UNKNOWN_SYMBOL, func() { limit(e, MAX_SYMBOLS, Bid, 10, 5, 2, GTC) }},
+		{"market unknown symbol", REJECT_UNKNOWN_SYMBOL, func() { e.Market(&InputCommand{symbol: MAX_SYMBOLS, side: Bid, size: 5, trader: 2}) }},
+		{"invalid side", REJECT_INVALID_SIDE, func() { limit(e, 1, 2, 10, 5, 2, GTC) }},
+		{"market invalid side", REJECT_INVALID_SIDE, func() { e.Market(&InputCommand{symbol: 1, side: 2, size: 5, trader: 2}) }},
+		{"gtd without expiry", REJECT_INVALID_EXPIRY, func() { limit(e, 1, Bid, 10, 5, 2, GTD) }},
+		{"zero size", REJECT_INVALID_SIZE, func() { limit(e, 1, Bid, 10, 0, 2, GTC) }},
+		{"off tick", REJECT_INVALID_TICK, func() { limit(e, 3, Bid, 7, 5, 2, GTC) }},
+		{"outside band", REJECT_PRICE_BAND, func() { limit(e, 4, Bid, 200, 5, 2, GTC) }},
+		{"halted", REJECT_HALTED, func() { limit(e, 2, Bid, 10, 5, 2, GTC) }},
+		{"disabled trader", REJECT_TRADER_DISABLED, func() { limit(e, 1, Bid, 10, 5, 9, GTC) }},
+		{"market in auction", REJECT_AUCTION, func() { e.Market(&InputCommand{symbol: 5, side: Bid, size: 5, trader: 2}) }},
+		{"reduce-only when flat", REJECT_REDUCE_ONLY, func() {
+			e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 110, size: 5, trader: 2, reduceOnly: true})
+		}},
+		{"fok unfillable", REJECT_FOK_UNFILLABLE, func() { limit(e, 1, Bid, 100, 20, 2, FOK) }},
+		{"self-trade", REJECT_SELF_TRADE, func() { limit(e, 1, Bid, 100, 1, 1, GTC) }},
+		{"post-only cross", REJECT_POST_ONLY_CROSS, func() {
+			e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 100, size: 1, trader: 2, postOnly: true})
+		}},
+		{"cancel unknown", REJECT_UNKNOWN_ORDER, func() { e.Cancel(12345, 2) }},
+		{"amend unknown", REJECT_UNKNOWN_ORDER, func() { e.Amend(12345, 100, 5, 1) }},
+		{"amend zero price", REJECT_INVALID_PRICE, func() { e.Amend(ask, 0, 5, 1) }},
+		{"amend pending stop", REJECT_NOT_AMENDABLE, func() { e.Amend(stop, 151, 3, 3) }},
+		{"amend to filled size", REJECT_INVALID_SIZE, func() { e.Amend(ask, 100, 2, 1) }},
+		{"amend reduce-only up", REJECT_REDUCE_ONLY, func() { e.Amend(reduceOnly, 120, 5, 4) }},
+		{"amend into self-trade", REJECT_SELF_TRADE, func() { e.Amend(bid, 100, 5, 1) }},
+	}
+	for _, c := range cases {
+		c.run()
+		events := drainOutputEvents(e)
+		if len(events) != 1 || events[0].eventType != REJECT_EVENT || events[0].reason != c.want {
+			t.Fatalf("%s: expected one REJECT_EVENT with reason %v, got %+v", c.name, c.want, events)
+		}
+	}
+}
+
+func TestExecution_ReportsTakerAndMaker(t *testing.T) {
+	e := newTestEngine()
+
+	limit(e, 1, Ask, 100, 10, 7, GTC)
+	limit(e, 1, Bid, 100, 4, 3, GTC)
+
+	events := drainOutputEvents(e)
+	exec := events[3]
+	if exec.eventType != EXECUTION_EVENT || exec.maker {
+		t.Fatalf("expected a taker EXECUTION_EVENT, got %+v", exec)
+	}
+	if exec.orderID != events[2].orderID || exec.trader != 3 || exec.side != Bid {
+		t.Fatalf("expected the taker to be trader 3's bid, got %+v", exec)
+	}
+	if exec.counterOrderID != events[0].orderID || exec.counterTrader != 7 {
+		t.Fatalf("expected the maker to be trader 7's resting ask, got %+v", exec)
+	}
+}
+
+func TestExecution_PartialFillReportsBothSides(t *testing.T) {
+	e := newTestEngine()
+	e.SetFees(-1, 3)
+
+	limit(e, 1, Ask, 100, 10, 7, GTC)
+	limit(e, 1, Bid, 100, 4, 3, GTC) // Partly consumes the resting ask
+
+	events := drainOutputEvents(e)
+	if len(events) != 5 {
+		t.Fatalf("expected the resting ask, the bid and a pair of executions, got %+v", events)
+	}
+	taker, maker := events[3], events[4]
+	if taker.eventType != EXECUTION_EVENT || taker.maker || maker.eventType != EXECUTION_EVENT || !maker.maker {
+		t.Fatalf("expected a taker then a maker EXECUTION_EVENT, got %+v and %+v", taker, maker)
+	}
+	if maker.tradeID != taker.tradeID || maker.price != taker.price || maker.size != 4 || taker.size != 4 {
+		t.Fatalf("expected both reports of the same 4 @ 100 trade, got %+v and %+v", taker, maker)
+	}
+	if maker.orderID != taker.counterOrderID || maker.counterOrderID != taker.orderID ||
+		maker.trader != 7 || maker.counterTrader != 3 || maker.side != Ask {
+		t.Fatalf("expected the maker report addressed to trader 7's ask, got %+v", maker)
+	}
+	if maker.fee != taker.counterFee || maker.counterFee != taker.fee {
+		t.Fatalf("expected the maker report to swap the fees, got %+v and %+v", taker, maker)
+	}
+
+	// The maker's remaining 6 fill later under a new trade id
+	if exists, size, _, _, _ := e.OrderStatus(maker.orderID); !exists || size != 6 {
+		t.Fatalf("expected 6 left resting, got exists=%v size=%d", exists, size)
+	}
+	limit(e, 1, Bid, 100, 6, 4, GTC)
+	events = drainOutputEvents(e)
+	if len(events) != 3 || events[2].orderID != maker.orderID || events[2].size != 6 || events[2].tradeID != taker.tradeID+1 {
+		t.Fatalf("expected the rest of the maker's order reported under trade %d, got %+v", taker.tradeID+1, events)
+	}
+}
+
+func TestRested_OnlyForRestingRemainder(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 10, size: 10, peakSize: 4, trader: 1})
+	limit(e, 1, Bid, 10, 6, 2, GTC) // Fully filled: no RESTED_EVENT
+	limit(e, 1, Bid, 10, 9, 3, GTC) // Takes the last 4, then rests 5
+
+	var rested []OutputEvent
+	for _, ev := range drainOutputEvents(e) {
+		if ev.eventType == RESTED_EVENT {
+			rested = append(rested, ev)
+		}
+	}
+	if len(rested) != 2 {
+		t.Fatalf("expected RESTED_EVENTs for the iceberg and the partly filled bid only, got %+v", rested)
+	}
+	if ev := rested[0]; ev.trader != 1 || ev.side != Ask || ev.size != 4 {
+		t.Fatalf("expected the iceberg to rest its 4 lot peak, got %+v", ev)
+	}
+	if ev := rested[1]; ev.trader != 3 || ev.side != Bid || ev.price != 10 || ev.size != 5 {
+		t.Fatalf("expected the bid's unfilled 5 to rest at 10, got %+v", ev)
+	}
+}
+
+func TestClOrdID_EchoedOnEveryEventAndCancellable(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 100, size: 10, trader: 1, clOrdID: 501})
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 100, size: 4, trader: 2, clOrdID: 902})
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 0, size: 4, trader: 2, clOrdID: 903})
+
+	events := drainOutputEvents(e)
+	want := []struct {
+		eventType EventType
+		clOrdID   uint64
+	}{{ORDER_EVENT, 501}, {RESTED_EVENT, 501}, {ORDER_EVENT, 902}, {EXECUTION_EVENT, 902}, {EXECUTION_EVENT, 501}, {REJECT_EVENT, 903}}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, w := range want {
+		if events[i].eventType != w.eventType || events[i].clOrdID != w.clOrdID {
+			t.Fatalf("event %d: expected %v echoing %d, got %+v", i, w.eventType, w.clOrdID, events[i])
+		}
+	}
+
+	// Client order IDs are per trader, and the entry is gone once the order is
+	e.CancelByClOrdID(2, 501)
+	e.dispatch(&InputCommand{eventType: CANCEL_EVENT, trader: 1, clOrdID: 501})
+	e.CancelByClOrdID(1, 501)
+	events = drainOutputEvents(e)
+	if len(events) != 3 || events[0].eventType != REJECT_EVENT || events[0].reason != REJECT_UNKNOWN_ORDER ||
+		events[1].eventType != CANCEL_EVENT || events[1].clOrdID != 501 || events[1].size != 6 || events[2].eventType != REJECT_EVENT {
+		t.Fatalf("expected a reject for the wrong trader, the cancel, then a reject once gone, got %+v", events)
+	}
+	if len(e.pool.clOrdIDs) != 0 {
+		t.Fatalf("expected no client order IDs left indexed, got %v", e.pool.clOrdIDs)
+	}
+}
+
+func TestClOrdID_ReuseAddressesNewestOrder(t *testing.T) {
+	e := newTestEngine()
+
+	older, _ := e.TryLimitCommand(&InputCommand{symbol: 1, side: Bid, price: 90, size: 1, trader: 1, clOrdID: 7})
+	newer, _ := e.TryLimitCommand(&InputCommand{symbol: 1, side: Bid, price: 91, size: 1, trader: 1, clOrdID: 7})
+	drainOutputEvents(e)
+
+	var snap bytes.Buffer
+	if err := e.SaveSnapshot(&snap); err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	restored := newTestEngine()
+	if err := restored.LoadSnapshot(&snap); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	for _, eng := range []*MatchingEngine{e, restored} {
+		eng.CancelByClOrdID(1, 7)
+		if events := drainOutputEvents(eng); len(events) != 1 || events[0].orderID != newer {
+			t.Fatalf("expected the newer order cancelled, got %+v", events)
+		}
+		if exists, _, _, _, _ := eng.OrderStatus(older); !exists {
+			t.Fatalf("expected the older order left working")
+		}
+
+		// The older order has lost the ID to the newer one, so it is only reachable by OrderID
+		eng.CancelByClOrdID(1, 7)
+		if events := drainOutputEvents(eng); len(events) != 1 || events[0].eventType != REJECT_EVENT {
+			t.Fatalf("expected a reject once the newer order is gone, got %+v", events)
+		}
+	}
+}
+
+func TestQueuePosition_CountsOrdersAheadAtTheLevel(t *testing.T) {
+	e := newTestEngine()
+
+	limit(e, 1, Ask, 100, 5, 1, GTC)
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 100, size: 20, peakSize: 3, trader: 2})
+	limit(e, 1, Ask, 100, 7, 3, GTC)
+	limit(e, 1, Ask, 101, 9, 4, GTC)
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 110, stopPrice: 90, size: 1, trader: 5})
+	var ids []OrderID
+	for _, ev := range drainOutputEvents(e) {
+		if ev.eventType == ORDER_EVENT {
+			ids = append(ids, ev.orderID)
+		}
+	}
+	first, iceberg, last, other, stop := ids[0], ids[1], ids[2], ids[3], ids[4]
+
+	cases := []struct {
+		name   string
+		id     OrderID
+		orders int
+		volume Size
+		ok     bool
+	}{
+		{"head of level", first, 0, 0, true},
+		{"behind one", iceberg, 1, 5, true},
+		{"behind an iceberg's peak", last, 2, 8, true},
+		{"alone at its level", other, 0, 0, true},
+		{"pending stop", stop, 0, 0, false},
+		{"unknown", 12345, 0, 0, false},
+	}
+	for _, c := range cases {
+		if orders, volume, ok := e.QueuePosition(c.id); orders != c.orders || volume != c.volume || ok != c.ok {
+			t.Fatalf("%s: expected (%d, %d, %v), got (%d, %d, %v)", c.name, c.orders, c.volume, c.ok, orders, volume, ok)
+		}
+	}
+
+	// A fill of the head moves everyone up; a cancelled order has no position
+	limit(e, 1, Bid, 100, 5, 6, GTC)
+	e.Cancel(iceberg, 2)
+	if orders, volume, ok := e.QueuePosition(last); orders != 0 || volume != 0 || !ok {
+		t.Fatalf("expected the last order at the head after the fill and cancel, got (%d, %d, %v)", orders, volume, ok)
+	}
+	if _, _, ok := e.QueuePosition(first); ok {
+		t.Fatal("expected no position for a filled order")
+	}
+	if _, _, ok := e.QueuePosition(iceberg); ok {
+		t.Fatal("expected no position for a cancelled order")
+	}
+}
+
+func TestEngineValidate_HoldsAfterRandomOperations(t *testing.T) {
+	e := newTestEngineWithConfig(EngineConfig{priceLevels: 256, sparseBooks: true, volumeTrees: true})
+	rng := rand.New(rand.NewSource(1))
+	var ids []OrderID
+	owners := make(map[OrderID]TraderID)
+	price := func() Price { return Price(90 + rng.Intn(21)) }
+
+	for i := 0; i < 4000; i++ {
+		symbol, side, trader := Symbol(1+rng.Intn(2)), Side(rng.Intn(2)), TraderID(rng.Intn(5))
+		cmd := &InputCommand{symbol: symbol, side: side, price: price(), size: Size(1 + rng.Intn(20)), trader: trader}
+		if rng.Intn(4) == 0 {
+			cmd.groupID = uint64(1 + rng.Intn(3))
+		}
+
+		switch op := rng.Intn(40); {
+		case op < 14 || len(ids) == 0:
+			if rng.Intn(4) == 0 {
+				cmd.peakSize = Size(1 + rng.Intn(5))
+			}
+			if rng.Intn(5) == 0 {
+				cmd.tif = IOC
+			}
+			e.LimitCommand(cmd)
+		case op < 17:
+			e.Market(cmd)
+		case op < 21: // Stops, a third of them trailing
+			cmd.stopPrice = price()
+			if rng.Intn(3) == 0 {
+				cmd.stopPrice, cmd.trailOffset = 0, Price(1+rng.Intn(5))
+			}
+			if rng.Intn(2) == 0 {
+				e.Market(cmd)
+			} else {
+				e.LimitCommand(cmd)
+			}
+		case op < 26:
+			id := ids[rng.Intn(len(ids))]
+			e.Cancel(id, owners[id])
+		case op < 28:
+			id := ids[rng.Intn(len(ids))]
+			e.CancelQty(id, Size(1+rng.Intn(10)), owners[id])
+		case op < 32:
+			id := ids[rng.Intn(len(ids))]
+			e.Amend(id, price(), Size(1+rng.Intn(30)), owners[id])
+		case op < 35:
+			id := ids[rng.Intn(len(ids))]
+			e.Replace(id, symbol, side, price(), Size(1+rng.Intn(20)), owners[id], GTC)
+		case op < 37:
+			e.CancelGroup(trader, uint64(1+rng.Intn(3)))
+		case op < 39:
+			if e.auctions[symbol] {
+				e.Uncross(symbol)
+			} else {
+				e.StartAuction(symbol)
+			}
+		default:
+			e.CancelSymbol(symbol)
+		}
+
+		for _, ev := range drainOutputEvents(e) {
+			if ev.eventType == ORDER_EVENT {
+				ids = append(ids, ev.orderID)
+				owners[ev.orderID] = ev.trader
+			}
+		}
+		if err := e.Validate(); err != nil {
+			t.Fatalf("after op %d: %v", i, err)
+		}
+	}
+}
+
+func TestEngineValidate_ReportsLeakedAndFreedSlots(t *testing.T) {
+	e := newTestEngineWithConfig(EngineConfig{priceLevels: 256, sparseBooks: true})
+	limit(e, 1, Bid, 100, 5, 1, GTC)
+	e.Market(&InputCommand{symbol: 1, side: Ask, size: 5, stopPrice: 90, trader: 2})
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid engine, got %v", err)
+	}
+
+	leaked, _, _ := e.pool.alloc()
+	if err := e.Validate(); !errors.Is(err, ErrBookInvalid) {
+		t.Fatalf("expected an allocated slot outside every book to be reported, got %v", err)
+	}
+	e.pool.free(leaked)
+
+	e.pool.free(e.books[1].sellStops[0].slot) // Freed while still pending
+	if err := e.Validate(); !errors.Is(err, ErrBookInvalid) {
+		t.Fatalf("expected a free slot in a stop list to be reported, got %v", err)
+	}
+}
@@ -8,11 +8,54 @@ const (
 type EventType uint8
 
 const (
-	INVALID_EVENT   EventType = iota // Invalid event (in default 'zero' position)
-	ORDER_EVENT                      // Order creation
-	CANCEL_EVENT                     // Order cancellation
-	EXECUTION_EVENT                  // Trade execution
-	REJECT_EVENT                     // Order rejection
+	INVALID_EVENT     EventType = iota // Invalid event (in default 'zero' position)
+	ORDER_EVENT                        // Order creation
+	CANCEL_EVENT                       // Order cancellation
+	EXECUTION_EVENT                    // Trade execution
+	REJECT_EVENT                       // Order rejection
+	AMEND_EVENT                        // Order amendment (price and/or size)
+	REPLACE_EVENT                      // Atomic cancel of one order and submission of another
+	MARKET_EVENT                       // Market order creation
+	EXPIRE_EVENT                       // Expiry sweep of GTD orders (input only)
+	HALT_EVENT                         // Trading halt of a symbol
+	RESUME_EVENT                       // Trading resumed on a halted symbol
+	AUCTION_EVENT                      // Call auction started on a symbol (orders rest without matching)
+	UNCROSS_EVENT                      // Call auction uncrossed at a single price, resuming continuous trading
+	MASS_CANCEL_EVENT                  // Cancel every working order of a trader (output size is how many were cancelled)
+	DISABLE_EVENT                      // Trader disabled by the kill switch (cancels only)
+	ENABLE_EVENT                       // Trader re-enabled after the kill switch
+	RESTED_EVENT                       // Unfilled remainder of an order added to the book (size is the displayed quantity)
+	LEVEL_UPDATE                       // A price level's new aggregate visible size, 0 once cleared (see SetLevelUpdates)
+	AGG_FILL_EVENT                     // Summary of every fill of one aggressive order on entry or amend (see SetFillSummaries)
+	QUERY_EVENT                        // Read of engine state on the matching goroutine (input only, see Query)
+)
+
+// Why an order or command was rejected (carried on REJECT_EVENT)
+type RejectReason uint8
+
+const (
+	REJECT_UNSPECIFIED     RejectReason = iota // No specific reason recorded
+	REJECT_INVALID_TICK                        // Price is not a multiple of the symbol's tick size
+	REJECT_INVALID_SIZE                        // Size is outside the symbol's order size limits (or, for an amend, not above the filled size)
+	REJECT_POOL_EXHAUSTED                      // Every order slot holds a live order
+	REJECT_HALTED                              // The symbol is halted (cancels are still accepted)
+	REJECT_PRICE_BAND                          // Price is outside the symbol's band around its reference price
+	REJECT_AUCTION                             // Order type cannot rest in a call auction (market, IOC, FOK, post-only)
+	REJECT_INVALID_PRICE                       // Limit or stop price is zero or beyond the engine's price levels (see EngineConfig)
+	REJECT_UNKNOWN_SYMBOL                      // Symbol is beyond MAX_SYMBOLS
+	REJECT_INVALID_EXPIRY                      // Good-till-date order without an expiry time
+	REJECT_REDUCE_ONLY                         // Reduce-only order would not reduce the trader's position
+	REJECT_FOK_UNFILLABLE                      // Fill-or-kill order cannot be filled in full on entry
+	REJECT_SELF_TRADE                          // Would trade against the same trader's resting order (STP_REJECT_AGGRESSOR)
+	REJECT_POST_ONLY_CROSS                     // Post-only order would execute on entry
+	REJECT_UNKNOWN_ORDER                       // Order ID is unknown, stale, or already filled or cancelled
+	REJECT_NOT_AMENDABLE                       // Order cannot be amended in its current state (a pending stop)
+	REJECT_CROSS_SHARD                         // Replace would move the order to a symbol on another shard
+	REJECT_TRADER_DISABLED                     // The trader is disabled by the kill switch (cancels are still accepted)
+	REJECT_RATE_LIMITED                        // Trader exceeded its command rate (see RateLimiter); not emitted by the engine itself
+	REJECT_NOT_OWNER                           // Cancel names an order placed by another trader
+	REJECT_UNKNOWN_COMMAND                     // Input command's event type is not a command (eg. a zeroed InputCommand)
+	REJECT_INVALID_SIDE                        // Side is neither Bid nor Ask
 )
 
 // Output event sent by matching engine to report something (eg. Order, execution)
@@ -20,48 +63,131 @@ type OutputEvent struct {
 	orderID        OrderID
 	price          Price
 	size           Size
+	prevPrice      Price   // For amends (price before the amendment)
+	prevSize       Size    // For amends (total size before the amendment) and partial cancels (open size before the cut)
 	counterOrderID OrderID // For executions (counterparty OrderID)
+	tradeID        TradeID // For executions (unique per print)
+	clOrdID        uint64  // Client order ID of orderID (0 if none was given)
+	fee            int64   // For executions (charged to trader, negative for a rebate; see SetFees), and the total for fill summaries
+	notional       uint64  // For fill summaries (sum of price * size over the fills)
+	fills          uint32  // For fill summaries (number of fills, one per resting order hit)
+	counterFee     int64   // For executions (charged to counterTrader)
 	trader         TraderID
+	counterTrader  TraderID // For executions (counterparty trader)
 	symbol         Symbol
 	eventType      EventType
-	side           Side
+	side           Side         // For executions, the side of orderID (the aggressor's, unless maker)
+	reason         RejectReason // For rejects
+	cancelFailed   bool         // For replaces (the replaced order was already gone)
+	maker          bool         // For executions (orderID is the resting order; each fill has a taker and a maker report)
 }
 
 // Input command received by matching engine (related to exchange Order struct)
 type InputCommand struct {
-	price     Price
-	size      Size
-	orderID   OrderID // To allow cancels, not for providing a custom OrderID
-	symbol    Symbol
-	trader    TraderID
-	eventType EventType
-	side      Side
+	price       Price
+	size        Size    // Order size, or for a cancel the quantity to cancel (0 cancels the whole order)
+	peakSize    Size    // Iceberg visible quantity (0 shows the full size)
+	stopPrice   Price   // Stop trigger price (0 for an order that is live immediately)
+	trailOffset Price   // Trailing stop distance behind the best trade price since entry (0 for a fixed stopPrice)
+	expiresAt   int64   // GTD expiry time, or the sweep time for an EXPIRE_EVENT (unix nanos)
+	orderID     OrderID // To allow cancels, amends and replaces, not for providing a custom OrderID
+	clOrdID     uint64  // Client's own order ID, echoed on the order's events (a cancel with orderID 0 addresses it)
+	groupID     uint64  // OCO group among the trader's orders, 0 for none (a cancel with orderID 0 cancels the group)
+	token       uint64  // Correlation token of a Submit call awaiting the result (0 for none; never framed or logged)
+	symbol      Symbol
+	trader      TraderID
+	eventType   EventType
+	side        Side
+	tif         TimeInForce
+	postOnly    bool // Reject rather than execute on entry (only ever adds liquidity)
+	reduceOnly  bool // Only ever reduce the trader's net position (truncated to reach flat)
 }
 
-// StartInputDistributor distributes input commands to the matching engine
+// StartInputDistributor distributes input commands to the matching engine. After Stop it applies
+// any commands still queued, closes the output ring and returns
 func (e *MatchingEngine) StartInputDistributor() {
+	defer e.pinThread(INPUT_THREAD)()
 	buf := make([]InputCommand, DISTRIBUTOR_BUFFER)
 	for {
 		n := e.inputRing.Read(buf)
+		if n == 0 {
+			e.outputRing.Close()
+			return
+		}
 		for i := 0; uint32(i) < n; i++ {
-			ev := &buf[i]
-			switch ev.eventType {
-			case ORDER_EVENT: // New order command
-				e.Limit(ev.symbol, ev.side, ev.price, ev.size, ev.trader)
-			case CANCEL_EVENT: // New cancel command
-				e.Cancel(ev.orderID)
-			}
+			e.dispatch(&buf[i])
+		}
+	}
+}
+
+// Stop shuts the engine down: the input distributor applies the commands already queued, then both
+// distributors return once their rings drain. Commands pushed after Stop are dropped, so producers
+// (including StartExpirySweeper) should be stopped first. Safe to call more than once
+func (e *MatchingEngine) Stop() {
+	e.inputRing.Close()
+}
+
+// Apply one input command to the matching engine
+func (e *MatchingEngine) dispatch(ev *InputCommand) {
+	switch ev.eventType {
+	case ORDER_EVENT: // New order command
+		id, reason := e.limitCommand(ev)
+		e.complete(ev.token, id, reason)
+	case MARKET_EVENT: // New market order command
+		id, reason := e.marketCommand(ev)
+		e.complete(ev.token, id, reason)
+	case CANCEL_EVENT: // New cancel command
+		if ev.orderID == 0 && ev.groupID != 0 {
+			e.CancelGroup(ev.trader, ev.groupID)
+		} else if ev.orderID == 0 && ev.clOrdID != 0 {
+			e.CancelByClOrdID(ev.trader, ev.clOrdID)
+		} else if ev.size != 0 {
+			e.CancelQty(ev.orderID, ev.size, ev.trader)
+		} else {
+			e.Cancel(ev.orderID, ev.trader)
 		}
+	case AMEND_EVENT: // New amend command
+		e.Amend(ev.orderID, ev.price, ev.size, ev.trader)
+	case REPLACE_EVENT: // New cancel-replace command
+		e.ReplaceCommand(ev)
+	case EXPIRE_EVENT: // Expiry sweep command
+		e.Expire(ev.expiresAt)
+	case HALT_EVENT: // Trading halt command
+		e.Halt(ev.symbol)
+	case RESUME_EVENT: // Trading resume command
+		e.Resume(ev.symbol)
+	case AUCTION_EVENT: // Call auction start command
+		e.StartAuction(ev.symbol)
+	case UNCROSS_EVENT: // Call auction uncross command
+		e.Uncross(ev.symbol)
+	case MASS_CANCEL_EVENT: // Cancel all of a trader's orders
+		e.CancelAll(ev.trader)
+	case DISABLE_EVENT: // Trader kill switch command
+		e.Disable(ev.trader)
+	case ENABLE_EVENT: // Trader re-enable command
+		e.Enable(ev.trader)
+	case QUERY_EVENT: // Read of engine state between commands
+		e.runQuery(ev.token)
+	default: // Not a command (INVALID_EVENT or an output-only type), so reject rather than drop it
+		e.reject(OutputEvent{eventType: REJECT_EVENT, orderID: ev.orderID, clOrdID: ev.clOrdID, trader: ev.trader, symbol: ev.symbol, reason: REJECT_UNKNOWN_COMMAND})
 	}
 }
 
-// StartOutputDistributor distributes output events from the matching engine
+// StartOutputDistributor distributes output events from the matching engine. Returns once the input
+// distributor has shut down and every event it produced has been delivered
 func (e *MatchingEngine) StartOutputDistributor(callbackFunc func(OutputEvent)) {
+	defer e.pinThread(OUTPUT_THREAD)()
 	buf := make([]OutputEvent, DISTRIBUTOR_BUFFER)
 	for {
 		n := e.outputRing.Read(buf)
+		if n == 0 {
+			return
+		}
 		for i := 0; uint32(i) < n; i++ {
 			callbackFunc(buf[i]) // Call callbackFunc for each output event
+			if e.onTrade != nil && buf[i].eventType == EXECUTION_EVENT && !buf[i].maker {
+				e.onTrade(tradeOf(&buf[i]))
+			}
 		}
 	}
 }
@@ -8,30 +8,19 @@ import (
 // Helper to read one or more OutputEvent(s) from the engine.outputRing with timeout.
 // Returns the slice of read events or nil on timeout.
 func readOutputEvents(e *MatchingEngine, max int, timeout time.Duration) []OutputEvent {
-	resCh := make(chan []OutputEvent, 1)
-
-	go func() {
-		buf := make([]OutputEvent, max)
-		n := e.outputRing.Read(buf)
-		events := make([]OutputEvent, n)
-		for i := 0; i < int(n); i++ {
-			events[i] = buf[i]
-		}
-		resCh <- events
-	}()
-
-	select {
-	case evs := <-resCh:
-		return evs
-	case <-time.After(timeout):
+	buf := make([]OutputEvent, max)
+	n := e.outputRing.ReadTimeout(buf, timeout)
+	if n == 0 {
 		return nil
 	}
+	return buf[:n]
 }
 
 func TestStartInputDistributor_OrderProducesOrderEvent(t *testing.T) {
-	e := NewMatchingEngine()
+	e := newTestEngine()
 
 	go e.StartInputDistributor()
+	defer e.Stop()
 
 	// Push an InputCommand into inputRing.
 	cmd := InputCommand{
@@ -66,9 +55,10 @@ func TestStartInputDistributor_OrderProducesOrderEvent(t *testing.T) {
 }
 
 func TestStartInputDistributor_CancelProducesCancelEvent(t *testing.T) {
-	e := NewMatchingEngine()
+	e := newTestEngine()
 
 	go e.StartInputDistributor()
+	defer e.Stop()
 
 	// 1) Create an order first by sending an ORDER_EVENT command.
 	createCmd := InputCommand{
@@ -112,6 +102,7 @@ loopCreate:
 	cancelCmd := InputCommand{
 		eventType: CANCEL_EVENT,
 		orderID:   createdOrderID,
+		trader:    9,
 	}
 	e.inputRing.Push(cancelCmd)
 
@@ -137,8 +128,33 @@ loopCreate:
 	}
 }
 
+func TestStartInputDistributor_UnknownCommandIsRejected(t *testing.T) {
+	e := newTestEngine()
+
+	e.inputRing.Push(InputCommand{eventType: INVALID_EVENT, trader: 3, clOrdID: 42})   // A zeroed command, bar the sender
+	e.inputRing.Push(InputCommand{eventType: EXECUTION_EVENT, trader: 3, orderID: 17}) // Output-only type
+	e.Stop()
+	e.StartInputDistributor() // Applies the queued commands, then returns
+
+	events := drainOutputEvents(e)
+	if len(events) != 2 {
+		t.Fatalf("expected a reject per command, got %+v", events)
+	}
+	for _, ev := range events {
+		if ev.eventType != REJECT_EVENT || ev.reason != REJECT_UNKNOWN_COMMAND || ev.trader != 3 {
+			t.Fatalf("expected an unknown command reject for trader 3, got %+v", ev)
+		}
+	}
+	if events[0].clOrdID != 42 || events[1].orderID != 17 {
+		t.Fatalf("expected the rejects to echo the commands' IDs, got %+v", events)
+	}
+	if stats := e.Stats(); stats.rejected != 2 {
+		t.Fatalf("expected 2 rejects counted, got %d", stats.rejected)
+	}
+}
+
 func TestStartOutputDistributor_CallbackInvoked(t *testing.T) {
-	e := NewMatchingEngine()
+	e := newTestEngine()
 
 	// Channel to capture callback invocations.
 	cbCh := make(chan OutputEvent, 4)
@@ -147,6 +163,7 @@ func TestStartOutputDistributor_CallbackInvoked(t *testing.T) {
 	go e.StartOutputDistributor(func(ev OutputEvent) {
 		cbCh <- ev
 	})
+	defer e.outputRing.Close()
 
 	// Push an OutputEvent into the engine's output ring.
 	out := OutputEvent{
@@ -165,3 +182,39 @@ func TestStartOutputDistributor_CallbackInvoked(t *testing.T) {
 		t.Fatalf("timed out waiting for callback invocation")
 	}
 }
+
+func TestStop_DistributorsDrainAndReturn(t *testing.T) {
+	e := newTestEngine()
+
+	// Queue commands before the distributors start, so Stop lands with work still pending
+	for i := 0; i < 100; i++ {
+		e.inputRing.Push(InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: Price(10 + i), size: 1, trader: 1})
+	}
+	e.Stop()
+	e.Stop() // Idempotent
+
+	var delivered int
+	inputDone, outputDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		e.StartInputDistributor()
+		close(inputDone)
+	}()
+	go func() {
+		e.StartOutputDistributor(func(OutputEvent) { delivered++ })
+		close(outputDone)
+	}()
+
+	for _, done := range []chan struct{}{inputDone, outputDone} {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the distributors to return")
+		}
+	}
+	if delivered != 200 { // An ORDER_EVENT and a RESTED_EVENT per order
+		t.Fatalf("expected all 100 queued orders to be applied and delivered, got %d events", delivered)
+	}
+	if e.inputRing.Push(InputCommand{eventType: CANCEL_EVENT}) {
+		t.Fatal("expected a push after Stop to be dropped")
+	}
+}
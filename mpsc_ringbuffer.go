@@ -0,0 +1,121 @@
+package main
+
+import "sync/atomic"
+
+// A slot of the MPSC ring buffer, tagged with the sequence number it was published under
+type mpscSlot[T any] struct {
+	seq   uint64 // write position + 1 once the value for that position is published (0 = never written)
+	value T
+}
+
+// Lock-free ring buffer supporting multiple producers and a single consumer (MPSC).
+// Producers claim a write position with a CAS on writePos, fill the slot, then publish it by
+// storing its sequence number; the consumer only reads slots whose sequence shows they are published.
+type MPSCRingBuffer[T any] struct {
+	buffer []mpscSlot[T] // Fixed-size circular buffer to hold elements
+	mask   uint64        // len(buffer) - 1, for fast modulo operation using bitwise AND
+	closed uint32        // Set once by Close (read atomically)
+
+	// Padding arrays to ensure writePos and readPos are on separate cache lines (see RingBuffer)
+	_pad1    [CACHE_LINE_SIZE - 8]byte // padding before writePos
+	writePos uint64                    // Next write index to claim (incremented by producers)
+	_pad2    [CACHE_LINE_SIZE - 8]byte // padding before readPos
+	readPos  uint64                    // Current read index (incremented by consumer)
+	_pad3    [CACHE_LINE_SIZE - 8]byte // padding after readPos
+}
+
+// NewMPSCRingBuffer allocates and returns a pointer to a new MPSC ring buffer holding size elements.
+// Panics unless size is a power of 2, which the index masking relies on.
+func NewMPSCRingBuffer[T any](size int) *MPSCRingBuffer[T] {
+	checkRingSize(size)
+	return &MPSCRingBuffer[T]{
+		buffer: make([]mpscSlot[T], size),
+		mask:   uint64(size - 1),
+	}
+}
+
+// Close marks the ring as shut down: Read drains what is left and then returns 0 rather than
+// spinning, and Push drops its element rather than waiting. A Push racing with Close may still be
+// accepted but never read, so producers should be stopped first for a lossless shutdown
+func (r *MPSCRingBuffer[T]) Close() {
+	atomic.StoreUint32(&r.closed, 1)
+}
+
+func (r *MPSCRingBuffer[T]) isClosed() bool {
+	return atomic.LoadUint32(&r.closed) != 0
+}
+
+// Push adds a single element to the ring buffer, waiting (spinning, then backing off) while the
+// buffer is full. Returns false, without adding v, once the ring is closed.
+// Safe for any number of concurrent producers.
+func (r *MPSCRingBuffer[T]) Push(v T) bool {
+	var b backoff
+	for {
+		if r.TryPush(v) {
+			return true
+		}
+		if r.isClosed() {
+			return false
+		}
+		// Buffer is full, wait for the consumer
+		b.wait()
+	}
+}
+
+// TryPush adds a single element if there is space, returning false immediately (without adding v)
+// if the buffer is full or the ring is closed. It only retries when it loses a race with another
+// producer for a free position, so it never waits on the consumer.
+// Safe for any number of concurrent producers.
+func (r *MPSCRingBuffer[T]) TryPush(v T) bool {
+	for {
+		if r.isClosed() {
+			return false
+		}
+
+		write := atomic.LoadUint64(&r.writePos)
+		read := atomic.LoadUint64(&r.readPos)
+
+		if write-read > r.mask {
+			return false // Buffer is full
+		}
+
+		// Claim the write position, retrying if another producer got there first
+		if atomic.CompareAndSwapUint64(&r.writePos, write, write+1) {
+			slot := &r.buffer[write&r.mask]
+			slot.value = v
+			atomic.StoreUint64(&slot.seq, write+1) // Publish the slot to the consumer
+			return true
+		}
+	}
+}
+
+// Read extracts up to len(out) published elements, in write position order.
+// Returns the number of elements actually read (always ≥ 1), waiting (spinning, then backing off)
+// while none are published.
+// Once the ring is closed and every claimed slot has been read, returns 0.
+// A slot claimed but not yet published holds back the slots after it.
+// Only safe for a single consumer; concurrent Read calls would be unsafe.
+func (r *MPSCRingBuffer[T]) Read(out []T) uint32 {
+	read := atomic.LoadUint64(&r.readPos)
+	var b backoff
+	for {
+		var count uint64
+		for count < uint64(len(out)) {
+			slot := &r.buffer[(read+count)&r.mask]
+			if atomic.LoadUint64(&slot.seq) != read+count+1 {
+				break // Not yet published
+			}
+			out[count] = slot.value
+			count++
+		}
+
+		if count > 0 {
+			atomic.StoreUint64(&r.readPos, read+count)
+			return uint32(count)
+		}
+		if r.isClosed() && atomic.LoadUint64(&r.writePos) == read {
+			return 0 // Closed and fully drained
+		}
+		b.wait()
+	}
+}
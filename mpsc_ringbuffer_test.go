@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestMPSCPushAndReadInOrder checks that a single producer's values are read back in order.
+func TestMPSCPushAndReadInOrder(t *testing.T) {
+	rb := NewMPSCRingBuffer[int](RING_SIZE)
+	for i := 0; i < 5; i++ {
+		rb.Push(i)
+	}
+
+	out := make([]int, 10)
+	n := rb.Read(out)
+	if n != 5 {
+		t.Fatalf("Expected to read 5 elements, got %d", n)
+	}
+	for i := 0; i < 5; i++ {
+		if out[i] != i {
+			t.Fatalf("Expected value %d at index %d, got %d", i, i, out[i])
+		}
+	}
+}
+
+// TestMPSCConcurrentProducers stresses many producers against one consumer, checking that every
+// value arrives exactly once and each producer's values arrive in the order it pushed them.
+// The total is over twice RING_SIZE, so producers also contend on a full buffer and wrap around.
+func TestMPSCConcurrentProducers(t *testing.T) {
+	rb := NewMPSCRingBuffer[uint64](RING_SIZE)
+	const producers = 16
+	const perProducer = 10000
+
+	var wg sync.WaitGroup
+	for p := uint64(0); p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := uint64(0); i < perProducer; i++ {
+				rb.Push(p<<32 | i)
+			}
+		}()
+	}
+
+	next := make([]uint64, producers) // Next expected sequence per producer
+	out := make([]uint64, 256)
+	for readCount := 0; readCount < producers*perProducer; {
+		n := rb.Read(out)
+		for _, v := range out[:n] {
+			p, i := v>>32, v&(1<<32-1)
+			if p >= producers || i != next[p] {
+				t.Fatalf("Producer %d: expected sequence %d, got %d", p, next[p], i)
+			}
+			next[p]++
+		}
+		readCount += int(n)
+	}
+	wg.Wait()
+
+	for p, n := range next {
+		if n != perProducer {
+			t.Fatalf("Producer %d: expected %d values, got %d", p, perProducer, n)
+		}
+	}
+}
+
+func TestMPSCClosedRingDrainsThenReturnsZero(t *testing.T) {
+	rb := NewMPSCRingBuffer[int](4)
+	rb.Push(1)
+	rb.Close()
+
+	out := make([]int, 4)
+	if n := rb.Read(out); n != 1 || out[0] != 1 {
+		t.Fatalf("expected the element queued before shutdown, got %v", out[:n])
+	}
+	if n := rb.Read(out); n != 0 {
+		t.Fatalf("expected 0 from a closed, drained ring, got %d", n)
+	}
+	if rb.Push(2) {
+		t.Fatal("expected a push to a closed ring to be dropped")
+	}
+}
+
+func TestMPSCTryPushFailsWhenFull(t *testing.T) {
+	rb := NewMPSCRingBuffer[int](2)
+	if !rb.TryPush(1) || !rb.TryPush(2) {
+		t.Fatal("expected pushes into free space to succeed")
+	}
+	if rb.TryPush(3) {
+		t.Fatal("expected TryPush to fail on a full ring")
+	}
+
+	out := make([]int, 1)
+	rb.Read(out)
+	if !rb.TryPush(3) {
+		t.Fatal("expected TryPush to succeed once space is freed")
+	}
+	rb.Close()
+	if rb.TryPush(4) {
+		t.Fatal("expected TryPush to a closed ring to fail")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// Each feed datagram is one market-data message: its 8-byte sequence number, then the EventType
+// (EXECUTION_EVENT for a trade, LEVEL_UPDATE for a level's new volume), side, symbol, price, size and,
+// for a trade, its TradeID, little-endian. Trades carry the aggressor's side and no trader IDs
+const FEED_FRAME_SIZE = 8 + 1 + 1 + 2 + 4 + 4 + 8
+
+// A retransmit request: the first sequence number wanted and how many messages from there
+const FEED_REQUEST_SIZE = 8 + 4
+
+const FEED_HISTORY = 1 << 16 // Messages kept for retransmission
+
+var ErrFeedFrame = errors.New("feed: malformed market-data frame")
+
+// Sequenced market-data feed over UDP (typically to a multicast group), for fanning trades and level
+// updates out to many receivers at once. Datagrams can be lost, so every message carries its sequence
+// number and the last FEED_HISTORY are kept for a TCP retransmit channel: a receiver that sees a gap
+// asks for the missing range (see RequestRetransmit). One that falls further behind than the history
+// reseeds its book from Depth, as for SetLevelUpdates
+type MulticastFeed struct {
+	conn     *net.UDPConn // Connected to the group
+	listener net.Listener // Retransmit requests
+
+	mu      sync.Mutex // Held while a message is sequenced and while retransmits read the history
+	seq     uint64     // Sequence number of the last message published
+	history []byte     // The last FEED_HISTORY messages, message seq at frame seq % FEED_HISTORY
+	clients map[net.Conn]struct{}
+	closed  bool
+	serving sync.WaitGroup // Accept loop and retransmit handlers still running
+}
+
+// NewMulticastFeed sends the feed to group (a "host:port" UDP address, usually multicast) and serves
+// retransmit requests on the TCP address retransmit. Publish must then be given the engine's output
+// events; level updates are only sent while SetLevelUpdates is on
+func NewMulticastFeed(group, retransmit string) (*MulticastFeed, error) {
+	addr, err := net.ResolveUDPAddr("udp", group)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", retransmit)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	f := &MulticastFeed{
+		conn:     conn,
+		listener: listener,
+		history:  make([]byte, FEED_HISTORY*FEED_FRAME_SIZE),
+		clients:  make(map[net.Conn]struct{}),
+	}
+	f.serving.Add(1)
+	go f.serve()
+	return f, nil
+}
+
+// Publish sequences and sends one output event if it is market data (a taker EXECUTION_EVENT or a
+// LEVEL_UPDATE), ignoring the rest. It writes into the preallocated history and sends from there, so
+// it never allocates, and a datagram the socket fails to send is left for receivers to recover as a
+// gap. Call it from one goroutine, as the callback of StartOutputDistributor or of Subscribe: the
+// output distributor shares any stall in sending with the output ring, and so eventually with the
+// matching loop, while a subscriber instead drops events when it falls behind (see Stats.dropped),
+// before they are sequenced
+func (f *MulticastFeed) Publish(ev OutputEvent) {
+	if ev.eventType != LEVEL_UPDATE && (ev.eventType != EXECUTION_EVENT || ev.maker) {
+		return
+	}
+
+	f.mu.Lock()
+	f.seq++
+	frame := f.frame(f.seq)
+	appendFeedFrame(frame[:0], f.seq, &ev)
+	f.mu.Unlock()
+
+	// Only this goroutine writes the history, so the frame can be sent outside the lock
+	f.conn.Write(frame)
+}
+
+// Seq returns the sequence number of the last message published
+func (f *MulticastFeed) Seq() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seq
+}
+
+// RetransmitAddr returns the address the retransmit channel listens on
+func (f *MulticastFeed) RetransmitAddr() net.Addr {
+	return f.listener.Addr()
+}
+
+// Close stops the feed, disconnecting any retransmit clients
+func (f *MulticastFeed) Close() error {
+	err := f.listener.Close()
+	f.mu.Lock()
+	f.closed = true
+	for client := range f.clients {
+		client.Close()
+	}
+	f.mu.Unlock()
+	f.serving.Wait()
+
+	if cerr := f.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// The history slot for message seq
+func (f *MulticastFeed) frame(seq uint64) []byte {
+	i := (seq % FEED_HISTORY) * FEED_FRAME_SIZE
+	return f.history[i : i+FEED_FRAME_SIZE]
+}
+
+// Accept retransmit clients until the listener is closed
+func (f *MulticastFeed) serve() {
+	defer f.serving.Done()
+	for {
+		client, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			client.Close()
+			return
+		}
+		f.clients[client] = struct{}{}
+		f.serving.Add(1)
+		f.mu.Unlock()
+		go f.retransmit(client)
+	}
+}
+
+// Answer one client's requests, each with a 4-byte message count and then the messages, until it
+// disconnects or sends a short request
+func (f *MulticastFeed) retransmit(client net.Conn) {
+	defer f.serving.Done()
+	defer func() {
+		f.mu.Lock()
+		delete(f.clients, client)
+		f.mu.Unlock()
+		client.Close()
+	}()
+
+	request := make([]byte, FEED_REQUEST_SIZE)
+	var reply []byte
+	for {
+		if _, err := io.ReadFull(client, request); err != nil {
+			return
+		}
+		reply = f.appendHistory(reply[:0], binary.LittleEndian.Uint64(request), binary.LittleEndian.Uint32(request[8:]))
+		if _, err := client.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+// Append the count and frames of the retained messages among the count from sequence number from on.
+// Those already gone from the history are skipped, so the first message sent may be later than from
+func (f *MulticastFeed) appendHistory(buf []byte, from uint64, count uint32) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	first, last := max(from, 1), min(f.seq, from+uint64(count)-1)
+	if f.seq > FEED_HISTORY {
+		first = max(first, f.seq-FEED_HISTORY+1)
+	}
+	var n uint64
+	if count > 0 && first <= last {
+		n = last - first + 1
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(n))
+	for seq := first; seq < first+n; seq++ {
+		buf = append(buf, f.frame(seq)...)
+	}
+	return buf
+}
+
+// Append the feed frame for a market-data event sequenced as seq
+func appendFeedFrame(buf []byte, seq uint64, ev *OutputEvent) []byte {
+	buf = binary.LittleEndian.AppendUint64(buf, seq)
+	buf = append(buf, byte(ev.eventType), byte(ev.side))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(ev.symbol))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(ev.price))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(ev.size))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(ev.tradeID))
+	return buf
+}
+
+// DecodeFeedFrame decodes one feed message from the start of frame into ev (setting only the fields
+// the feed carries), returning its sequence number. Short frames and frames of any other event type
+// or an unknown side are rejected, leaving ev unchanged
+func DecodeFeedFrame(frame []byte, ev *OutputEvent) (uint64, error) {
+	if len(frame) < FEED_FRAME_SIZE {
+		return 0, ErrFeedFrame
+	}
+	eventType, side := EventType(frame[8]), Side(frame[9])
+	if (eventType != EXECUTION_EVENT && eventType != LEVEL_UPDATE) || side > Ask {
+		return 0, ErrFeedFrame
+	}
+
+	*ev = OutputEvent{
+		eventType: eventType,
+		side:      side,
+		symbol:    Symbol(binary.LittleEndian.Uint16(frame[10:])),
+		price:     Price(binary.LittleEndian.Uint32(frame[12:])),
+		size:      Size(binary.LittleEndian.Uint32(frame[16:])),
+		tradeID:   TradeID(binary.LittleEndian.Uint64(frame[20:])),
+	}
+	return binary.LittleEndian.Uint64(frame), nil
+}
+
+// RequestRetransmit asks a feed's retransmit channel, over conn, for the count messages from sequence
+// number from on, passing each one published and still in the feed's history to fn in order
+func RequestRetransmit(conn io.ReadWriter, from uint64, count uint32, fn func(seq uint64, ev OutputEvent)) error {
+	request := binary.LittleEndian.AppendUint64(make([]byte, 0, FEED_REQUEST_SIZE), from)
+	request = binary.LittleEndian.AppendUint32(request, count)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	frame := make([]byte, FEED_FRAME_SIZE)
+	var ev OutputEvent
+	for n := binary.LittleEndian.Uint32(header); n > 0; n-- {
+		if _, err := io.ReadFull(conn, frame); err != nil {
+			return err
+		}
+		seq, err := DecodeFeedFrame(frame, &ev)
+		if err != nil {
+			return err
+		}
+		fn(seq, ev)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// Helper to start a feed sending to a loopback UDP receiver, with its retransmit channel on any free port
+func newTestFeed(t *testing.T) (*MulticastFeed, *net.UDPConn) {
+	receiver, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { receiver.Close() })
+	feed, err := NewMulticastFeed(receiver.LocalAddr().String(), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { feed.Close() })
+	return feed, receiver
+}
+
+func TestMulticastFeed_SequencesTradesAndLevelUpdates(t *testing.T) {
+	feed, receiver := newTestFeed(t)
+	e := newTestEngine()
+	e.SetLevelUpdates(true)
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	e.Limit(1, Bid, 10, 2, 2, GTC)
+	for _, ev := range drainOutputEvents(e) {
+		feed.Publish(ev)
+	}
+
+	// The ask's level appears, trades 2 and shrinks to 3: the maker report and order events are not market data
+	want := []OutputEvent{
+		{eventType: LEVEL_UPDATE, symbol: 1, side: Ask, price: 10, size: 5},
+		{eventType: EXECUTION_EVENT, symbol: 1, side: Bid, price: 10, size: 2, tradeID: 1},
+		{eventType: LEVEL_UPDATE, symbol: 1, side: Ask, price: 10, size: 3},
+	}
+	if feed.Seq() != uint64(len(want)) {
+		t.Fatalf("expected %d messages sequenced, got %d", len(want), feed.Seq())
+	}
+	receiver.SetReadDeadline(time.Now().Add(time.Second))
+	datagram := make([]byte, 2*FEED_FRAME_SIZE)
+	for i, w := range want {
+		n, err := receiver.Read(datagram)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ev OutputEvent
+		seq, err := DecodeFeedFrame(datagram[:n], &ev)
+		if err != nil || n != FEED_FRAME_SIZE || seq != uint64(i+1) || ev != w {
+			t.Fatalf("datagram %d: expected seq %d %+v, got %d bytes, seq %d %+v (%v)", i, i+1, w, n, seq, ev, err)
+		}
+	}
+}
+
+func TestMulticastFeed_RetransmitsFromHistory(t *testing.T) {
+	feed, _ := newTestFeed(t)
+	total := FEED_HISTORY + 10
+	for i := 1; i <= total; i++ {
+		feed.Publish(OutputEvent{eventType: LEVEL_UPDATE, symbol: 1, side: Bid, price: 10, size: Size(i)})
+	}
+
+	conn, err := net.Dial("tcp", feed.RetransmitAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A gap in the history comes back whole; one partly overwritten starts at the oldest kept
+	for _, tc := range []struct {
+		from          uint64
+		count         uint32
+		first, number int
+	}{
+		{from: uint64(total - 4), count: 3, first: total - 4, number: 3},
+		{from: uint64(total - 1), count: 100, first: total - 1, number: 2},
+		{from: 1, count: 20, first: 11, number: 10},
+		{from: uint64(total + 1), count: 5, number: 0},
+	} {
+		var seqs []uint64
+		err := RequestRetransmit(conn, tc.from, tc.count, func(seq uint64, ev OutputEvent) {
+			if ev.size != Size(seq) {
+				t.Fatalf("expected message %d to have size %d, got %+v", seq, seq, ev)
+			}
+			seqs = append(seqs, seq)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(seqs) != tc.number || (tc.number > 0 && seqs[0] != uint64(tc.first)) {
+			t.Fatalf("from %d count %d: expected %d messages from %d, got %v", tc.from, tc.count, tc.number, tc.first, seqs)
+		}
+	}
+}
+
+func TestMulticastFeed_PublishDoesNotAllocate(t *testing.T) {
+	feed, _ := newTestFeed(t)
+	trade := OutputEvent{eventType: EXECUTION_EVENT, symbol: 1, side: Bid, price: 10, size: 1, tradeID: 1}
+	if allocs := testing.AllocsPerRun(100, func() { feed.Publish(trade) }); allocs != 0 {
+		t.Fatalf("expected no allocations per event, got %v", allocs)
+	}
+}
+
+func TestDecodeFeedFrame_RejectsMalformedFrames(t *testing.T) {
+	frame := appendFeedFrame(nil, 1, &OutputEvent{eventType: LEVEL_UPDATE, side: Ask})
+	var ev OutputEvent
+	if _, err := DecodeFeedFrame(frame[:FEED_FRAME_SIZE-1], &ev); err != ErrFeedFrame {
+		t.Fatalf("expected ErrFeedFrame for a short frame, got %v", err)
+	}
+	frame[8] = byte(ORDER_EVENT)
+	if _, err := DecodeFeedFrame(frame, &ev); err != ErrFeedFrame {
+		t.Fatalf("expected ErrFeedFrame for an order event, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+// One-cancels-the-other groups: a trader's working orders submitted with the same groupID. As soon
+// as any of them executes (fills on entry, is filled resting, or is a stop that triggers), the rest
+// of its group is cancelled. The group's members are linked in a ring by the pool, off the hot
+// Order struct; only FLAG_OCO on the order itself is checked when it trades
+
+// An OCO group, which is only unique among its trader's orders
+type groupKey struct {
+	trader  TraderID
+	groupID uint64
+}
+
+// An order's place in its OCO group's ring
+type groupLink struct {
+	next    Slot // Next member, circularly (itself for a group of one)
+	groupID uint64
+}
+
+// Add a tracked order to its trader's OCO group, starting the group if it has no working member
+func (p *OrderPool) group(slot Slot, groupID uint64) {
+	order := &p.orders[slot]
+	order.flags |= FLAG_OCO
+	key := groupKey{order.trader, groupID}
+	if head, ok := p.groupHeads[key]; ok {
+		p.groups[slot] = groupLink{next: p.groups[head].next, groupID: groupID}
+		p.groups[head] = groupLink{next: slot, groupID: groupID}
+	} else {
+		p.groups[slot] = groupLink{next: slot, groupID: groupID}
+		p.groupHeads[key] = slot
+	}
+}
+
+// Take an order out of its OCO group (a no-op for an order in none), leaving the rest grouped
+func (p *OrderPool) ungroup(slot Slot) {
+	order := &p.orders[slot]
+	if order.flags&FLAG_OCO == 0 {
+		return
+	}
+	order.flags &^= FLAG_OCO
+	link := p.groups[slot]
+	delete(p.groups, slot)
+
+	key := groupKey{order.trader, link.groupID}
+	if link.next == slot {
+		delete(p.groupHeads, key)
+		return
+	}
+	prev := link.next
+	for p.groups[prev].next != slot {
+		prev = p.groups[prev].next
+	}
+	p.groups[prev] = groupLink{next: link.next, groupID: link.groupID}
+	if p.groupHeads[key] == slot {
+		p.groupHeads[key] = link.next
+	}
+}
+
+// Slots of every working order in an OCO group, starting from slot and following the ring
+func (p *OrderPool) members(slot Slot) []Slot {
+	members := []Slot{slot}
+	for next := p.groups[slot].next; next != slot; next = p.groups[next].next {
+		members = append(members, next)
+	}
+	return members
+}
+
+// An order of an OCO group has executed: dissolve the group and queue the cancellation of its other
+// members, which triggerStops carries out before any further stop can trigger, so the cancels stay
+// on the matching goroutine and never disturb a price level mid-match
+func (e *MatchingEngine) groupExecuted(slot Slot) {
+	for _, member := range e.pool.members(slot) {
+		if member != slot {
+			e.groupCancels = append(e.groupCancels, e.pool.get(member).id)
+		}
+		e.pool.ungroup(member)
+	}
+}
+
+// Cancel the orders queued by groupExecuted that are still working
+func (e *MatchingEngine) cancelGrouped() {
+	for _, id := range e.groupCancels {
+		if order := e.working(id); order != nil {
+			if ev := cancelEvent(order); e.cancel(id) {
+				e.emitCancel(ev)
+			}
+		}
+	}
+	e.groupCancels = e.groupCancels[:0]
+}
+
+// CancelGroup cancels every working order in one of trader's OCO groups (see InputCommand.groupID),
+// rejecting with REJECT_UNKNOWN_ORDER if the group has none
+func (e *MatchingEngine) CancelGroup(trader TraderID, groupID uint64) {
+	head, ok := e.pool.groupHeads[groupKey{trader, groupID}]
+	if !ok {
+		e.reject(OutputEvent{eventType: REJECT_EVENT, trader: trader, reason: REJECT_UNKNOWN_ORDER})
+		return
+	}
+	for _, member := range e.pool.members(head) {
+		e.cancelCommand(e.pool.get(member).id, trader)
+	}
+}
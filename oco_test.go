@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Helper to place a take-profit sell at 110 and a stop-loss sell stop at 90 as one OCO group of
+// trader 1, returning their IDs
+func ocoPair(e *MatchingEngine) (takeProfit, stopLoss OrderID) {
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 110, size: 5, trader: 1, groupID: 7})
+	e.Market(&InputCommand{symbol: 1, side: Ask, stopPrice: 90, size: 5, trader: 1, groupID: 7})
+	var ids []OrderID
+	for _, ev := range drainOutputEvents(e) {
+		if ev.eventType == ORDER_EVENT {
+			ids = append(ids, ev.orderID)
+		}
+	}
+	return ids[0], ids[1]
+}
+
+// Helper to find the CANCEL_EVENT of an order among events
+func cancelOf(events []OutputEvent, id OrderID) (OutputEvent, bool) {
+	for _, ev := range events {
+		if ev.eventType == CANCEL_EVENT && ev.orderID == id {
+			return ev, true
+		}
+	}
+	return OutputEvent{}, false
+}
+
+func TestOCO_FillCancelsTheOtherLeg(t *testing.T) {
+	e := newTestEngine()
+	takeProfit, stopLoss := ocoPair(e)
+
+	limit(e, 1, Bid, 110, 2, 2, GTC) // Partly fills the take-profit
+	events := drainOutputEvents(e)
+	if ev, ok := cancelOf(events, stopLoss); !ok || ev.size != 5 || ev.trader != 1 {
+		t.Fatalf("expected the stop-loss cancelled in full, got %+v", events)
+	}
+	if last := events[len(events)-1]; last.eventType != CANCEL_EVENT || last.orderID != stopLoss {
+		t.Fatalf("expected the cancel after the fill's own events, got %+v", events)
+	}
+	if exists, remaining, _, _, _ := e.OrderStatus(takeProfit); !exists || remaining != 3 {
+		t.Fatalf("expected the take-profit to keep working with 3, got exists=%v remaining=%d", exists, remaining)
+	}
+
+	// The group is gone: a trade down through 90 no longer has a stop to trigger
+	limit(e, 1, Bid, 90, 1, 3, GTC)
+	limit(e, 1, Ask, 90, 1, 4, GTC)
+	if _, ok := cancelOf(drainOutputEvents(e), takeProfit); ok {
+		t.Fatal("expected the rest of the take-profit to be unaffected by later trades")
+	}
+}
+
+func TestOCO_StopTriggerCancelsTheOtherLeg(t *testing.T) {
+	e := newTestEngine()
+	takeProfit, _ := ocoPair(e)
+
+	limit(e, 1, Bid, 90, 8, 2, GTC)
+	limit(e, 1, Ask, 90, 1, 3, GTC) // Trades at 90, triggering the stop-loss
+	events := drainOutputEvents(e)
+	if _, ok := cancelOf(events, takeProfit); !ok {
+		t.Fatalf("expected the take-profit cancelled, got %+v", events)
+	}
+	if exists, _, _, _, _ := e.OrderStatus(takeProfit); exists {
+		t.Fatal("expected the take-profit gone")
+	}
+	if e.Position(1, 1) != -5 {
+		t.Fatalf("expected the stop-loss to have sold 5, position %d", e.Position(1, 1))
+	}
+}
+
+func TestOCO_NoCancelEventForALegNotCancelled(t *testing.T) {
+	e := newTestEngine()
+	takeProfit, _ := ocoPair(e)
+	limit(e, 1, Ask, 111, 5, 2, GTC)
+
+	// A stale price leaves the take-profit naming a level whose queue it is not in, so cancel refuses it
+	e.pool.get(Slot(takeProfit & SLOT_MASK)).price = 111
+	limit(e, 1, Bid, 90, 8, 3, GTC)
+	limit(e, 1, Ask, 90, 1, 4, GTC) // Trades at 90, triggering the stop-loss
+	if ev, ok := cancelOf(drainOutputEvents(e), takeProfit); ok {
+		t.Fatalf("expected no CANCEL_EVENT for a take-profit left in the book, got %+v", ev)
+	}
+}
+
+func TestOCO_CancelGroupRemovesEveryLeg(t *testing.T) {
+	e := newTestEngine()
+	takeProfit, stopLoss := ocoPair(e)
+
+	e.dispatch(&InputCommand{eventType: CANCEL_EVENT, trader: 2, groupID: 7}) // Another trader's group of the same ID
+	if events := drainOutputEvents(e); len(events) != 1 || events[0].reason != REJECT_UNKNOWN_ORDER {
+		t.Fatalf("expected an unknown order reject for trader 2, got %+v", events)
+	}
+
+	e.dispatch(&InputCommand{eventType: CANCEL_EVENT, trader: 1, groupID: 7})
+	events := drainOutputEvents(e)
+	for _, id := range []OrderID{takeProfit, stopLoss} {
+		if _, ok := cancelOf(events, id); !ok {
+			t.Fatalf("expected order %d cancelled, got %+v", id, events)
+		}
+	}
+	if len(e.pool.groups) != 0 || len(e.pool.groupHeads) != 0 {
+		t.Fatalf("expected no groups left, got %v and %v", e.pool.groups, e.pool.groupHeads)
+	}
+}
+
+func TestOCO_GroupsSurviveAnEngineSnapshot(t *testing.T) {
+	live := newTestEngine()
+	_, stopLoss := ocoPair(live)
+
+	restored := newTestEngine()
+	if err := restored.LoadSnapshot(bytes.NewReader(engineState(t, live))); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !bytes.Equal(engineState(t, live), engineState(t, restored)) {
+		t.Fatal("restored engine state differs from the live engine")
+	}
+
+	for _, e := range []*MatchingEngine{live, restored} {
+		limit(e, 1, Bid, 110, 5, 2, GTC)
+		if _, ok := cancelOf(drainOutputEvents(e), stopLoss); !ok {
+			t.Fatal("expected filling the take-profit to cancel the stop-loss")
+		}
+	}
+}
@@ -9,6 +9,9 @@ type (
 	Side     uint8
 	Slot     uint32
 	Gen      uint32
+	TradeID  uint64
+
+	TimeInForce uint8
 )
 
 const (
@@ -16,44 +19,111 @@ const (
 	Ask             // Sell orders
 )
 
+// Per-order state bits
+type OrderFlags uint8
+
+const (
+	FLAG_PENDING_STOP OrderFlags = 1 << iota // Dormant stop order, held in its book's stop list until triggered
+	FLAG_REDUCE_ONLY                         // Only ever reduces the trader's net position
+	FLAG_OCO                                 // Member of a one-cancels-the-other group (see OrderPool.group)
+)
+
+const (
+	GTC TimeInForce = iota // Good-till-cancel: rest any unfilled remainder (default)
+	IOC                    // Immediate-or-cancel: cancel any unfilled remainder
+	FOK                    // Fill-or-kill: fill completely on entry or reject without executing
+	GTD                    // Good-till-date: rest until cancelled or expired at expiresAt
+)
+
 // Order with intrusive linked list for FIFO queues (price/time priority)
 type Order struct {
 	id       OrderID
+	clOrdID  uint64 // Client order ID (0 if none; see OrderPool.tag)
 	price    Price
-	size     Size
+	size     Size // Visible open quantity (any hidden iceberg quantity is held in reserve)
+	filled   Size // Quantity executed so far
+	peak     Size // Iceberg visible quantity to show at a time (0 shows the full size)
+	reserve  Size // Iceberg hidden quantity, used to replenish size as it fills
 	gen      Gen  // Generation counter for this order (to avoid stale references)
 	prevSlot Slot // Previous order in PriceLevel queue
 	nextSlot Slot // Next order in PriceLevel queue
+	trader   TraderID
 	symbol   Symbol
 	side     Side
+	flags    OrderFlags
+
+	traderPrev Slot // Newer working order of the same trader (see OrderPool.track)
+	traderNext Slot // Older working order of the same trader
+}
+
+// Split an open quantity into the visible part and the hidden iceberg reserve
+func (order *Order) split(open Size) (Size, Size) {
+	if order.peak == 0 || open <= order.peak {
+		return open, 0
+	}
+	return order.peak, open - order.peak
 }
 
 type OrderBook struct {
-	bidMax Price // Best (highest) bid price
-	askMin Price // Best (lowest) ask price
+	bidMax    Price // Best (highest) bid price
+	askMin    Price // Best (lowest) ask price
+	lastPrice Price // Last traded price (0 if never traded)
+	lastSize  Size  // Size of the last trade
+
+	buyStops  []pendingStop // Pending buy stops, ordered so the next to trigger is last
+	sellStops []pendingStop // Pending sell stops, ordered so the next to trigger is last
+	trailing  int           // Pending stops with a trailing offset, re-sorted after each trade while any remain
 
-	bidLevels [MAX_PRICE_LEVELS]PriceLevel // Buy order queues by price
-	askLevels [MAX_PRICE_LEVELS]PriceLevel // Sell order queues by price
+	bidBits priceBitmap // Non-empty bid levels
+	askBits priceBitmap // Non-empty ask levels
+
+	bidLevels []PriceLevel // Buy order queues by price
+	askLevels []PriceLevel // Sell order queues by price
+
+	bidVolumes  volumeTree // Visible bid volume by price, only with volumeTrees
+	askVolumes  volumeTree // Visible ask volume by price, only with volumeTrees
+	volumeTrees bool       // Keep the volume trees (see EngineConfig)
+
+	shared bool // Levels and bitmaps are the engine's empty placeholders, not yet allocated (see EngineConfig)
 }
 
+// Allocate the book's price levels, for prices 1..priceLevels-1 (see EngineConfig)
+func (book *OrderBook) init(priceLevels Price) {
+	book.askMin = priceLevels
+	book.bidBits, book.askBits = newPriceBitmap(priceLevels), newPriceBitmap(priceLevels)
+	book.bidLevels, book.askLevels = make([]PriceLevel, priceLevels), make([]PriceLevel, priceLevels)
+	if book.volumeTrees {
+		book.bidVolumes, book.askVolumes = newVolumeTree(priceLevels), newVolumeTree(priceLevels)
+	}
+}
+
+// Give a book still sharing the empty placeholder levels its own, before anything is written to it
+func (book *OrderBook) allocate() {
+	if book.shared {
+		book.init(book.priceLevels())
+		book.shared = false
+	}
+}
+
+// Number of price levels per side; askMin sits here when there are no asks
+func (book *OrderBook) priceLevels() Price {
+	return Price(len(book.askLevels))
+}
+
+// Move bidMax down to the next non-empty bid level, dropping the current level from the bitmap if it emptied
 func (book *OrderBook) updateBidMax() {
-	for price := book.bidMax; price > 0; price-- {
-		if book.bidLevels[price].headSlot != 0 {
-			book.bidMax = price
-			return
-		}
+	if book.bidLevels[book.bidMax].headSlot == 0 {
+		book.bidBits.clear(book.bidMax)
 	}
-	book.bidMax = 0 // No bids remaining
+	book.bidMax = book.bidBits.prev(book.bidMax) // 0 if no bids remaining
 }
 
+// Move askMin up to the next non-empty ask level, dropping the current level from the bitmap if it emptied
 func (book *OrderBook) updateAskMin() {
-	for price := book.askMin; price < MAX_PRICE_LEVELS; price++ {
-		if book.askLevels[price].headSlot != 0 {
-			book.askMin = price
-			return
-		}
+	if book.askMin < book.priceLevels() && book.askLevels[book.askMin].headSlot == 0 {
+		book.askBits.clear(book.askMin)
 	}
-	book.askMin = MAX_PRICE_LEVELS // No asks remaining
+	book.askMin = book.askBits.next(book.askMin) // priceLevels if no asks remaining
 }
 
 func (book *OrderBook) level(side Side, price Price) *PriceLevel {
@@ -63,9 +133,39 @@ func (book *OrderBook) level(side Side, price Price) *PriceLevel {
 	return &book.askLevels[price]
 }
 
-func (book *OrderBook) add(pool *OrderPool, side Side, price Price, id OrderID, slot Slot, size Size, symbol Symbol) {
+func (book *OrderBook) bits(side Side) *priceBitmap {
+	if side == Bid {
+		return &book.bidBits
+	}
+	return &book.askBits
+}
+
+// Total visible size resting at a price (hidden iceberg reserve is excluded)
+func (book *OrderBook) VolumeAt(side Side, price Price) Size {
+	if price >= book.priceLevels() {
+		return 0
+	}
+	return book.level(side, price).volume
+}
+
+// Check whether an order at this price would execute immediately against the opposite side
+func (book *OrderBook) crosses(side Side, price Price) bool {
+	if side == Bid {
+		return price >= book.askMin
+	}
+	return price <= book.bidMax
+}
+
+// Rest an order at a price level: at the back of its queue, or at the front (so it matches first)
+// with front, as the LIFO match mode does for new and re-priced orders. Matching always consumes
+// from the front, so a replenished iceberg peak, which goes to the back, loses priority either way
+func (book *OrderBook) add(pool *OrderPool, side Side, price Price, id OrderID, slot Slot, size Size, symbol Symbol, trader TraderID, front bool) {
 	level := book.level(side, price)
 
+	if level.headSlot == 0 {
+		book.bits(side).set(price)
+	}
+
 	if side == Bid {
 		if price > book.bidMax {
 			book.bidMax = price
@@ -82,55 +182,27 @@ func (book *OrderBook) add(pool *OrderPool, side Side, price Price, id OrderID,
 	order.side = side
 	order.price = price
 	order.symbol = symbol
+	order.trader = trader
 
-	level.pushBack(pool, slot)
-}
-
-func (book *OrderBook) match(pool *OrderPool, outRing *RingBuffer[OutputEvent], size Size, symbol Symbol, side Side, price Price, trader TraderID, id OrderID) Size {
-	remaining := size
-
-	if side == Bid {
-		for remaining > 0 && book.askMin < MAX_PRICE_LEVELS && book.askMin <= price {
-			remaining = book.matchLevel(&book.askLevels[book.askMin], pool, outRing, remaining, book.askMin, symbol, trader, id)
-			if book.askLevels[book.askMin].headSlot == 0 {
-				book.updateAskMin()
-			}
-		}
+	if front {
+		level.pushFront(pool, slot)
 	} else {
-		for remaining > 0 && book.bidMax > 0 && book.bidMax >= price {
-			remaining = book.matchLevel(&book.bidLevels[book.bidMax], pool, outRing, remaining, book.bidMax, symbol, trader, id)
-			if book.bidLevels[book.bidMax].headSlot == 0 {
-				book.updateBidMax()
-			}
-		}
+		level.pushBack(pool, slot)
 	}
-	return remaining
 }
 
-func (book *OrderBook) matchLevel(level *PriceLevel, pool *OrderPool, outRing *RingBuffer[OutputEvent], remaining Size, price Price, symbol Symbol, trader TraderID, id OrderID) Size {
-	for counterSlot := level.headSlot; counterSlot != 0 && remaining > 0; {
-		counterOrder := pool.get(counterSlot)
-		nextCounterSlot := counterOrder.nextSlot
-
-		fillSize := min(remaining, counterOrder.size)
-
-		outRing.Push(OutputEvent{
-			eventType:      EXECUTION_EVENT,
-			orderID:        id,
-			counterOrderID: counterOrder.id,
-			price:          price,
-			size:           fillSize,
-			trader:         trader,
-			symbol:         symbol,
-		})
-
-		remaining -= fillSize
-		counterOrder.size -= fillSize
-
-		if counterOrder.size == 0 {
-			level.remove(pool, counterSlot)
+// Unlink a resting order from its price level (keeping its slot), refreshing the best price if the level empties
+func (book *OrderBook) unlink(pool *OrderPool, slot Slot) {
+	order := pool.get(slot)
+	level := book.level(order.side, order.price)
+	level.unlink(pool, slot)
+
+	if level.headSlot == 0 {
+		book.bits(order.side).clear(order.price)
+		if order.side == Bid && order.price == book.bidMax {
+			book.updateBidMax()
+		} else if order.side == Ask && order.price == book.askMin {
+			book.updateAskMin()
 		}
-		counterSlot = nextCounterSlot
 	}
-	return remaining
 }
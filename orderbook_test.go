@@ -1,6 +1,10 @@
 package main
 
-import "testing"
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
 
 // Helper to create a price level with a given number of orders
 func makePriceLevel(size uint32) PriceLevel {
@@ -13,10 +17,24 @@ func makePriceLevel(size uint32) PriceLevel {
 	}
 }
 
-func TestUpdateBestBidEmptyBook(t *testing.T) {
-	book := &OrderBook{
-		bidMax: 15, // Random value
+// Helper to create an empty book with the default price levels
+func newTestBook() *OrderBook {
+	book := &OrderBook{}
+	book.init(DEFAULT_PRICE_LEVELS)
+	return book
+}
+
+// Helper to populate a price level of a book with a given number of orders
+func setPriceLevel(book *OrderBook, side Side, price Price, size uint32) {
+	*book.level(side, price) = makePriceLevel(size)
+	if size > 0 {
+		book.bits(side).set(price)
 	}
+}
+
+func TestUpdateBestBidEmptyBook(t *testing.T) {
+	book := newTestBook()
+	book.bidMax = 15 // Random value
 
 	// No bid levels populated
 	book.updateBidMax()
@@ -26,10 +44,9 @@ func TestUpdateBestBidEmptyBook(t *testing.T) {
 }
 
 func TestUpdateBestBid_SinglePriceLevel(t *testing.T) {
-	book := &OrderBook{
-		bidMax: 10,
-	}
-	book.bidLevels[10] = makePriceLevel(3)
+	book := newTestBook()
+	book.bidMax = 10
+	setPriceLevel(book, Bid, 10, 3)
 
 	// Nothing else, updateBidMax should stay at 10
 	book.updateBidMax()
@@ -39,12 +56,11 @@ func TestUpdateBestBid_SinglePriceLevel(t *testing.T) {
 }
 
 func TestUpdateBestBid_MultipleLevels(t *testing.T) {
-	book := &OrderBook{
-		bidMax: 10,
-	}
-	book.bidLevels[10] = makePriceLevel(3)
-	book.bidLevels[9] = makePriceLevel(2)
-	book.bidLevels[7] = makePriceLevel(1)
+	book := newTestBook()
+	book.bidMax = 10
+	setPriceLevel(book, Bid, 10, 3)
+	setPriceLevel(book, Bid, 9, 2)
+	setPriceLevel(book, Bid, 7, 1)
 
 	// Clear 10 (ie. all executed at that level), should move to 9
 	book.bidLevels[10] = PriceLevel{}
@@ -69,19 +85,19 @@ func TestUpdateBestBid_MultipleLevels(t *testing.T) {
 }
 
 func TestUpdateBestBid_Exhaustive(t *testing.T) {
-	book := &OrderBook{}
+	book := newTestBook()
 
 	// Single bid at 10
 	book.bidMax = 10
-	book.bidLevels[10] = makePriceLevel(2)
+	setPriceLevel(book, Bid, 10, 2)
 	book.updateBidMax()
 	if book.bidMax != 10 {
 		t.Errorf("expected bidMax 10, got %d", book.bidMax)
 	}
 
 	// Multiple levels: 10, 9, 7
-	book.bidLevels[9] = makePriceLevel(1)
-	book.bidLevels[7] = makePriceLevel(3)
+	setPriceLevel(book, Bid, 9, 1)
+	setPriceLevel(book, Bid, 7, 3)
 
 	// Clear 10 -> should move to 9
 	book.bidLevels[10] = PriceLevel{}
@@ -105,7 +121,7 @@ func TestUpdateBestBid_Exhaustive(t *testing.T) {
 	}
 
 	// Edge case: bid at price 0
-	book.bidLevels[0] = makePriceLevel(1)
+	setPriceLevel(book, Bid, 0, 1)
 	book.bidMax = 0
 	book.updateBidMax()
 	if book.bidMax != 0 {
@@ -114,22 +130,20 @@ func TestUpdateBestBid_Exhaustive(t *testing.T) {
 }
 
 func TestUpdateAskMinEmptyBook(t *testing.T) {
-	book := &OrderBook{
-		askMin: 5, // Random value
-	}
+	book := newTestBook()
+	book.askMin = 5 // Random value
 
 	// No ask levels populated
 	book.updateAskMin()
-	if book.askMin != MAX_PRICE_LEVELS {
-		t.Errorf("expected askMin MAX_PRICE_LEVELS for empty book, got %d", book.askMin)
+	if book.askMin != DEFAULT_PRICE_LEVELS {
+		t.Errorf("expected askMin DEFAULT_PRICE_LEVELS for empty book, got %d", book.askMin)
 	}
 }
 
 func TestUpdateAskMin_SinglePriceLevel(t *testing.T) {
-	book := &OrderBook{
-		askMin: 5,
-	}
-	book.askLevels[5] = makePriceLevel(2)
+	book := newTestBook()
+	book.askMin = 5
+	setPriceLevel(book, Ask, 5, 2)
 
 	// Should stay at 5
 	book.updateAskMin()
@@ -139,12 +153,11 @@ func TestUpdateAskMin_SinglePriceLevel(t *testing.T) {
 }
 
 func TestUpdateAskMin_MultipleLevels(t *testing.T) {
-	book := &OrderBook{
-		askMin: 3,
-	}
-	book.askLevels[3] = makePriceLevel(1)
-	book.askLevels[4] = makePriceLevel(2)
-	book.askLevels[6] = makePriceLevel(3)
+	book := newTestBook()
+	book.askMin = 3
+	setPriceLevel(book, Ask, 3, 1)
+	setPriceLevel(book, Ask, 4, 2)
+	setPriceLevel(book, Ask, 6, 3)
 
 	// Clear 3, should move to 4
 	book.askLevels[3] = PriceLevel{}
@@ -160,28 +173,28 @@ func TestUpdateAskMin_MultipleLevels(t *testing.T) {
 		t.Errorf("expected askMin 6, got %d", book.askMin)
 	}
 
-	// Clear 6, should reset to MAX_PRICE_LEVELS
+	// Clear 6, should reset to DEFAULT_PRICE_LEVELS
 	book.askLevels[6] = PriceLevel{}
 	book.updateAskMin()
-	if book.askMin != MAX_PRICE_LEVELS {
-		t.Errorf("expected askMin MAX_PRICE_LEVELS, got %d", book.askMin)
+	if book.askMin != DEFAULT_PRICE_LEVELS {
+		t.Errorf("expected askMin DEFAULT_PRICE_LEVELS, got %d", book.askMin)
 	}
 }
 
 func TestUpdateAskMin_Exhaustive(t *testing.T) {
-	book := &OrderBook{}
+	book := newTestBook()
 
 	// Single ask at 5
 	book.askMin = 5
-	book.askLevels[5] = makePriceLevel(2)
+	setPriceLevel(book, Ask, 5, 2)
 	book.updateAskMin()
 	if book.askMin != 5 {
 		t.Errorf("expected askMin 5, got %d", book.askMin)
 	}
 
 	// Multiple levels: 5, 7, 9
-	book.askLevels[7] = makePriceLevel(1)
-	book.askLevels[9] = makePriceLevel(3)
+	setPriceLevel(book, Ask, 7, 1)
+	setPriceLevel(book, Ask, 9, 3)
 
 	// Clear 5 -> should move to 7
 	book.askLevels[5] = PriceLevel{}
@@ -200,16 +213,146 @@ func TestUpdateAskMin_Exhaustive(t *testing.T) {
 	// Clear 9 -> empty book
 	book.askLevels[9] = PriceLevel{}
 	book.updateAskMin()
-	if book.askMin != MAX_PRICE_LEVELS {
-		t.Errorf("expected askMin MAX_PRICE_LEVELS for empty book, got %d", book.askMin)
+	if book.askMin != DEFAULT_PRICE_LEVELS {
+		t.Errorf("expected askMin DEFAULT_PRICE_LEVELS for empty book, got %d", book.askMin)
 	}
 
-	// Edge case: ask at MAX_PRICE_LEVELS-1
-	lastPrice := MAX_PRICE_LEVELS - 1
-	book.askLevels[lastPrice] = makePriceLevel(1)
+	// Edge case: ask at DEFAULT_PRICE_LEVELS-1
+	lastPrice := DEFAULT_PRICE_LEVELS - 1
+	setPriceLevel(book, Ask, Price(lastPrice), 1)
 	book.askMin = Price(lastPrice)
 	book.updateAskMin()
 	if book.askMin != Price(lastPrice) {
 		t.Errorf("expected askMin %d, got %d", lastPrice, book.askMin)
 	}
 }
+
+func TestVolumeAt_MatchesLevelsAfterRandomOperations(t *testing.T) {
+	e := newTestEngine()
+	rng := rand.New(rand.NewSource(1))
+	var ids []OrderID
+	owners := make(map[OrderID]TraderID)
+
+	for i := 0; i < 5000; i++ {
+		switch op := rng.Intn(12); {
+		case op < 6 || len(ids) == 0:
+			side := Side(rng.Intn(2))
+			cmd := &InputCommand{symbol: 1, side: side, price: Price(90 + rng.Intn(21)), size: Size(1 + rng.Intn(20)), trader: TraderID(rng.Intn(5))}
+			if rng.Intn(4) == 0 {
+				cmd.peakSize = Size(1 + rng.Intn(5))
+			}
+			e.LimitCommand(cmd)
+		case op < 8:
+			id := ids[rng.Intn(len(ids))]
+			e.Cancel(id, owners[id])
+		case op < 9: // Partial cancel, often of a partly filled order
+			id := ids[rng.Intn(len(ids))]
+			e.CancelQty(id, Size(1+rng.Intn(10)), owners[id])
+		case op < 10:
+			e.Market(&InputCommand{symbol: 1, side: Side(rng.Intn(2)), size: Size(1 + rng.Intn(30)), trader: TraderID(rng.Intn(5))})
+		default:
+			id := ids[rng.Intn(len(ids))]
+			e.Amend(id, Price(90+rng.Intn(21)), Size(1+rng.Intn(30)), owners[id])
+		}
+
+		for _, ev := range drainOutputEvents(e) {
+			if ev.eventType == ORDER_EVENT {
+				ids = append(ids, ev.orderID)
+				owners[ev.orderID] = ev.trader
+			}
+		}
+		checkLevelVolumes(t, e, 1, 90, 110, i)
+	}
+	checkLevelVolumes(t, e, 1, 0, DEFAULT_PRICE_LEVELS-1, -1)
+}
+
+// Helper to compare every level's volume in [lo, hi] with a walk of its queued orders
+func checkLevelVolumes(t *testing.T, e *MatchingEngine, symbol Symbol, lo, hi Price, op int) {
+	t.Helper()
+	book := &e.books[symbol]
+	for price := lo; price <= hi; price++ {
+		for _, side := range []Side{Bid, Ask} {
+			var want Size
+			for slot := book.level(side, price).headSlot; slot != 0; slot = e.pool.get(slot).nextSlot {
+				want += e.pool.get(slot).size
+			}
+			if got := book.VolumeAt(side, price); got != want {
+				t.Fatalf("after op %d, side %d price %d: VolumeAt %d, level holds %d", op, side, price, got, want)
+			}
+		}
+	}
+}
+
+// Worst case for finding the next best price: the best ask clears, leaving only a level at the far end
+func BenchmarkUpdateAskMin_FarLevel(b *testing.B) {
+	book := newTestBook()
+	setPriceLevel(book, Ask, DEFAULT_PRICE_LEVELS-1, 1)
+
+	for i := 0; i < b.N; i++ {
+		setPriceLevel(book, Ask, 1, 1)
+		book.askMin = 1
+		book.askLevels[1] = PriceLevel{}
+		book.updateAskMin()
+	}
+}
+
+// Worst case for finding the next best price: the best bid clears, leaving only a level at the far end
+func BenchmarkUpdateBidMax_FarLevel(b *testing.B) {
+	book := newTestBook()
+	setPriceLevel(book, Bid, 1, 1)
+
+	for i := 0; i < b.N; i++ {
+		setPriceLevel(book, Bid, DEFAULT_PRICE_LEVELS-1, 1)
+		book.bidMax = DEFAULT_PRICE_LEVELS - 1
+		book.bidLevels[DEFAULT_PRICE_LEVELS-1] = PriceLevel{}
+		book.updateBidMax()
+	}
+}
+
+func TestValidate_ReportsCorruptBooks(t *testing.T) {
+	corruptions := map[string]func(e *MatchingEngine, book *OrderBook){
+		"level volume":  func(e *MatchingEngine, book *OrderBook) { book.bidLevels[100].volume++ },
+		"stale bidMax":  func(e *MatchingEngine, book *OrderBook) { book.bidMax = 101 },
+		"missed askMin": func(e *MatchingEngine, book *OrderBook) { book.askMin = 111 },
+		"bitmap":        func(e *MatchingEngine, book *OrderBook) { book.askBits.clear(110) },
+		"tail":          func(e *MatchingEngine, book *OrderBook) { book.bidLevels[100].tailSlot = book.bidLevels[100].headSlot },
+		"back link":     func(e *MatchingEngine, book *OrderBook) { e.pool.get(book.bidLevels[100].tailSlot).prevSlot = 0 },
+		"cycle": func(e *MatchingEngine, book *OrderBook) {
+			level := book.bidLevels[100]
+			e.pool.get(level.tailSlot).nextSlot = level.headSlot
+		},
+	}
+	for name, corrupt := range corruptions {
+		e := newTestEngine()
+		limit(e, 1, Bid, 100, 5, 1, GTC)
+		limit(e, 1, Bid, 100, 3, 2, GTC)
+		limit(e, 1, Ask, 110, 4, 3, GTC)
+		limit(e, 1, Ask, 111, 4, 3, GTC)
+		book := &e.books[1]
+		if err := book.Validate(e.pool); err != nil {
+			t.Fatalf("expected a valid book before corrupting the %s, got %v", name, err)
+		}
+		corrupt(e, book)
+		if err := book.Validate(e.pool); !errors.Is(err, ErrBookInvalid) {
+			t.Errorf("expected ErrBookInvalid after corrupting the %s, got %v", name, err)
+		}
+	}
+}
+
+func TestCheckUncrossed_PanicsOnlyOutsideAuctions(t *testing.T) {
+	if !checkBooks {
+		t.Skip("the crossed-book check needs -tags bookcheck")
+	}
+	e := newTestEngine()
+	e.StartAuction(1)
+	limit(e, 1, Bid, 110, 5, 1, GTC)
+	limit(e, 1, Ask, 100, 5, 2, GTC) // Crossed, as an auction allows
+
+	e.auctions[1] = false // As if the auction ended without uncrossing
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected resting an order on a crossed continuous book to panic")
+		}
+	}()
+	limit(e, 1, Bid, 50, 1, 3, GTC)
+}
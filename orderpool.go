@@ -1,35 +1,116 @@
 package main
 
 type OrderPool struct {
-	orders       [MAX_ORDERS]Order
+	orders       []Order
 	freeHead     Slot // Head of the free list (0 means empty)
 	nextFreeSlot Slot // Next slot to allocate if free list is empty
+
+	traderHeads [MAX_TRADERS]Slot // Newest working order of each trader (0 means none)
+	clOrdIDs    map[clOrdKey]Slot // Working orders by client order ID (see tag)
+
+	groups     map[Slot]groupLink // OCO group ring of each working grouped order (see group)
+	groupHeads map[groupKey]Slot  // A working member of each OCO group
 }
 
-func NewOrderPool() *OrderPool {
-	return &OrderPool{}
+// A client order ID, which is only unique among its trader's orders
+type clOrdKey struct {
+	trader  TraderID
+	clOrdID uint64
 }
 
-func (p *OrderPool) alloc() (Slot, Gen) {
+// NewOrderPool allocates a pool of size slots (slot 0 is never used, so it holds size-1 orders)
+func NewOrderPool(size Slot) *OrderPool {
+	return &OrderPool{orders: make([]Order, size), clOrdIDs: make(map[clOrdKey]Slot), groups: make(map[Slot]groupLink), groupHeads: make(map[groupKey]Slot)}
+}
+
+// Allocate a slot, reporting false once every slot holds a live order (slot 0 is never used).
+// An OrderID packs the slot's generation above SLOT_BITS, so IDs stay unique however many orders
+// pass through a slot, until its 32-bit generation wraps
+func (p *OrderPool) alloc() (Slot, Gen, bool) {
 	var slot Slot
 	if p.freeHead != 0 {
 		slot = p.freeHead
 		p.freeHead = p.orders[slot].nextSlot
-	} else {
+	} else if p.nextFreeSlot < Slot(len(p.orders))-1 {
 		p.nextFreeSlot++
 		slot = p.nextFreeSlot
+	} else {
+		return 0, 0, false
 	}
-	return slot, p.orders[slot].gen
+	return slot, p.orders[slot].gen, true
 }
 
 func (p *OrderPool) free(slot Slot) {
+	p.ungroup(slot)
+	p.untrack(slot)
+	p.untag(slot)
+
 	order := &p.orders[slot]
 	order.gen++
 	order.size = 0
+	order.flags = 0
 	order.nextSlot = p.freeHead
 	p.freeHead = slot
 }
 
+// Link an accepted order into its trader's list of working orders, so every order of a trader can be
+// found without scanning the pool. Freeing the slot unlinks it again
+func (p *OrderPool) track(slot Slot, trader TraderID) {
+	order := &p.orders[slot]
+	order.trader = trader
+	order.traderPrev = 0
+	order.traderNext = p.traderHeads[trader]
+	if order.traderNext != 0 {
+		p.orders[order.traderNext].traderPrev = slot
+	}
+	p.traderHeads[trader] = slot
+}
+
+// Unlink a slot from its trader's list of working orders (a no-op for a slot that was never tracked)
+func (p *OrderPool) untrack(slot Slot) {
+	order := &p.orders[slot]
+	if order.traderPrev != 0 {
+		p.orders[order.traderPrev].traderNext = order.traderNext
+	} else if p.traderHeads[order.trader] == slot {
+		p.traderHeads[order.trader] = order.traderNext
+	} else {
+		return
+	}
+	if order.traderNext != 0 {
+		p.orders[order.traderNext].traderPrev = order.traderPrev
+	}
+	order.traderPrev, order.traderNext = 0, 0
+}
+
+// Give a tracked order its client order ID (0 for none), so lookup can find it. A trader reusing the
+// client order ID of a working order takes it over: lookup finds the newer order from then on, and
+// the older one can only be addressed by its OrderID (and loses its entry if the newer one finishes
+// first). Freeing the slot drops the entry if it still names this order
+func (p *OrderPool) tag(slot Slot, clOrdID uint64) {
+	order := &p.orders[slot]
+	order.clOrdID = clOrdID
+	if clOrdID != 0 {
+		p.clOrdIDs[clOrdKey{order.trader, clOrdID}] = slot
+	}
+}
+
+func (p *OrderPool) untag(slot Slot) {
+	order := &p.orders[slot]
+	if order.clOrdID == 0 {
+		return
+	}
+	if key := (clOrdKey{order.trader, order.clOrdID}); p.clOrdIDs[key] == slot {
+		delete(p.clOrdIDs, key)
+	}
+	order.clOrdID = 0
+}
+
+// Slot of a trader's working order with the given client order ID (see tag)
+func (p *OrderPool) lookup(trader TraderID, clOrdID uint64) (Slot, bool) {
+	slot, ok := p.clOrdIDs[clOrdKey{trader, clOrdID}]
+	return slot, ok
+}
+
 func (p *OrderPool) get(slot Slot) *Order {
 	return &p.orders[slot]
 }
@@ -37,3 +118,42 @@ func (p *OrderPool) get(slot Slot) *Order {
 func (p *OrderPool) isValid(slot Slot) bool {
 	return slot != 0 && slot <= p.nextFreeSlot
 }
+
+// Report whether a slot is unallocated: never handed out yet, or on the free list (walked, so this is
+// only for rare paths such as restoring a snapshot)
+func (p *OrderPool) isFree(slot Slot) bool {
+	if slot == 0 || slot >= Slot(len(p.orders)) {
+		return false
+	}
+	if slot > p.nextFreeSlot {
+		return true
+	}
+	for free := p.freeHead; free != 0; free = p.orders[free].nextSlot {
+		if free == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// Allocate a specific free slot under a given generation (see isFree), so a restored order keeps its
+// OrderID. Slots skipped over while growing the pool go onto the free list
+func (p *OrderPool) claim(slot Slot, gen Gen) {
+	if slot > p.nextFreeSlot {
+		for skipped := p.nextFreeSlot + 1; skipped < slot; skipped++ {
+			p.orders[skipped].nextSlot = p.freeHead
+			p.freeHead = skipped
+		}
+		p.nextFreeSlot = slot
+	} else if p.freeHead == slot {
+		p.freeHead = p.orders[slot].nextSlot
+	} else {
+		for prev := p.freeHead; prev != 0; prev = p.orders[prev].nextSlot {
+			if p.orders[prev].nextSlot == slot {
+				p.orders[prev].nextSlot = p.orders[slot].nextSlot
+				break
+			}
+		}
+	}
+	p.orders[slot].gen = gen
+}
@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+// Cancelling far more orders than any fixed-size free list could hold must leave every slot reusable
+func TestOrderPool_CancelledSlotsAreAllReused(t *testing.T) {
+	e := newTestEngine()
+	const orders = 5000
+
+	ids := make([]OrderID, 0, orders)
+	for i := 0; i < orders; i++ {
+		e.Limit(1, Bid, 10, 1, 1, GTC)
+		ids = append(ids, drainOutputEvents(e)[0].orderID)
+	}
+	for _, id := range ids {
+		e.Cancel(id, 1)
+	}
+	drainOutputEvents(e)
+
+	highWater := e.pool.nextFreeSlot
+	if highWater != orders {
+		t.Fatalf("expected %d slots handed out, got %d", orders, highWater)
+	}
+
+	// A second round fits entirely in the recycled slots
+	seen := make(map[Slot]bool)
+	for i := 0; i < orders; i++ {
+		e.Limit(1, Bid, 10, 1, 1, GTC)
+		seen[Slot(drainOutputEvents(e)[0].orderID&SLOT_MASK)] = true
+	}
+	if e.pool.nextFreeSlot != highWater || len(seen) != orders {
+		t.Fatalf("expected all %d slots reused, high water %d -> %d, distinct %d", orders, highWater, e.pool.nextFreeSlot, len(seen))
+	}
+}
+
+// Running out of slots rejects new orders rather than indexing past the pool
+func TestOrderPool_ExhaustionRejects(t *testing.T) {
+	e := newTestEngine()
+	e.pool.nextFreeSlot = TEST_MAX_ORDERS - 2 // Pretend all but the last slot are live
+
+	e.Limit(1, Bid, 10, 1, 1, GTC)
+	events := drainOutputEvents(e)
+	if len(events) != 2 || events[0].eventType != ORDER_EVENT || Slot(events[0].orderID&SLOT_MASK) != TEST_MAX_ORDERS-1 {
+		t.Fatalf("expected the last slot to be used, got %+v", events)
+	}
+	last := events[0].orderID
+
+	e.Limit(1, Bid, 10, 1, 1, GTC)
+	events = drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT || events[0].reason != REJECT_POOL_EXHAUSTED {
+		t.Fatalf("expected REJECT_EVENT with REJECT_POOL_EXHAUSTED, got %+v", events)
+	}
+
+	// Freeing a slot makes room again
+	e.Cancel(last, 1)
+	e.Limit(1, Bid, 10, 1, 1, GTC)
+	events = drainOutputEvents(e)
+	if len(events) != 3 || events[1].eventType != ORDER_EVENT || events[1].orderID == last {
+		t.Fatalf("expected a new order in the recycled slot, got %+v", events)
+	}
+}
+
+// A late cancel for an order whose slot has been recycled must not touch the slot's new order
+func TestOrderPool_StaleCancelAfterSlotReuse(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	filled := drainOutputEvents(e)[0].orderID
+	e.Limit(1, Bid, 10, 5, 2, GTC) // Fills the ask, freeing its slot (and the bid's)
+	drainOutputEvents(e)
+
+	// The free list is LIFO, so the second new order lands in the filled ask's slot
+	e.Limit(1, Bid, 8, 3, 3, GTC)
+	e.Limit(1, Bid, 9, 4, 4, GTC)
+	events := drainOutputEvents(e)
+	reused := events[2].orderID
+	if reused&SLOT_MASK != filled&SLOT_MASK || reused == filled {
+		t.Fatalf("expected slot %d reused under a new ID, got %d", filled&SLOT_MASK, reused)
+	}
+
+	e.Cancel(filled, 1)
+	events = drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != REJECT_EVENT {
+		t.Fatalf("expected REJECT_EVENT for the stale ID, got %+v", events)
+	}
+	if exists, remaining, price, _, _ := e.OrderStatus(reused); !exists || remaining != 4 || price != 9 {
+		t.Fatalf("expected the new order in the reused slot untouched, got %v %d %d", exists, remaining, price)
+	}
+}
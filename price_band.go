@@ -0,0 +1,36 @@
+package main
+
+// Set a symbol's price band: limit orders (and amends) priced more than bandBps basis points away
+// from the reference price are rejected with REJECT_PRICE_BAND. A band of 0 disables the check
+func (e *MatchingEngine) SetPriceBand(symbol Symbol, bandBps uint32) {
+	if symbol < MAX_SYMBOLS {
+		e.bandBps[symbol] = bandBps
+	}
+}
+
+// Set the price a symbol's band is centred on (eg. the previous close). With no reference set (0),
+// the band follows the symbol's last traded price instead
+func (e *MatchingEngine) SetReferencePrice(symbol Symbol, price Price) {
+	if symbol < MAX_SYMBOLS {
+		e.referencePrices[symbol] = price
+	}
+}
+
+// Report whether price lies within the symbol's band, [ref*(1-band), ref*(1+band)] rounded outwards.
+// Without a band, or with no reference price yet (never traded), every price is allowed
+func (e *MatchingEngine) withinBand(symbol Symbol, price Price) bool {
+	band := e.bandBps[symbol]
+	if band == 0 {
+		return true
+	}
+	ref := e.referencePrices[symbol]
+	if ref == 0 {
+		ref = e.books[symbol].lastPrice
+	}
+	if ref == 0 {
+		return true
+	}
+
+	width := (uint64(ref)*uint64(band) + 9_999) / 10_000
+	return uint64(price)+width >= uint64(ref) && uint64(price) <= uint64(ref)+width
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestPriceBand_RejectsOutsideReference(t *testing.T) {
+	e := newTestEngine()
+	e.SetPriceBand(1, 1_000) // 10%
+	e.SetReferencePrice(1, 1_000)
+
+	for _, price := range []Price{900, 1_000, 1_100} {
+		limit(e, 1, Bid, price, 1, 1, GTC)
+	}
+	for _, price := range []Price{899, 1_101} {
+		limit(e, 1, Bid, price, 1, 1, GTC)
+	}
+
+	evs := drainOutputEvents(e)
+	if len(evs) != 8 {
+		t.Fatalf("expected 8 events, got %+v", evs)
+	}
+	for i := 0; i < 3; i++ {
+		if evs[2*i].eventType != ORDER_EVENT || evs[2*i+1].eventType != RESTED_EVENT {
+			t.Fatalf("order %d: expected a price on the band edge to be accepted, got %+v", i, evs[2*i:2*i+2])
+		}
+	}
+	for i, ev := range evs[6:] {
+		if ev.eventType != REJECT_EVENT || ev.reason != REJECT_PRICE_BAND {
+			t.Fatalf("order %d: expected REJECT_PRICE_BAND, got %+v", i+3, ev)
+		}
+	}
+
+	// Amends are held to the band too
+	e.Amend(evs[2].orderID, 1_200, 1, evs[2].trader)
+	if evs := drainOutputEvents(e); len(evs) != 1 || evs[0].reason != REJECT_PRICE_BAND {
+		t.Fatalf("expected the amend outside the band to be rejected, got %+v", evs)
+	}
+}
+
+func TestPriceBand_FollowsLastTradeAndIsOffUntilFirstTrade(t *testing.T) {
+	e := newTestEngine()
+	e.SetPriceBand(1, 500) // 5%
+
+	// Never traded and no reference: the band is disabled rather than rejecting everything
+	limit(e, 1, Ask, 100, 1, 1, GTC)
+	limit(e, 1, Bid, 100, 1, 2, GTC) // Trades at 100
+	limit(e, 1, Bid, 200, 1, 2, GTC)
+	limit(e, 1, Bid, 95, 1, 2, GTC)
+
+	evs := drainOutputEvents(e)
+	var rejects int
+	for _, ev := range evs {
+		if ev.eventType == REJECT_EVENT {
+			rejects++
+		}
+	}
+	last := evs[len(evs)-2] // Followed by its RESTED_EVENT
+	if rejects != 1 || evs[len(evs)-3].reason != REJECT_PRICE_BAND || last.eventType != ORDER_EVENT || last.price != 95 {
+		t.Fatalf("expected only the order at 200 to breach the band around the last trade, got %+v", evs)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import "math/bits"
+
+// Two-level bitmap of non-empty price levels, so the next best price is found with a couple of
+// bit scans rather than a linear walk over the level array
+type priceBitmap struct {
+	summary []uint64 // Bit w set when words[w] is non-zero
+	words   []uint64 // Bit p set when price level p is non-empty
+	levels  Price    // Prices tracked (0..levels-1)
+}
+
+func newPriceBitmap(levels Price) priceBitmap {
+	words := (levels + 63) / 64
+	return priceBitmap{summary: make([]uint64, (words+63)/64), words: make([]uint64, words), levels: levels}
+}
+
+func (b *priceBitmap) set(price Price) {
+	w := price >> 6
+	b.words[w] |= 1 << (price & 63)
+	b.summary[w>>6] |= 1 << (w & 63)
+}
+
+func (b *priceBitmap) clear(price Price) {
+	w := price >> 6
+	b.words[w] &^= 1 << (price & 63)
+	if b.words[w] == 0 {
+		b.summary[w>>6] &^= 1 << (w & 63)
+	}
+}
+
+// Lowest set price at or above price, or levels if there is none
+func (b *priceBitmap) next(price Price) Price {
+	if price >= b.levels {
+		return b.levels
+	}
+
+	w := price >> 6
+	if m := b.words[w] & (^uint64(0) << (price & 63)); m != 0 {
+		return w<<6 + Price(bits.TrailingZeros64(m))
+	}
+
+	// Find the next non-empty word after w
+	for w++; w < Price(len(b.words)); w = (w | 63) + 1 {
+		if m := b.summary[w>>6] & (^uint64(0) << (w & 63)); m != 0 {
+			w = w&^63 + Price(bits.TrailingZeros64(m))
+			return w<<6 + Price(bits.TrailingZeros64(b.words[w]))
+		}
+	}
+	return b.levels
+}
+
+// Highest set price at or below price, or 0 if there is none
+func (b *priceBitmap) prev(price Price) Price {
+	if price >= b.levels {
+		price = b.levels - 1
+	}
+
+	w := price >> 6
+	if m := b.words[w] & (^uint64(0) >> (63 - price&63)); m != 0 {
+		return w<<6 + Price(63-bits.LeadingZeros64(m))
+	}
+
+	// Find the previous non-empty word before w
+	for w > 0 {
+		w--
+		if m := b.summary[w>>6] & (^uint64(0) >> (63 - w&63)); m != 0 {
+			w = w&^63 + Price(63-bits.LeadingZeros64(m))
+			return w<<6 + Price(63-bits.LeadingZeros64(b.words[w]))
+		}
+		w &^= 63 // Nothing left in this summary word
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestPriceBitmap_MatchesLinearScan(t *testing.T) {
+	b := newPriceBitmap(DEFAULT_PRICE_LEVELS)
+	var levels [DEFAULT_PRICE_LEVELS]bool
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 20000; i++ {
+		price := Price(rng.Intn(DEFAULT_PRICE_LEVELS))
+		if rng.Intn(2) == 0 {
+			b.set(price)
+			levels[price] = true
+		} else {
+			b.clear(price)
+			levels[price] = false
+		}
+
+		probe := Price(rng.Intn(DEFAULT_PRICE_LEVELS))
+
+		want := Price(DEFAULT_PRICE_LEVELS)
+		for p := probe; p < DEFAULT_PRICE_LEVELS; p++ {
+			if levels[p] {
+				want = p
+				break
+			}
+		}
+		if got := b.next(probe); got != want {
+			t.Fatalf("next(%d): expected %d, got %d", probe, want, got)
+		}
+
+		want = 0
+		for p := probe; p > 0; p-- {
+			if levels[p] {
+				want = p
+				break
+			}
+		}
+		if got := b.prev(probe); got != want {
+			t.Fatalf("prev(%d): expected %d, got %d", probe, want, got)
+		}
+	}
+}
+
+func TestPriceBitmap_PartialWord(t *testing.T) {
+	b := newPriceBitmap(100)
+
+	if b.next(0) != 100 || b.prev(1000) != 0 {
+		t.Fatalf("expected an empty bitmap to report no prices")
+	}
+	b.set(99)
+	if b.next(0) != 99 || b.next(100) != 100 || b.prev(1000) != 99 {
+		t.Fatalf("expected 99 found from both directions, got next %d prev %d", b.next(0), b.prev(1000))
+	}
+}
+
+func TestPriceBitmap_Edges(t *testing.T) {
+	b := newPriceBitmap(DEFAULT_PRICE_LEVELS)
+
+	if b.next(0) != DEFAULT_PRICE_LEVELS || b.prev(DEFAULT_PRICE_LEVELS-1) != 0 {
+		t.Fatalf("expected an empty bitmap to report no prices")
+	}
+
+	b.set(DEFAULT_PRICE_LEVELS - 1)
+	b.set(1)
+	if got := b.next(2); got != DEFAULT_PRICE_LEVELS-1 {
+		t.Fatalf("expected next(2) = %d, got %d", DEFAULT_PRICE_LEVELS-1, got)
+	}
+	if got := b.prev(DEFAULT_PRICE_LEVELS - 2); got != 1 {
+		t.Fatalf("expected prev(%d) = 1, got %d", DEFAULT_PRICE_LEVELS-2, got)
+	}
+
+	b.clear(DEFAULT_PRICE_LEVELS - 1)
+	if got := b.next(2); got != DEFAULT_PRICE_LEVELS {
+		t.Fatalf("expected next(2) = DEFAULT_PRICE_LEVELS after clearing, got %d", got)
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
-// Pricelevel serving as a FIFO queue of orders at a specific price
+// Pricelevel serving as a queue of orders at a specific price, matched from the head (FIFO unless
+// the engine's match mode is LIFO)
 type PriceLevel struct {
-	headSlot Slot // First order (oldest)
-	tailSlot Slot // Last order (newest)
+	headSlot Slot // First order, next to match (the oldest, or under LIFO the newest)
+	tailSlot Slot // Last order
+	volume   Size // Total visible size of the queued orders
 }
 
 // pushBack adds a new order to the tail of this price level
@@ -21,10 +23,50 @@ func (level *PriceLevel) pushBack(pool *OrderPool, slot Slot) {
 		order.prevSlot = level.tailSlot
 	}
 	level.tailSlot = slot
+	level.volume += order.size
+}
+
+// pushFront adds a new order to the head of this price level, ahead of every order queued there
+func (level *PriceLevel) pushFront(pool *OrderPool, slot Slot) {
+	order := pool.get(slot)
+
+	order.prevSlot = 0
+	order.nextSlot = level.headSlot
+
+	if level.headSlot == 0 {
+		level.tailSlot = slot
+	} else {
+		pool.get(level.headSlot).prevSlot = slot
+	}
+	level.headSlot = slot
+	level.volume += order.size
 }
 
 // remove unlinks an order and returns it to the free pool
 func (level *PriceLevel) remove(pool *OrderPool, slot Slot) {
+	level.unlink(pool, slot)
+	pool.free(slot)
+}
+
+// holds reports whether an order is linked into this price level's queue, checking only its
+// neighbours' links back to it (or the level's head and tail) so a cancel can afford it
+func (level *PriceLevel) holds(pool *OrderPool, slot Slot) bool {
+	order := pool.get(slot)
+	if order.prevSlot == 0 {
+		if level.headSlot != slot {
+			return false
+		}
+	} else if !pool.isValid(order.prevSlot) || pool.get(order.prevSlot).nextSlot != slot {
+		return false
+	}
+	if order.nextSlot == 0 {
+		return level.tailSlot == slot
+	}
+	return pool.isValid(order.nextSlot) && pool.get(order.nextSlot).prevSlot == slot
+}
+
+// unlink detaches an order from this price level, leaving its slot allocated
+func (level *PriceLevel) unlink(pool *OrderPool, slot Slot) {
 	order := pool.get(slot)
 
 	if order.prevSlot != 0 {
@@ -38,6 +80,5 @@ func (level *PriceLevel) remove(pool *OrderPool, slot Slot) {
 	} else {
 		level.tailSlot = order.prevSlot
 	}
-
-	pool.free(slot)
+	level.volume -= order.size
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+const MAX_PRICE_DECIMALS = 9 // Most decimal places a price unit can stand for (10^9 still fits a uint32)
+
+var (
+	ErrPriceSyntax    = errors.New("price: not a plain decimal number")
+	ErrPricePrecision = errors.New("price: finer than the symbol's price scale or tick size")
+	ErrPriceRange     = errors.New("price: zero or beyond the engine's price levels")
+)
+
+// Powers of ten up to 10^MAX_PRICE_DECIMALS
+var pow10 = [MAX_PRICE_DECIMALS + 1]uint64{1, 10, 100, 1_000, 10_000, 100_000, 1_000_000, 10_000_000, 100_000_000, 1_000_000_000}
+
+// SetPriceDecimals sets how many decimal places a price unit stands for in a symbol's text prices:
+// with 2, Price 12345 reads "123.45". The engine itself only ever sees integer prices; the scale
+// applies at the boundary, in ParsePrice and AppendPrice. Decimals above MAX_PRICE_DECIMALS are
+// ignored. Like SetTickSize, set it before trading starts
+func (e *MatchingEngine) SetPriceDecimals(symbol Symbol, decimals uint8) {
+	if symbol < MAX_SYMBOLS && decimals <= MAX_PRICE_DECIMALS {
+		e.priceDecimals[symbol] = decimals
+	}
+}
+
+// ParsePrice converts a client's decimal price ("123.45", "123", "123.450") into the symbol's
+// integer Price. Signs, exponents, separators and a bare "." are refused with ErrPriceSyntax. Digits
+// past the symbol's decimal places must be zeros, and the result must be a whole number of ticks,
+// or it is refused with ErrPricePrecision rather than rounded. A zero price, or one at or beyond
+// the engine's price levels, is refused with ErrPriceRange (however many digits it has, so the
+// conversion never overflows)
+func (e *MatchingEngine) ParsePrice(symbol Symbol, s string) (Price, error) {
+	if symbol >= MAX_SYMBOLS {
+		return 0, ErrPriceRange
+	}
+	decimals := int(e.priceDecimals[symbol])
+
+	whole, fraction, dotted := s, "", false
+	for i := 0; i < len(s); i++ {
+		if s[i] == '.' {
+			whole, fraction, dotted = s[:i], s[i+1:], true
+			break
+		}
+	}
+	if whole == "" || (dotted && fraction == "") || !digits(whole) || !digits(fraction) {
+		return 0, ErrPriceSyntax
+	}
+	for i := decimals; i < len(fraction); i++ {
+		if fraction[i] != '0' {
+			return 0, ErrPricePrecision
+		}
+	}
+
+	// Any value of MAX_PRICE_LEVELS or more is out of range, so stop accumulating well before uint64 overflows
+	var price uint64
+	for i := 0; i < len(whole); i++ {
+		price = price*10 + uint64(whole[i]-'0')
+		if price*pow10[decimals] >= uint64(e.priceLevels) {
+			return 0, ErrPriceRange
+		}
+	}
+	price *= pow10[decimals]
+	for i := 0; i < decimals && i < len(fraction); i++ {
+		price += uint64(fraction[i]-'0') * pow10[decimals-1-i]
+	}
+
+	if price == 0 || price >= uint64(e.priceLevels) {
+		return 0, ErrPriceRange
+	}
+	if !e.validTick(symbol, Price(price)) {
+		return 0, ErrPricePrecision
+	}
+	return Price(price), nil
+}
+
+// Report whether s is all ASCII digits (true for "")
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// AppendPrice appends price as a decimal in the symbol's price scale (see SetPriceDecimals), with
+// exactly its number of decimal places, so ParsePrice reads it back unchanged
+func (e *MatchingEngine) AppendPrice(buf []byte, symbol Symbol, price Price) []byte {
+	var decimals int
+	if symbol < MAX_SYMBOLS {
+		decimals = int(e.priceDecimals[symbol])
+	}
+	buf = strconv.AppendUint(buf, uint64(price)/pow10[decimals], 10)
+	if decimals == 0 {
+		return buf
+	}
+
+	buf = append(buf, '.')
+	fraction := uint64(price) % pow10[decimals]
+	for i := decimals - 1; i >= 0; i-- {
+		buf = append(buf, byte('0'+fraction/pow10[i]%10))
+	}
+	return buf
+}
+
+// FormatPrice is AppendPrice to a new string
+func (e *MatchingEngine) FormatPrice(symbol Symbol, price Price) string {
+	return string(e.AppendPrice(nil, symbol, price))
+}
@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestParsePrice(t *testing.T) {
+	e := newTestEngine()
+	e.SetPriceDecimals(1, 2)
+	e.SetPriceDecimals(2, 2)
+	e.SetTickSize(2, 5) // Nickels
+
+	cases := []struct {
+		symbol Symbol
+		s      string
+		want   Price
+		err    error
+	}{
+		{1, "123.45", 12345, nil},
+		{1, "123.4", 12340, nil},
+		{1, "123", 12300, nil},
+		{1, "123.450000", 12345, nil}, // Trailing zeros are not extra precision
+		{1, "0.01", 1, nil},
+		{1, "00163.83", 16383, nil},
+		{3, "16383", 16383, nil}, // No scale set: whole units
+		{2, "1.05", 105, nil},
+		{1, "123.456", 0, ErrPricePrecision},
+		{2, "1.04", 0, ErrPricePrecision},
+		{3, "7.5", 0, ErrPricePrecision},
+		{1, "0", 0, ErrPriceRange},
+		{1, "0.00", 0, ErrPriceRange},
+		{1, "163.84", 0, ErrPriceRange},                     // The first price beyond the default levels
+		{1, "99999999999999999999999.99", 0, ErrPriceRange}, // Never overflows
+		{MAX_SYMBOLS, "1", 0, ErrPriceRange},
+		{1, "", 0, ErrPriceSyntax},
+		{1, ".5", 0, ErrPriceSyntax},
+		{1, "5.", 0, ErrPriceSyntax},
+		{1, "-1.00", 0, ErrPriceSyntax},
+		{1, "+1", 0, ErrPriceSyntax},
+		{1, "1e2", 0, ErrPriceSyntax},
+		{1, "1,000.00", 0, ErrPriceSyntax},
+		{1, "1.2.3", 0, ErrPriceSyntax},
+	}
+	for _, c := range cases {
+		if got, err := e.ParsePrice(c.symbol, c.s); got != c.want || err != c.err {
+			t.Errorf("ParsePrice(%d, %q): expected (%d, %v), got (%d, %v)", c.symbol, c.s, c.want, c.err, got, err)
+		}
+	}
+}
+
+func TestFormatPrice_RoundTrips(t *testing.T) {
+	e := newTestEngine()
+	e.SetPriceDecimals(1, 2)
+	e.SetPriceDecimals(2, 4)
+	e.SetPriceDecimals(3, MAX_PRICE_DECIMALS+1) // Ignored
+
+	cases := []struct {
+		symbol Symbol
+		price  Price
+		want   string
+	}{
+		{1, 12345, "123.45"},
+		{1, 12300, "123.00"},
+		{1, 1, "0.01"},
+		{2, 16383, "1.6383"},
+		{2, 7, "0.0007"},
+		{3, 500, "500"},
+	}
+	for _, c := range cases {
+		got := e.FormatPrice(c.symbol, c.price)
+		if got != c.want {
+			t.Errorf("FormatPrice(%d, %d): expected %q, got %q", c.symbol, c.price, c.want, got)
+		}
+		if back, err := e.ParsePrice(c.symbol, got); back != c.price || err != nil {
+			t.Errorf("ParsePrice(%d, %q): expected %d back, got (%d, %v)", c.symbol, got, c.price, back, err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+// Pro-rata counterpart of matchLevel: an incoming order smaller than the level's visible volume is
+// allocated across the resting orders in proportion to their visible sizes, rounding each share
+// down. The leftover lots from rounding are then handed out one at a time to the oldest orders
+// (from the head of the queue), so allocation is deterministic. Orders allocated nothing are
+// untouched. If the incoming order covers the whole level, or self-trade prevention applies to an
+// order at the level, the level is matched FIFO instead
+func (e *MatchingEngine) matchLevelProRata(book *OrderBook, level *PriceLevel, remaining Size, price Price, symbol Symbol, trader TraderID, id OrderID) (Size, bool) {
+	var volume uint64
+	var count int
+	for slot := level.headSlot; slot != 0; {
+		order := e.pool.get(slot)
+		if e.stpMode != STP_NONE && order.trader == trader {
+			return e.matchLevel(book, level, remaining, price, symbol, trader, id)
+		}
+		volume += uint64(order.size)
+		count++
+		slot = order.nextSlot
+	}
+
+	if uint64(remaining) >= volume {
+		return e.matchLevel(book, level, remaining, price, symbol, trader, id)
+	}
+
+	// Lots left over once every order's proportional share is rounded down
+	leftover := uint64(remaining)
+	for slot := level.headSlot; slot != 0; {
+		order := e.pool.get(slot)
+		leftover -= uint64(remaining) * uint64(order.size) / volume
+		slot = order.nextSlot
+	}
+
+	// Walk exactly the original orders, as an iceberg refilled on the way is re-queued at the tail
+	total := remaining
+	counterSlot := level.headSlot
+	for i := 0; i < count; i++ {
+		counterOrder := e.pool.get(counterSlot)
+		nextCounterSlot := counterOrder.nextSlot
+
+		fillSize := Size(uint64(total) * uint64(counterOrder.size) / volume)
+		if leftover > 0 {
+			fillSize++
+			leftover--
+		}
+
+		if fillSize > 0 {
+			e.fill(book, level, counterSlot, fillSize, price, symbol, trader, id)
+			remaining -= fillSize
+		}
+		counterSlot = nextCounterSlot
+	}
+	return remaining, false
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Per-trader token bucket, for ingest paths to call before inputRing.Push so a misbehaving client
+// is throttled before its commands reach the engine. Implemented as GCRA: each trader's bucket is a
+// single atomic "theoretical arrival time", so Allow is one load and one CAS with no locks, and
+// traders never contend with each other
+type RateLimiter struct {
+	interval  int64 // Nanos each command costs (1/rate)
+	tolerance int64 // How far ahead of now a trader's arrival time may run (burst-1 intervals)
+	tat       [MAX_TRADERS]atomic.Int64
+}
+
+// NewRateLimiter allows each trader rate commands per second on average, in bursts of up to burst.
+// The clock has nanosecond resolution, so rates above 1e9 per second are held to one command per
+// nanosecond
+func NewRateLimiter(rate float64, burst uint32) *RateLimiter {
+	if rate <= 0 || burst == 0 {
+		panic("rate limiter: rate and burst must be positive")
+	}
+	interval := max(int64(float64(time.Second)/rate), 1) // A zero interval would never throttle
+	return &RateLimiter{interval: interval, tolerance: interval * int64(burst-1)}
+}
+
+// Allow reports whether trader may send another command at time now (unix nanos), and if so spends
+// a token. A false result means the command should be dropped and the client told it was throttled
+func (l *RateLimiter) Allow(trader TraderID, now int64) bool {
+	bucket := &l.tat[trader]
+	for {
+		tat := bucket.Load()
+		next := max(tat, now)
+		if next-now > l.tolerance {
+			return false
+		}
+		if bucket.CompareAndSwap(tat, next+l.interval) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_BurstThenRefill(t *testing.T) {
+	l := NewRateLimiter(10, 5) // One token every 100ms
+	now := time.Now().UnixNano()
+
+	for i := 0; i < 5; i++ {
+		if !l.Allow(1, now) {
+			t.Fatalf("expected command %d of the burst to be allowed", i)
+		}
+	}
+	if l.Allow(1, now) {
+		t.Fatalf("expected the command past the burst to be throttled")
+	}
+	if !l.Allow(2, now) {
+		t.Fatalf("expected another trader to have its own bucket")
+	}
+
+	// One interval later exactly one more token is available
+	now += int64(100 * time.Millisecond)
+	if !l.Allow(1, now) || l.Allow(1, now) {
+		t.Fatalf("expected exactly one token to refill after one interval")
+	}
+
+	// Idle time refills the bucket only up to the burst
+	now += int64(time.Hour)
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if l.Allow(1, now) {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Fatalf("expected a full bucket of 5 after idling, got %d", allowed)
+	}
+}
+
+func TestRateLimiter_RateAboveTheClockResolutionStillThrottles(t *testing.T) {
+	l := NewRateLimiter(2e9, 3) // Under a nanosecond per token, held to one per nanosecond
+	now := time.Now().UnixNano()
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow(1, now) {
+			t.Fatalf("expected command %d of the burst to be allowed", i)
+		}
+	}
+	if l.Allow(1, now) {
+		t.Fatalf("expected the command past the burst to be throttled")
+	}
+	if !l.Allow(1, now+1) || l.Allow(1, now+1) {
+		t.Fatalf("expected exactly one token to refill after a nanosecond")
+	}
+}
+
+func TestRateLimiter_ConcurrentBurst(t *testing.T) {
+	l := NewRateLimiter(1, 100)
+	now := time.Now().UnixNano()
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if l.Allow(7, now) {
+					allowed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed.Load() != 100 {
+		t.Fatalf("expected exactly the burst of 100 across goroutines, got %d", allowed.Load())
+	}
+}
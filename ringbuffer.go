@@ -1,18 +1,25 @@
 package main
 
-import "sync/atomic"
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
 
 // Constants defining the ring buffer properties
 const (
-	RING_SIZE       = 1 << 16       // 65,536 elements - must be a power of 2 for efficient masking
-	RING_MASK       = RING_SIZE - 1 // Mask for fast modulo operation using bitwise AND
-	CACHE_LINE_SIZE = 64            // Typical CPU cache line size to avoid false sharing
+	RING_SIZE       = 1 << 16 // 65,536 elements - default engine ring size
+	CACHE_LINE_SIZE = 64      // Typical CPU cache line size to avoid false sharing
+	CTX_CHECK_SPINS = 1 << 10 // Empty polls between context or deadline checks in ReadContext and ReadTimeout
 )
 
 // Lock-free ring buffer supporting a single producer and a single consumer (SPSC)
 // Generic type T allows storing any type of element.
 type RingBuffer[T any] struct {
-	buffer []T // Fixed-size circular buffer to hold elements
+	buffer []T    // Fixed-size circular buffer to hold elements
+	mask   uint64 // len(buffer) - 1, for fast modulo operation using bitwise AND
+	closed uint32 // Set once by Close (read atomically)
 
 	// Padding arrays to ensure writePos and readPos are on separate cache lines.
 	// This prevents "false sharing," where different cores repeatedly write to
@@ -24,64 +31,196 @@ type RingBuffer[T any] struct {
 	_pad3    [CACHE_LINE_SIZE - 8]byte // padding after readPos
 }
 
-// NewRingBuffer allocates and returns a pointer to a new ring buffer instance.
-// Initialises the internal buffer with a fixed size (RING_SIZE elements).
-func NewRingBuffer[T any]() *RingBuffer[T] {
+// NewRingBuffer allocates and returns a pointer to a new ring buffer instance holding size elements.
+// Panics unless size is a power of 2, which the index masking relies on.
+func NewRingBuffer[T any](size int) *RingBuffer[T] {
+	checkRingSize(size)
 	return &RingBuffer[T]{
-		buffer: make([]T, RING_SIZE), // preallocate memory for ring buffer
+		buffer: make([]T, size), // preallocate memory for ring buffer
+		mask:   uint64(size - 1),
+	}
+}
+
+// Panic unless size is a positive power of 2
+func checkRingSize(size int) {
+	if size <= 0 || size&(size-1) != 0 {
+		panic(fmt.Sprintf("ring buffer size %d is not a power of 2", size))
 	}
 }
 
+// Close marks the ring as shut down: Read drains what is left and then returns 0 rather than
+// spinning, and Push drops its element rather than waiting for space that will never come
+func (r *RingBuffer[T]) Close() {
+	atomic.StoreUint32(&r.closed, 1)
+}
+
+func (r *RingBuffer[T]) isClosed() bool {
+	return atomic.LoadUint32(&r.closed) != 0
+}
+
 // Push adds a single element to the ring buffer.
-// This is a busy-waiting (spin) implementation if the buffer is full.
+// If the buffer is full it waits for space, spinning and then backing off (see backoff).
+// Returns false, without adding v, once the ring is closed.
 // Only safe for a single producer; concurrent Push calls would be unsafe.
-func (r *RingBuffer[T]) Push(v T) {
+func (r *RingBuffer[T]) Push(v T) bool {
+	var b backoff
 	for {
-		// Atomically load the current write and read positions
+		if r.TryPush(v) {
+			return true
+		}
+		if r.isClosed() {
+			return false
+		}
+		// If buffer is full, wait until space becomes available
+		b.wait()
+	}
+}
+
+// TryPush adds a single element if there is space, returning false immediately (without adding v)
+// if the buffer is full or the ring is closed.
+// Only safe for a single producer, like Push.
+func (r *RingBuffer[T]) TryPush(v T) bool {
+	if r.isClosed() {
+		return false
+	}
+
+	// Atomically load the current write and read positions
+	write := atomic.LoadUint64(&r.writePos)
+	read := atomic.LoadUint64(&r.readPos)
+
+	// Calculate available space by checking difference between write and read indices
+	if write-read > r.mask {
+		return false // Buffer is full
+	}
+
+	// Compute actual index using bitwise AND with mask (fast modulo)
+	r.buffer[write&r.mask] = v
+	// Publish the new write position atomically
+	atomic.StoreUint64(&r.writePos, write+1)
+	return true
+}
+
+// PushBatch adds a run of elements to the ring buffer, publishing writePos once per run rather than
+// once per element. It spins until the whole run fits; batches longer than the buffer are pushed in
+// buffer-sized runs. Returns false if the ring is closed before every run is pushed.
+// Only safe for a single producer, like Push.
+func (r *RingBuffer[T]) PushBatch(vs []T) bool {
+	for len(vs) > 0 {
+		if r.isClosed() {
+			return false
+		}
+		size := r.mask + 1
+		n := min(uint64(len(vs)), size)
+
+		// Wait until the whole run fits (spinning, then backing off, while the consumer catches up)
 		write := atomic.LoadUint64(&r.writePos)
-		read := atomic.LoadUint64(&r.readPos)
-
-		// Calculate available space by checking difference between write and read indices
-		if write-read < RING_SIZE { // There is space in the buffer
-			// Compute actual index using bitwise AND with mask (fast modulo)
-			r.buffer[write&RING_MASK] = v
-			// Publish the new write position atomically
-			atomic.StoreUint64(&r.writePos, write+1)
-			return
+		var b backoff
+		for write-atomic.LoadUint64(&r.readPos) > size-n {
+			// Buffer too full for the run, wait until the consumer frees enough space
+			if r.isClosed() {
+				return false
+			}
+			b.wait()
 		}
 
-		// If buffer is full, loop (busy-wait) until space becomes available
+		// Copy in at most two pieces, splitting where the run wraps past the end of the buffer
+		start := write & r.mask
+		first := min(n, size-start)
+		copy(r.buffer[start:start+first], vs[:first])
+		copy(r.buffer[:n-first], vs[first:n])
+
+		// Publish the whole run at once
+		atomic.StoreUint64(&r.writePos, write+n)
+		vs = vs[n:]
 	}
+	return true
 }
 
 // Read extracts up to len(out) elements from the buffer.
-// Returns the number of elements actually read (always ≥ 1).
-// This is a busy-waiting (spin) implementation if the buffer is empty.
+// Returns the number of elements actually read (always ≥ 1, until the ring is closed and drained, then 0).
+// If the buffer is empty it waits, spinning and then backing off (see backoff).
 // Only safe for a single consumer; concurrent Read calls would be unsafe.
 func (r *RingBuffer[T]) Read(out []T) uint32 {
+	var b backoff
 	for {
-		// Atomically load the current write and read positions
-		write := atomic.LoadUint64(&r.writePos)
-		read := atomic.LoadUint64(&r.readPos)
+		if n, done := r.tryRead(out); n > 0 || done {
+			return n
+		}
+		// If buffer is empty, wait until elements are written
+		b.wait()
+	}
+}
+
+// TryRead extracts up to len(out) elements without waiting. Returns 0 and false if none are available.
+// Only safe for a single consumer, like Read.
+func (r *RingBuffer[T]) TryRead(out []T) (uint32, bool) {
+	n, _ := r.tryRead(out)
+	return n, n > 0
+}
 
-		// Calculate how many elements are available to read
-		available := write - read
-		if available == 0 {
-			// If buffer is empty, loop (busy-wait) until elements are written
-			continue
+// ReadContext is Read, but also gives up when ctx is cancelled, returning ctx.Err(). The spin stays
+// tight, checking ctx only every CTX_CHECK_SPINS empty polls (or every poll once backed off to
+// sleeping), so a busy ring reads as fast as Read. Data already available is returned even if ctx
+// is cancelled; a closed, drained ring returns (0, nil)
+func (r *RingBuffer[T]) ReadContext(ctx context.Context, out []T) (uint32, error) {
+	var b backoff
+	for spins := 1; ; spins++ {
+		if n, done := r.tryRead(out); n > 0 || done {
+			return n, nil
 		}
+		if spins%CTX_CHECK_SPINS == 0 || b.sleeping() {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+		b.wait()
+	}
+}
 
-		// Determine how many elements we can actually read
-		count := min(available, uint64(len(out)))
+// ReadTimeout is Read, but gives up and returns 0 once d has passed with nothing to read (as it also
+// does for a closed, drained ring). The clock is only read after a first empty poll, and then every
+// CTX_CHECK_SPINS polls (or every poll once backed off to sleeping), so reading from a busy ring
+// costs the same as Read
+func (r *RingBuffer[T]) ReadTimeout(out []T, d time.Duration) uint32 {
+	if n, done := r.tryRead(out); n > 0 || done {
+		return n
+	}
 
-		// Copy elements from buffer into output slice
-		for i := uint64(0); i < count; i++ {
-			// Use bitwise AND with mask to wrap around the circular buffer
-			out[i] = r.buffer[(read+i)&RING_MASK]
+	deadline := time.Now().Add(d)
+	var b backoff
+	for spins := 1; ; spins++ {
+		if n, done := r.tryRead(out); n > 0 || done {
+			return n
+		}
+		if (spins%CTX_CHECK_SPINS == 0 || b.sleeping()) && !time.Now().Before(deadline) {
+			return 0
 		}
+		b.wait()
+	}
+}
 
-		// Update read position to mark elements as consumed
-		atomic.StoreUint64(&r.readPos, read+count)
-		return uint32(count) // Return the number of elements read
+// Read whatever is available without waiting, also reporting whether the ring is closed and drained
+func (r *RingBuffer[T]) tryRead(out []T) (uint32, bool) {
+	// Atomically load the current write and read positions
+	write := atomic.LoadUint64(&r.writePos)
+	read := atomic.LoadUint64(&r.readPos)
+
+	// Calculate how many elements are available to read
+	available := write - read
+	if available == 0 {
+		return 0, r.isClosed() && atomic.LoadUint64(&r.writePos) == read
 	}
+
+	// Determine how many elements we can actually read
+	count := min(available, uint64(len(out)))
+
+	// Copy elements from buffer into output slice
+	for i := uint64(0); i < count; i++ {
+		// Use bitwise AND with mask to wrap around the circular buffer
+		out[i] = r.buffer[(read+i)&r.mask]
+	}
+
+	// Update read position to mark elements as consumed
+	atomic.StoreUint64(&r.readPos, read+count)
+	return uint32(count), false // Return the number of elements read
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -10,7 +12,7 @@ import (
 // TestNewRingBufferInitialization ensures that a new ring buffer is
 // properly initialised with the correct size and initial positions.
 func TestNewRingBufferInitialization(t *testing.T) {
-	rb := NewRingBuffer[int]()
+	rb := NewRingBuffer[int](RING_SIZE)
 
 	if rb == nil {
 		t.Fatal("RingBuffer should not be nil after initialization")
@@ -26,7 +28,7 @@ func TestNewRingBufferInitialization(t *testing.T) {
 // TestPushAndReadSingleElement checks that a single value can be pushed
 // and read correctly from the buffer.
 func TestPushAndReadSingleElement(t *testing.T) {
-	rb := NewRingBuffer[int]()
+	rb := NewRingBuffer[int](RING_SIZE)
 
 	rb.Push(42)           // Push a single element
 	out := make([]int, 1) // Allocate slice to read into
@@ -43,7 +45,7 @@ func TestPushAndReadSingleElement(t *testing.T) {
 // TestPushAndReadMultipleElements ensures multiple sequential pushes
 // and reads preserve order and correctness.
 func TestPushAndReadMultipleElements(t *testing.T) {
-	rb := NewRingBuffer[int]()
+	rb := NewRingBuffer[int](RING_SIZE)
 	values := []int{1, 2, 3, 4, 5}
 
 	// Push multiple elements
@@ -69,7 +71,7 @@ func TestPushAndReadMultipleElements(t *testing.T) {
 // TestRingBufferWrapAround tests proper handling of the circular buffer
 // when indices wrap past the end of the internal array.
 func TestRingBufferWrapAround(t *testing.T) {
-	rb := NewRingBuffer[int]() // Fixed-size buffer
+	rb := NewRingBuffer[int](RING_SIZE) // Fixed-size buffer
 
 	// Step 1: Fill the buffer completely
 	for i := 0; i < RING_SIZE; i++ {
@@ -118,7 +120,7 @@ func TestRingBufferWrapAround(t *testing.T) {
 // TestConcurrentProducerConsumer tests the ring buffer under concurrent
 // producer and consumer operations.
 func TestConcurrentProducerConsumer(t *testing.T) {
-	rb := NewRingBuffer[int]()
+	rb := NewRingBuffer[int](RING_SIZE)
 	const total = 100000
 	var wg sync.WaitGroup
 
@@ -152,7 +154,7 @@ func TestConcurrentProducerConsumer(t *testing.T) {
 // TestEmptyBufferReadBlocksUntilPush ensures that a Read blocks if the buffer
 // is empty until a Push occurs.
 func TestEmptyBufferReadBlocksUntilPush(t *testing.T) {
-	rb := NewRingBuffer[int]()
+	rb := NewRingBuffer[int](RING_SIZE)
 	out := make([]int, 1)
 	done := make(chan struct{})
 
@@ -182,7 +184,7 @@ func TestEmptyBufferReadBlocksUntilPush(t *testing.T) {
 // TestFullBufferPushBlocksUntilRead ensures that a Push blocks if the buffer
 // is full until a Read frees space.
 func TestFullBufferPushBlocksUntilRead(t *testing.T) {
-	rb := NewRingBuffer[int]()
+	rb := NewRingBuffer[int](RING_SIZE)
 
 	// Fill the buffer completely
 	for i := 0; i < RING_SIZE; i++ {
@@ -227,7 +229,7 @@ func TestGenericSupport(t *testing.T) {
 		ID   int
 		Name string
 	}
-	rb := NewRingBuffer[custom]()
+	rb := NewRingBuffer[custom](RING_SIZE)
 
 	val := custom{ID: 1, Name: "test"}
 	rb.Push(val)
@@ -242,3 +244,192 @@ func TestGenericSupport(t *testing.T) {
 		t.Fatalf("Expected %+v, got %+v", val, out[0])
 	}
 }
+
+// TestPushBatchAcrossWrapBoundary pushes a batch that starts near the end of the buffer and wraps
+// to the start, while a concurrent consumer reads everything back in order.
+func TestPushBatchAcrossWrapBoundary(t *testing.T) {
+	rb := NewRingBuffer[int](RING_SIZE)
+
+	// Move the write position to just before the end of the buffer
+	for i := 0; i < RING_SIZE-3; i++ {
+		rb.Push(i)
+	}
+	drain := make([]int, RING_SIZE)
+	for read := 0; read < RING_SIZE-3; {
+		read += int(rb.Read(drain))
+	}
+
+	batch := make([]int, 10)
+	for i := range batch {
+		batch[i] = 1000 + i
+	}
+
+	done := make(chan []int)
+	go func() {
+		var got []int
+		out := make([]int, 4)
+		for len(got) < len(batch) {
+			n := rb.Read(out)
+			got = append(got, out[:n]...)
+		}
+		done <- got
+	}()
+
+	rb.PushBatch(batch)
+
+	got := <-done
+	for i, v := range got {
+		if v != batch[i] {
+			t.Fatalf("Batch mismatch at index %d: expected %d, got %d", i, batch[i], v)
+		}
+	}
+	if rb.writePos != RING_SIZE-3+10 {
+		t.Fatalf("Expected writePos %d, got %d", RING_SIZE-3+10, rb.writePos)
+	}
+}
+
+// TestPushBatchLargerThanBuffer pushes a batch several times the buffer size against a concurrent
+// consumer, which must see every element exactly once and in order.
+func TestPushBatchLargerThanBuffer(t *testing.T) {
+	rb := NewRingBuffer[int](RING_SIZE)
+	batch := make([]int, RING_SIZE*3+7)
+	for i := range batch {
+		batch[i] = i
+	}
+
+	done := make(chan error)
+	go func() {
+		out := make([]int, 256)
+		for read := 0; read < len(batch); {
+			n := rb.Read(out)
+			for _, v := range out[:n] {
+				if v != read {
+					done <- fmt.Errorf("expected %d, got %d", read, v)
+					return
+				}
+				read++
+			}
+		}
+		done <- nil
+	}()
+
+	rb.PushBatch(batch)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestNewRingBufferRejectsNonPowerOfTwo ensures the constructor refuses sizes the index mask cannot handle.
+func TestNewRingBufferRejectsNonPowerOfTwo(t *testing.T) {
+	for _, size := range []int{0, -4, 3, 1000} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("Expected a panic for size %d", size)
+				}
+			}()
+			NewRingBuffer[int](size)
+		}()
+	}
+
+	rb := NewRingBuffer[int](4)
+	for i := 0; i < 10; i++ {
+		rb.Push(i)
+		out := make([]int, 1)
+		if rb.Read(out); out[0] != i {
+			t.Fatalf("Expected %d from a small buffer, got %d", i, out[0])
+		}
+	}
+}
+
+func TestClosedRingDrainsThenReturnsZero(t *testing.T) {
+	rb := NewRingBuffer[int](4)
+	rb.Push(1)
+	rb.Push(2)
+	rb.Close()
+
+	out := make([]int, 4)
+	if n := rb.Read(out); n != 2 || out[0] != 1 || out[1] != 2 {
+		t.Fatalf("expected the 2 queued elements before shutdown, got %v", out[:n])
+	}
+	if n := rb.Read(out); n != 0 {
+		t.Fatalf("expected 0 from a closed, drained ring, got %d", n)
+	}
+	if rb.Push(3) || rb.PushBatch([]int{4, 5}) {
+		t.Fatal("expected pushes to a closed ring to be dropped")
+	}
+}
+
+// TestReadContextReturnsOnCancel ensures ReadContext stops spinning on an
+// empty buffer once its context is done.
+func TestReadContextReturnsOnCancel(t *testing.T) {
+	rb := NewRingBuffer[int](4)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	out := make([]int, 4)
+	if n, err := rb.ReadContext(ctx, out); n != 0 || err != context.DeadlineExceeded {
+		t.Fatalf("expected (0, DeadlineExceeded) from an empty ring, got (%d, %v)", n, err)
+	}
+
+	// Data already queued is still returned after cancellation
+	rb.Push(7)
+	if n, err := rb.ReadContext(ctx, out); n != 1 || err != nil || out[0] != 7 {
+		t.Fatalf("expected the queued element, got (%d, %v)", n, err)
+	}
+}
+
+// TestTryPushAndTryReadFailFast ensures the non-blocking variants return
+// immediately on a full or empty buffer instead of spinning.
+func TestTryPushAndTryReadFailFast(t *testing.T) {
+	rb := NewRingBuffer[int](2)
+	out := make([]int, 2)
+
+	if n, ok := rb.TryRead(out); n != 0 || ok {
+		t.Fatalf("expected (0, false) from an empty ring, got (%d, %v)", n, ok)
+	}
+	if !rb.TryPush(1) || !rb.TryPush(2) {
+		t.Fatal("expected pushes into free space to succeed")
+	}
+	if rb.TryPush(3) {
+		t.Fatal("expected TryPush to fail on a full ring")
+	}
+	if n, ok := rb.TryRead(out); n != 2 || !ok || out[0] != 1 || out[1] != 2 {
+		t.Fatalf("expected (2, true) with [1 2], got (%d, %v) with %v", n, ok, out[:n])
+	}
+	if !rb.TryPush(3) {
+		t.Fatal("expected TryPush to succeed once space is freed")
+	}
+	rb.Close()
+	if rb.TryPush(4) {
+		t.Fatal("expected TryPush to a closed ring to fail")
+	}
+}
+
+// TestReadTimeoutGivesUpOnEmpty ensures ReadTimeout returns 0 after its
+// deadline on an empty buffer, and returns queued data straight away.
+func TestReadTimeoutGivesUpOnEmpty(t *testing.T) {
+	rb := NewRingBuffer[int](4)
+	out := make([]int, 4)
+
+	start := time.Now()
+	if n := rb.ReadTimeout(out, 10*time.Millisecond); n != 0 {
+		t.Fatalf("expected 0 from an empty ring, got %d", n)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Fatalf("expected ReadTimeout to wait out its deadline, returned after %v", elapsed)
+	}
+
+	rb.Push(7)
+	if n := rb.ReadTimeout(out, time.Hour); n != 1 || out[0] != 7 {
+		t.Fatalf("expected the queued element, got %v", out[:n])
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		rb.Push(8)
+	}()
+	if n := rb.ReadTimeout(out, time.Second); n != 1 || out[0] != 8 {
+		t.Fatalf("expected an element pushed while waiting, got %v", out[:n])
+	}
+}
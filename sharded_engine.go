@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ShardedEngine spreads symbols across independent matching engines, each with its own rings and
+// matching goroutine. Orders never cross symbols, so the shards never need to coordinate. Every
+// shard stamps its number into the top bits of the OrderIDs it issues (see SHARD_SHIFT), which keeps
+// IDs unique across shards and lets cancels and amends be routed by OrderID alone
+type ShardedEngine struct {
+	shards     []*MatchingEngine
+	outputRing *MPSCRingBuffer[OutputEvent] // Every shard's output events, merged
+	running    sync.WaitGroup               // Shard output forwarders still running
+	onTrade    func(Trade)                  // Trade tape subscriber (see OnTrade)
+}
+
+// NewShardedEngine creates n shards, symbol s being matched by shard s % n.
+// Panics unless 1 <= n <= MAX_SHARDS
+func NewShardedEngine(n int) *ShardedEngine {
+	return NewShardedEngineWithConfig(n, EngineConfig{})
+}
+
+// NewShardedEngineWithConfig creates n shards as NewShardedEngine does, each built with config (see
+// NewMatchingEngineWithConfig), so every shard gets its own pool of config.maxOrders slots
+func NewShardedEngineWithConfig(n int, config EngineConfig) *ShardedEngine {
+	if n < 1 || n > MAX_SHARDS {
+		panic(fmt.Sprintf("shard count %d is outside 1-%d", n, MAX_SHARDS))
+	}
+
+	s := &ShardedEngine{
+		shards:     make([]*MatchingEngine, n),
+		outputRing: NewMPSCRingBuffer[OutputEvent](RING_SIZE),
+	}
+	for i := range s.shards {
+		s.shards[i] = NewMatchingEngineWithConfig(config)
+		s.shards[i].shardID = OrderID(i) << SHARD_SHIFT
+	}
+	return s
+}
+
+// ShardFor returns the engine that matches a symbol, for per-symbol configuration (before Start)
+// and queries (on its matching goroutine, as for a single engine)
+func (s *ShardedEngine) ShardFor(symbol Symbol) *MatchingEngine {
+	return s.shards[int(symbol)%len(s.shards)]
+}
+
+// Push routes a command to its shard's input ring: new orders by symbol, cancels and amends by the
+// shard encoded in the OrderID (a cancel by client order ID, with no OrderID, by its symbol), and
+// expiry sweeps and per-trader commands (mass cancel, disable, enable) to every shard, each of which
+// emits its own summary or transition event. A replace whose new symbol belongs to a different shard
+// than the order it replaces cannot be applied atomically, so it is rejected here (the reject may
+// overtake events of commands pushed earlier).
+// Returns false if the command was dropped because the engine is stopped. Safe for concurrent producers
+func (s *ShardedEngine) Push(cmd InputCommand) bool {
+	switch cmd.eventType {
+	case CANCEL_EVENT, AMEND_EVENT:
+		if cmd.eventType == CANCEL_EVENT && cmd.orderID == 0 {
+			return s.ShardFor(cmd.symbol).inputRing.Push(cmd)
+		}
+		return s.byOrderID(cmd.orderID).inputRing.Push(cmd)
+	case REPLACE_EVENT:
+		if shard := s.byOrderID(cmd.orderID); shard != s.ShardFor(cmd.symbol) {
+			return s.outputRing.Push(OutputEvent{eventType: REJECT_EVENT, orderID: cmd.orderID, trader: cmd.trader, reason: REJECT_CROSS_SHARD})
+		}
+		return s.ShardFor(cmd.symbol).inputRing.Push(cmd)
+	case EXPIRE_EVENT, MASS_CANCEL_EVENT, DISABLE_EVENT, ENABLE_EVENT:
+		pushed := true
+		for _, shard := range s.shards {
+			pushed = shard.inputRing.Push(cmd) && pushed
+		}
+		return pushed
+	default:
+		return s.ShardFor(cmd.symbol).inputRing.Push(cmd)
+	}
+}
+
+// The shard that issued an OrderID (shard 0 for IDs naming no valid shard, whose lookup then fails)
+func (s *ShardedEngine) byOrderID(id OrderID) *MatchingEngine {
+	shard := int(id >> SHARD_SHIFT)
+	if shard >= len(s.shards) {
+		shard = 0
+	}
+	return s.shards[shard]
+}
+
+// Start runs every shard's input distributor, plus a forwarder per shard feeding its output events
+// into the merged stream read by StartOutputDistributor
+func (s *ShardedEngine) Start() {
+	s.running.Add(len(s.shards))
+	for _, shard := range s.shards {
+		go shard.StartInputDistributor()
+		go func() {
+			defer s.running.Done()
+			shard.StartOutputDistributor(func(ev OutputEvent) { s.outputRing.Push(ev) })
+		}()
+	}
+
+	go func() {
+		s.running.Wait()
+		s.outputRing.Close()
+	}()
+}
+
+// StartOutputDistributor delivers the merged output events of every shard to callbackFunc from a
+// single goroutine. Each shard's events arrive in order; events of different shards interleave.
+// Returns after Stop once every shard's events have been delivered
+func (s *ShardedEngine) StartOutputDistributor(callbackFunc func(OutputEvent)) {
+	buf := make([]OutputEvent, DISTRIBUTOR_BUFFER)
+	for {
+		n := s.outputRing.Read(buf)
+		if n == 0 {
+			return
+		}
+		for i := 0; uint32(i) < n; i++ {
+			callbackFunc(buf[i])
+			if s.onTrade != nil && buf[i].eventType == EXECUTION_EVENT && !buf[i].maker {
+				s.onTrade(tradeOf(&buf[i]))
+			}
+		}
+	}
+}
+
+// OnTrade subscribes fn to every shard's trade tape, as Engine.OnTrade. Trade ids carry the shard
+// number like OrderIDs, so they are unique across shards
+func (s *ShardedEngine) OnTrade(fn func(Trade)) {
+	s.onTrade = fn
+}
+
+// Stop shuts every shard down as Engine.Stop does
+func (s *ShardedEngine) Stop() {
+	for _, shard := range s.shards {
+		shard.Stop()
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Helper to create a ShardedEngine with TEST_MAX_ORDERS pools for a test
+func newTestShardedEngine(n int) *ShardedEngine {
+	return NewShardedEngineWithConfig(n, EngineConfig{maxOrders: TEST_MAX_ORDERS})
+}
+
+// Helper to stop a started ShardedEngine and collect every output event it produced
+func stopAndCollect(t *testing.T, s *ShardedEngine, events chan []OutputEvent) []OutputEvent {
+	s.Stop()
+	select {
+	case evs := <-events:
+		return evs
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the sharded engine to stop")
+		return nil
+	}
+}
+
+func TestShardedEngine_RoutesAndKeepsOrderIDsUnique(t *testing.T) {
+	s := newTestShardedEngine(4)
+	events := make(chan []OutputEvent, 1)
+	s.Start()
+	go func() {
+		var evs []OutputEvent
+		s.StartOutputDistributor(func(ev OutputEvent) { evs = append(evs, ev) })
+		events <- evs
+	}()
+
+	// The first order on each shard lands in slot 1, generation 0: only the shard bits differ
+	s.Push(InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: 100, size: 5, trader: 1})
+	s.Push(InputCommand{eventType: ORDER_EVENT, symbol: 2, side: Bid, price: 100, size: 5, trader: 1})
+	s.Push(InputCommand{eventType: ORDER_EVENT, symbol: 5, side: Ask, price: 100, size: 2, trader: 2}) // Shares shard 1 with symbol 1, but not its book
+	s.Push(InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Ask, price: 100, size: 3, trader: 2})
+	s.Push(InputCommand{eventType: CANCEL_EVENT, orderID: OrderID(2)<<SHARD_SHIFT | 1, trader: 1})
+
+	var ids = map[OrderID]Symbol{}
+	var executed Size
+	var cancelled []OrderID
+	for _, ev := range stopAndCollect(t, s, events) {
+		switch ev.eventType {
+		case ORDER_EVENT:
+			if _, dup := ids[ev.orderID]; dup {
+				t.Fatalf("order id %d issued twice", ev.orderID)
+			}
+			ids[ev.orderID] = ev.symbol
+			if shard := int(ev.orderID >> SHARD_SHIFT); shard != int(ev.symbol)%4 {
+				t.Fatalf("symbol %d order id %d carries shard %d", ev.symbol, ev.orderID, shard)
+			}
+		case EXECUTION_EVENT:
+			if !ev.maker {
+				executed += ev.size
+			}
+		case CANCEL_EVENT:
+			cancelled = append(cancelled, ev.orderID)
+		}
+	}
+
+	if len(ids) != 4 {
+		t.Fatalf("expected 4 orders, got %d", len(ids))
+	}
+	if executed != 3 {
+		t.Fatalf("expected only the symbol 1 orders to trade (3 lots), got %d", executed)
+	}
+	if len(cancelled) != 1 || ids[cancelled[0]] != 2 {
+		t.Fatalf("expected the cancel to reach the symbol 2 order on shard 2, got %v", cancelled)
+	}
+}
+
+func TestShardedEngine_CrossShardReplaceRejected(t *testing.T) {
+	s := newTestShardedEngine(2)
+	events := make(chan []OutputEvent, 1)
+	s.Start()
+	go func() {
+		var evs []OutputEvent
+		s.StartOutputDistributor(func(ev OutputEvent) { evs = append(evs, ev) })
+		events <- evs
+	}()
+
+	s.Push(InputCommand{eventType: ORDER_EVENT, symbol: 0, side: Bid, price: 100, size: 5, trader: 1})
+	s.Push(InputCommand{eventType: REPLACE_EVENT, orderID: 1, symbol: 1, side: Bid, price: 101, size: 5, trader: 1})
+
+	// The router rejects the replace itself, so the reject can overtake the shard's order event
+	var orders, rejects int
+	for _, ev := range stopAndCollect(t, s, events) {
+		switch ev.eventType {
+		case ORDER_EVENT:
+			orders++
+		case RESTED_EVENT:
+		case REJECT_EVENT:
+			if ev.reason != REJECT_CROSS_SHARD {
+				t.Fatalf("expected REJECT_CROSS_SHARD, got %v", ev.reason)
+			}
+			rejects++
+		default:
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	}
+	if orders != 1 || rejects != 1 {
+		t.Fatalf("expected the order and a reject of the cross-shard replace, got %d orders and %d rejects", orders, rejects)
+	}
+}
+
+func TestNewShardedEngine_RejectsBadShardCount(t *testing.T) {
+	for _, n := range []int{0, MAX_SHARDS + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected NewShardedEngine(%d) to panic", n)
+				}
+			}()
+			NewShardedEngine(n)
+		}()
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"maps"
+	"runtime"
+)
+
+// Simulate reports the events cmd (an ORDER_EVENT or MARKET_EVENT) would produce if it were processed
+// now: its acceptance under the OrderID it would be given, fills, any resting or cancelled
+// remainder, stops it would trigger, or its reject. Anything else is answered with a single
+// REJECT_UNKNOWN_COMMAND. Nothing of the engine changes: the command runs on a private scratch
+// engine holding a copy of the symbol's book, its resting and pending orders, the pool's next free
+// slot and the configuration that decides the outcome, so no OrderID, slot, book, position, trade
+// id or statistic is consumed. The copy covers one symbol only, so cancellations of OCO siblings it
+// would set off are not shown (orders are simulated as if ungrouped). The scratch engine is built on
+// first use and reserves a second order pool's worth of address space. Like Depth, must run on the
+// matching goroutine (or while it is idle); not safe for concurrent callers
+func (e *MatchingEngine) Simulate(cmd InputCommand) []OutputEvent {
+	if cmd.eventType != ORDER_EVENT && cmd.eventType != MARKET_EVENT {
+		return []OutputEvent{{eventType: REJECT_EVENT, orderID: cmd.orderID, clOrdID: cmd.clOrdID, trader: cmd.trader, symbol: cmd.symbol, reason: REJECT_UNKNOWN_COMMAND}}
+	}
+	if e.sim == nil {
+		e.sim = NewMatchingEngineWithConfig(EngineConfig{priceLevels: e.priceLevels, maxOrders: Slot(len(e.pool.orders)), sparseBooks: true})
+	}
+	sim := e.sim
+	cmd.token = 0 // Nobody waits on a simulation's result
+	if cmd.symbol < MAX_SYMBOLS {
+		sim.mirror(e, cmd.symbol)
+	}
+
+	// The command runs on its own goroutine, so a sweep with more events than the ring holds never blocks
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sim.dispatch(&cmd)
+	}()
+
+	var events []OutputEvent
+	buf := make([]OutputEvent, DISTRIBUTOR_BUFFER)
+	for finished := false; ; {
+		n, _ := sim.outputRing.TryRead(buf)
+		events = append(events, buf[:n]...)
+		if n > 0 {
+			continue
+		}
+		if finished {
+			return events
+		}
+		select {
+		case <-done:
+			finished = true // Read once more: the last events may have landed after the empty read
+		default:
+			runtime.Gosched()
+		}
+	}
+}
+
+// Make the scratch engine match e for one symbol: the book and every order in it, the pool's next
+// allocation, and the configuration and state that submit and matching read
+func (sim *MatchingEngine) mirror(e *MatchingEngine, symbol Symbol) {
+	src, dst := &e.books[symbol], &sim.books[symbol]
+	dst.allocate()
+	clear(sim.pool.traderHeads[:]) // Rebuilt over the mirrored orders alone (see mirrorOrder)
+	for _, side := range []Side{Bid, Ask} {
+		// Clear what the last simulation left, then copy the source's non-empty levels and their orders
+		bits := dst.bits(side)
+		for price := bits.next(0); price < dst.priceLevels(); price = bits.next(price + 1) {
+			*dst.level(side, price) = PriceLevel{}
+			bits.clear(price)
+		}
+		for price := src.bits(side).next(0); price < src.priceLevels(); price = src.bits(side).next(price + 1) {
+			level := src.level(side, price)
+			*dst.level(side, price) = *level
+			bits.set(price)
+			for slot := level.headSlot; slot != 0; slot = e.pool.get(slot).nextSlot {
+				sim.mirrorOrder(e, slot)
+			}
+		}
+	}
+	dst.bidMax, dst.askMin, dst.lastPrice, dst.lastSize = src.bidMax, src.askMin, src.lastPrice, src.lastSize
+	dst.buyStops = append(dst.buyStops[:0], src.buyStops...)
+	dst.sellStops = append(dst.sellStops[:0], src.sellStops...)
+	dst.trailing = src.trailing
+	for _, stops := range [][]pendingStop{src.buyStops, src.sellStops} {
+		for _, stop := range stops {
+			sim.mirrorOrder(e, stop.slot)
+		}
+	}
+
+	// The slot the next order is allocated from (its generation makes the OrderID), and the free list behind it
+	sim.pool.freeHead, sim.pool.nextFreeSlot = e.pool.freeHead, e.pool.nextFreeSlot
+	for _, slot := range []Slot{e.pool.freeHead, e.pool.nextFreeSlot + 1} {
+		if slot != 0 && slot < Slot(len(sim.pool.orders)) {
+			sim.pool.orders[slot] = e.pool.orders[slot]
+		}
+	}
+	clear(sim.pool.clOrdIDs)
+	clear(sim.pool.groups)
+	clear(sim.pool.groupHeads)
+
+	sim.stpMode, sim.matchMode = e.stpMode, e.matchMode
+	sim.tickSizes, sim.minSizes, sim.maxSizes = e.tickSizes, e.minSizes, e.maxSizes
+	sim.makerBps, sim.takerBps = e.makerBps, e.takerBps
+	sim.levelUpdates, sim.fillSummaries = e.levelUpdates, e.fillSummaries
+	sim.bandBps, sim.referencePrices = e.bandBps, e.referencePrices
+	sim.positions[symbol] = maps.Clone(e.positions[symbol])
+	sim.halted, sim.disabled, sim.auctions = e.halted, e.disabled, e.auctions
+	sim.shardID, sim.lastTradeID = e.shardID, e.lastTradeID
+	sim.expiries = sim.expiries[:0]
+}
+
+// Copy one working order into the same slot of the scratch pool, outside any OCO group. Its trader
+// links are the real pool's, naming slots that may not be mirrored, so it is tracked afresh
+func (sim *MatchingEngine) mirrorOrder(e *MatchingEngine, slot Slot) {
+	order := &sim.pool.orders[slot]
+	*order = e.pool.orders[slot]
+	order.flags &^= FLAG_OCO
+	sim.pool.track(slot, order.trader)
+}
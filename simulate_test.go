@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestSimulate_MatchesTheRealRunWithoutChangingTheEngine(t *testing.T) {
+	e := newTestEngine()
+	e.SetFees(-1, 3)
+	e.SetLevelUpdates(true)
+	limit(e, 1, Ask, 100, 3, 1, GTC)
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 101, size: 10, peakSize: 2, trader: 2})
+	limit(e, 1, Ask, 103, 5, 3, GTC)
+	e.Market(&InputCommand{symbol: 1, side: Bid, size: 4, stopPrice: 101, trader: 4}) // Triggered by the sweep
+	limit(e, 1, Bid, 90, 5, 5, GTC)
+	limit(e, 2, Bid, 90, 5, 5, GTC) // Another book, left out of the copy
+	e.Cancel(OrderID(1), 1)         // Leave a slot on the free list
+	drainOutputEvents(e)
+
+	for round, cmd := range []InputCommand{
+		{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: 101, size: 12, trader: 6, clOrdID: 9},
+		{eventType: MARKET_EVENT, symbol: 1, side: Ask, size: 3, trader: 6},
+		{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: 0, size: 1, trader: 6}, // Rejected
+	} {
+		before := engineState(t, e)
+		simulated := e.Simulate(cmd)
+		if !bytes.Equal(before, engineState(t, e)) {
+			t.Fatalf("round %d: simulating changed the engine", round)
+		}
+		if events := drainOutputEvents(e); len(events) != 0 {
+			t.Fatalf("round %d: simulating emitted %+v", round, events)
+		}
+
+		e.dispatch(&cmd)
+		if real := drainOutputEvents(e); !slices.Equal(simulated, real) {
+			t.Fatalf("round %d: simulated\n%+v\nbut the real run emitted\n%+v", round, simulated, real)
+		}
+	}
+}
+
+func TestSimulate_TracksOnlyTheMirroredOrdersByTrader(t *testing.T) {
+	e := newTestEngine()
+	limit(e, 2, Bid, 90, 5, 1, GTC) // Another book, so never mirrored
+	limit(e, 1, Ask, 100, 1, 1, GTC)
+	limit(e, 1, Ask, 101, 5, 1, GTC)
+	events := drainOutputEvents(e)
+	kept := events[len(events)-2].orderID
+
+	for round := 0; round < 2; round++ {
+		e.Simulate(InputCommand{eventType: MARKET_EVENT, symbol: 1, side: Bid, size: 1, trader: 2})
+
+		// The fill freed the ask at 100, leaving the one at 101 as trader 1's only order in the copy
+		pool := e.sim.pool
+		head := pool.traderHeads[1]
+		if head != Slot(kept&SLOT_MASK) || pool.get(head).traderPrev != 0 || pool.get(head).traderNext != 0 {
+			t.Fatalf("round %d: expected trader 1 to hold only slot %d, got head %d", round, kept&SLOT_MASK, head)
+		}
+		if pool.traderHeads[2] != 0 {
+			t.Fatalf("round %d: expected the market order untracked once done, got head %d", round, pool.traderHeads[2])
+		}
+	}
+}
+
+func TestSimulate_RejectsOtherCommands(t *testing.T) {
+	e := newTestEngine()
+	events := e.Simulate(InputCommand{eventType: CANCEL_EVENT, orderID: 5, trader: 1})
+	if len(events) != 1 || events[0].reason != REJECT_UNKNOWN_COMMAND || events[0].orderID != 5 {
+		t.Fatalf("expected REJECT_UNKNOWN_COMMAND, got %+v", events)
+	}
+}
+
+func TestSimulate_SweepLargerThanTheRing(t *testing.T) {
+	e := newTestEngine()
+	const orders = RING_SIZE / 2
+	for i := 0; i < orders; i++ {
+		limit(e, 1, Ask, Price(100+i%50), 1, 1, GTC)
+		if i%1024 == 0 {
+			drainOutputEvents(e)
+		}
+	}
+	drainOutputEvents(e)
+
+	events := e.Simulate(InputCommand{eventType: MARKET_EVENT, symbol: 1, side: Bid, size: orders, trader: 2})
+	if len(events) != 1+2*orders || events[len(events)-1].eventType != EXECUTION_EVENT {
+		t.Fatalf("expected an ORDER_EVENT and %d execution reports, got %d events", 2*orders, len(events))
+	}
+	if e.books[1].VolumeAt(Ask, 100) != orders/50+1 {
+		t.Fatalf("expected the book untouched, got %d at 100", e.books[1].VolumeAt(Ask, 100))
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+var (
+	ErrSnapshotCorrupt   = errors.New("snapshot: truncated or malformed data")
+	ErrSnapshotNotEmpty  = errors.New("snapshot: restore target book is not empty")
+	ErrSnapshotSlotInUse = errors.New("snapshot: restored order's slot is already in use")
+)
+
+// A resting order read back from a snapshot
+type snapshotOrder struct {
+	id                          OrderID
+	clOrdID                     uint64
+	price                       Price
+	size, filled, peak, reserve Size
+	expiresAt                   int64 // GTD expiry (0 for GTC)
+	trader                      TraderID
+	side                        Side
+	flags                       OrderFlags
+}
+
+// Snapshot serialises a symbol's book: the best-price sentinels, last trade and every
+// non-empty price level with its resting orders in FIFO order (bids then asks, each by ascending
+// price), so the output is deterministic. Orders live in the engine's shared pool and GTD expiries
+// in its expiry heap, so the snapshot is taken through the engine rather than the book alone.
+// Pending stops are not included.
+//
+// The book is read in place, so the snapshot tears if matching runs concurrently. It must be taken
+// on the matching goroutine (between commands) or while the input distributor is stopped
+func (e *MatchingEngine) Snapshot(symbol Symbol) []byte {
+	if symbol >= MAX_SYMBOLS {
+		return nil
+	}
+	book := &e.books[symbol]
+
+	expiries := make(map[OrderID]int64, len(e.expiries))
+	for _, exp := range e.expiries {
+		expiries[exp.id] = exp.expiresAt
+	}
+
+	buf := make([]byte, 0, 64)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(book.bidMax))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(book.askMin))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(book.lastPrice))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(book.lastSize))
+	buf = e.appendLevels(buf, book.bidLevels, expiries)
+	buf = e.appendLevels(buf, book.askLevels, expiries)
+	return buf
+}
+
+func (e *MatchingEngine) appendLevels(buf []byte, levels []PriceLevel, expiries map[OrderID]int64) []byte {
+	var count uint32
+	for price := range levels {
+		if levels[price].headSlot != 0 {
+			count++
+		}
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, count)
+
+	for price := range levels {
+		level := &levels[price]
+		if level.headSlot == 0 {
+			continue
+		}
+
+		var orders uint32
+		for slot := level.headSlot; slot != 0; slot = e.pool.get(slot).nextSlot {
+			orders++
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(price))
+		buf = binary.LittleEndian.AppendUint32(buf, orders)
+
+		for slot := level.headSlot; slot != 0; slot = e.pool.get(slot).nextSlot {
+			order := e.pool.get(slot)
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(order.id))
+			buf = binary.LittleEndian.AppendUint64(buf, order.clOrdID)
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(order.size))
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(order.filled))
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(order.peak))
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(order.reserve))
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(expiries[order.id]))
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(order.trader))
+			buf = append(buf, byte(order.flags))
+		}
+	}
+	return buf
+}
+
+// Restore rebuilds a symbol's empty book from a Snapshot. Each order is put back in its original
+// pool slot and generation, so its OrderID stays valid for cancels and amends and is never reissued,
+// and GTD orders are re-registered for expiry. The snapshot is fully decoded and checked before the
+// book is touched, so on error nothing is changed. The same quiescence rules as Snapshot apply
+func (e *MatchingEngine) Restore(symbol Symbol, data []byte) error {
+	if symbol >= MAX_SYMBOLS {
+		return ErrSnapshotCorrupt
+	}
+	book := &e.books[symbol]
+	if book.bidMax != 0 || book.askMin != book.priceLevels() || len(book.buyStops) != 0 || len(book.sellStops) != 0 {
+		return ErrSnapshotNotEmpty
+	}
+
+	r := snapshotReader{data: data}
+	r.uint32() // Best bid and ask: book.add recomputes them from the levels, in this engine's price range
+	r.uint32()
+	lastPrice, lastSize := Price(r.uint32()), Size(r.uint32())
+	if lastPrice >= e.priceLevels {
+		return ErrSnapshotCorrupt
+	}
+
+	var orders []snapshotOrder
+	for _, side := range []Side{Bid, Ask} {
+		for levels := r.uint32(); levels > 0 && r.ok(); levels-- {
+			price := Price(r.uint32())
+			if price == 0 || price >= e.priceLevels {
+				return ErrSnapshotCorrupt
+			}
+
+			for count := r.uint32(); count > 0 && r.ok(); count-- {
+				orders = append(orders, snapshotOrder{
+					id:        OrderID(r.uint64()),
+					clOrdID:   r.uint64(),
+					price:     price,
+					size:      Size(r.uint32()),
+					filled:    Size(r.uint32()),
+					peak:      Size(r.uint32()),
+					reserve:   Size(r.uint32()),
+					expiresAt: int64(r.uint64()),
+					trader:    TraderID(r.uint16()),
+					side:      side,
+					flags:     OrderFlags(r.byte()),
+				})
+			}
+		}
+	}
+	if !r.ok() || len(r.data) != 0 {
+		return ErrSnapshotCorrupt
+	}
+
+	// Claim the original slots in ascending order, so a fresh pool only ever grows past them
+	bySlot := make([]int, len(orders))
+	for i := range bySlot {
+		bySlot[i] = i
+	}
+	sort.Slice(bySlot, func(i, j int) bool {
+		return orders[bySlot[i]].id&SLOT_MASK < orders[bySlot[j]].id&SLOT_MASK
+	})
+	for i, idx := range bySlot {
+		slot := Slot(orders[idx].id & SLOT_MASK)
+		if slot == 0 || orders[idx].size == 0 || (i > 0 && slot == Slot(orders[bySlot[i-1]].id&SLOT_MASK)) {
+			return ErrSnapshotCorrupt
+		}
+		if !e.pool.isFree(slot) {
+			return ErrSnapshotSlotInUse
+		}
+	}
+	for _, idx := range bySlot {
+		e.pool.claim(Slot(orders[idx].id&SLOT_MASK), Gen(orders[idx].id>>SLOT_BITS))
+	}
+
+	// Re-link the orders in FIFO order
+	book.allocate()
+	for _, o := range orders {
+		slot := Slot(o.id & SLOT_MASK)
+		book.add(e.pool, o.side, o.price, o.id, slot, o.size, symbol, o.trader, false)
+		book.volumes(o.side).set(o.price, book.level(o.side, o.price).volume)
+		e.pool.track(slot, o.trader)
+		e.pool.tag(slot, o.clOrdID)
+
+		order := e.pool.get(slot)
+		order.filled, order.peak, order.reserve = o.filled, o.peak, o.reserve
+		order.flags = o.flags &^ (FLAG_PENDING_STOP | FLAG_OCO) // OCO groups are not carried by a book snapshot
+
+		if o.expiresAt != 0 {
+			heap.Push(&e.expiries, expiry{expiresAt: o.expiresAt, id: o.id})
+		}
+	}
+
+	book.lastPrice, book.lastSize = lastPrice, lastSize
+	return nil
+}
+
+// Sequential little-endian reader that records (rather than panics on) running out of data
+type snapshotReader struct {
+	data      []byte
+	truncated bool
+}
+
+func (r *snapshotReader) ok() bool { return !r.truncated }
+
+func (r *snapshotReader) next(n int) []byte {
+	if r.truncated || len(r.data) < n {
+		r.truncated = true
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *snapshotReader) byte() byte     { return r.next(1)[0] }
+func (r *snapshotReader) uint16() uint16 { return binary.LittleEndian.Uint16(r.next(2)) }
+func (r *snapshotReader) uint32() uint32 { return binary.LittleEndian.Uint32(r.next(4)) }
+func (r *snapshotReader) uint64() uint64 { return binary.LittleEndian.Uint64(r.next(8)) }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 3, 1, GTC)
+	e.Limit(1, Bid, 10, 4, 2, GTC)
+	e.Limit(1, Bid, 8, 5, 1, GTC)
+	e.LimitCommand(&InputCommand{symbol: 1, side: Ask, price: 12, size: 10, peakSize: 2, trader: 3})
+	e.Limit(1, Ask, 11, 2, 3, GTC)
+	e.Limit(1, Bid, 11, 1, 4, GTC) // Trades, setting lastPrice and a partial fill
+	drainOutputEvents(e)
+
+	data := e.Snapshot(1)
+
+	restored := newTestEngine()
+	if err := restored.Restore(1, data); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if again := restored.Snapshot(1); !bytes.Equal(data, again) {
+		t.Fatalf("snapshot of restored book differs from the original")
+	}
+
+	book := &restored.books[1]
+	if book.bidMax != 10 || book.askMin != 11 || book.lastPrice != 11 {
+		t.Fatalf("expected bidMax 10, askMin 11, lastPrice 11, got %d %d %d", book.bidMax, book.askMin, book.lastPrice)
+	}
+
+	// FIFO order within a level is preserved
+	first := restored.pool.get(book.bidLevels[10].headSlot)
+	second := restored.pool.get(first.nextSlot)
+	if first.size != 3 || first.trader != 1 || second.size != 4 || second.trader != 2 {
+		t.Fatalf("expected bid queue 3 (trader 1) then 4 (trader 2), got %+v then %+v", first, second)
+	}
+
+	// Iceberg reserve survives the round trip
+	if ice := restored.pool.get(book.askLevels[12].headSlot); ice.size != 2 || ice.reserve != 8 || ice.peak != 2 {
+		t.Fatalf("expected iceberg 2 visible / 8 reserve, got %+v", ice)
+	}
+}
+
+func TestSnapshot_RestoredOrdersKeepTheirIDs(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Bid, 10, 3, 1, GTC)
+	e.Limit(1, Bid, 9, 4, 1, GTC)
+	e.Limit(1, Bid, 8, 5, 1, GTC)
+	events := drainOutputEvents(e)
+	e.Cancel(events[0].orderID, 1) // Leaves a hole in the slots
+	drainOutputEvents(e)
+	second, third := events[2].orderID, events[4].orderID
+
+	restored := newTestEngine()
+	if err := restored.Restore(1, e.Snapshot(1)); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+
+	// Cancels address the restored orders by their original IDs
+	restored.Cancel(third, 1)
+	events = drainOutputEvents(restored)
+	if len(events) != 1 || events[0].eventType != CANCEL_EVENT || events[0].orderID != third {
+		t.Fatalf("expected CANCEL_EVENT for a restored order, got %+v", events)
+	}
+	if exists, remaining, price, _, _ := restored.OrderStatus(second); !exists || remaining != 4 || price != 9 {
+		t.Fatalf("expected the other restored order untouched, got %v %d %d", exists, remaining, price)
+	}
+
+	// New orders never reuse a restored order's ID
+	for i := 0; i < 3; i++ {
+		restored.Limit(1, Ask, 20, 1, 2, GTC)
+	}
+	for _, ev := range drainOutputEvents(restored) {
+		if ev.orderID == second {
+			t.Fatalf("new order reissued restored ID %d", second)
+		}
+	}
+	if exists, _, _, _, _ := restored.OrderStatus(second); !exists {
+		t.Fatalf("expected the restored order still live")
+	}
+}
+
+func TestSnapshot_RestoreReregistersExpiries(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 10, size: 5, trader: 1, tif: GTD, expiresAt: 100})
+	id := drainOutputEvents(e)[0].orderID
+
+	restored := newTestEngine()
+	if err := restored.Restore(1, e.Snapshot(1)); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+
+	restored.Expire(100)
+	events := drainOutputEvents(restored)
+	if len(events) != 1 || events[0].eventType != CANCEL_EVENT || events[0].orderID != id {
+		t.Fatalf("expected the restored GTD order to expire, got %+v", events)
+	}
+}
+
+func TestSnapshot_RestoreRejectsBadInput(t *testing.T) {
+	e := newTestEngine()
+	e.Limit(1, Bid, 10, 3, 1, GTC)
+	data := e.Snapshot(1)
+
+	restored := newTestEngine()
+	if err := restored.Restore(1, data[:len(data)-1]); err != ErrSnapshotCorrupt {
+		t.Fatalf("expected ErrSnapshotCorrupt for truncated data, got %v", err)
+	}
+	if err := e.Restore(1, data); err != ErrSnapshotNotEmpty {
+		t.Fatalf("expected ErrSnapshotNotEmpty for a populated book, got %v", err)
+	}
+
+	// The order's slot is already taken by a live order on another symbol
+	if err := e.Restore(2, data); err != ErrSnapshotSlotInUse {
+		t.Fatalf("expected ErrSnapshotSlotInUse, got %v", err)
+	}
+	if e.books[2].bidMax != 0 {
+		t.Fatalf("expected a failed restore to leave the book untouched")
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import "sync/atomic"
+
+// Engine activity counters since start. Only the engine's distributor goroutines write them, but
+// Stats may read them from any goroutine, so every access is atomic
+type Stats struct {
+	accepted  uint64 // Orders accepted (ORDER_EVENT), including stops
+	rejected  uint64 // Commands rejected (REJECT_EVENT)
+	cancelled uint64 // Orders or remainders cancelled (CANCEL_EVENT), including partial cancels, expiries and STP cancels
+	trades    uint64 // Executions
+	volume    uint64 // Total executed size
+	dropped   uint64 // Output events a subscriber missed by falling SUBSCRIBER_BUFFER behind (see Subscribe)
+}
+
+// Stats returns a snapshot of the engine's counters. Each counter is read atomically, but they are
+// not read together, so a snapshot taken while the engine is busy may be mid-command
+func (e *MatchingEngine) Stats() Stats {
+	return Stats{
+		accepted:  atomic.LoadUint64(&e.stats.accepted),
+		rejected:  atomic.LoadUint64(&e.stats.rejected),
+		cancelled: atomic.LoadUint64(&e.stats.cancelled),
+		trades:    atomic.LoadUint64(&e.stats.trades),
+		volume:    atomic.LoadUint64(&e.stats.volume),
+		dropped:   atomic.LoadUint64(&e.stats.dropped),
+	}
+}
+
+// Count and emit a rejection, returning its reason
+func (e *MatchingEngine) reject(ev OutputEvent) RejectReason {
+	atomic.AddUint64(&e.stats.rejected, 1)
+	e.outputRing.Push(ev)
+	return ev.reason
+}
+
+// Count and emit a cancellation
+func (e *MatchingEngine) emitCancel(ev OutputEvent) {
+	atomic.AddUint64(&e.stats.cancelled, 1)
+	e.outputRing.Push(ev)
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestStats_Reconcile(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 100, 10, 2, GTC)
+	e.Limit(1, Ask, 101, 5, 2, GTC)
+	e.Limit(1, Bid, 101, 12, 1, GTC) // Fills 10@100 and 2@101, completing it and the first ask
+	e.Limit(1, Bid, 100, 0, 1, GTC)  // Rejected: zero size
+	e.Limit(1, Bid, 90, 4, 3, IOC)   // Accepted, then its remainder is cancelled
+	e.Limit(1, Bid, 95, 6, 3, GTC)   // Rests
+
+	events := drainOutputEvents(e)
+	e.Cancel(events[2].orderID, 2) // Cancels the rest of the 101 ask
+	e.Cancel(events[2].orderID, 2) // Rejected: already gone
+	drainOutputEvents(e)
+
+	s := e.Stats()
+	if s.accepted != 5 || s.rejected != 2 || s.cancelled != 2 || s.trades != 2 || s.volume != 12 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	// Every accepted order ended fully filled, cancelled or resting
+	bids, asks := e.Depth(1, 10)
+	const fullyFilled = 2
+	if resting := uint64(len(bids) + len(asks)); s.accepted != fullyFilled+s.cancelled+resting {
+		t.Fatalf("expected accepted %d = filled %d + cancelled %d + resting %d", s.accepted, fullyFilled, s.cancelled, resting)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import "sort"
+
+// A dormant stop order. The order itself waits in its pool slot (flagged FLAG_PENDING_STOP), while
+// the stop-only trigger and entry parameters live here rather than in every pooled Order
+type pendingStop struct {
+	slot      Slot
+	stopPrice Price
+	tif       TimeInForce // Applied when the stop is entered
+	trail     Price       // Trailing offset, 0 for a fixed stopPrice
+}
+
+// Hold a stop order dormant until the last traded price reaches its trigger.
+// Buy stops trigger when the last price rises to stopPrice or above, sell stops when it falls to stopPrice or below.
+// A trailing stop's trigger then follows the market at cmd.trailOffset (see trail)
+func (e *MatchingEngine) addStop(book *OrderBook, cmd *InputCommand, slot Slot, id OrderID) {
+	order := e.pool.get(slot)
+	order.id = id
+	order.price = cmd.price
+	order.size = cmd.size
+	order.filled = 0
+	order.peak = cmd.peakSize
+	order.reserve = 0
+	order.flags |= FLAG_PENDING_STOP
+	if cmd.reduceOnly {
+		order.flags |= FLAG_REDUCE_ONLY
+	}
+	order.trader = cmd.trader
+	order.symbol = cmd.symbol
+	order.side = cmd.side
+
+	book.insertStop(cmd.side, pendingStop{slot: slot, stopPrice: cmd.stopPrice, tif: cmd.tif, trail: cmd.trailOffset})
+	if cmd.trailOffset != 0 {
+		book.trailing++
+	}
+}
+
+// Activate pending stops reached by the last traded price, in price order: buy stops from the lowest
+// trigger and sell stops from the highest (ties in arrival order). A triggered stop can trade and
+// move the last price, so cascading triggers are handled by the same loop. Every matching path ends
+// here, so this is also where OCO orders whose group has executed are cancelled, each time before
+// a stop can trigger
+func (e *MatchingEngine) triggerStops(book *OrderBook) {
+	for {
+		e.cancelGrouped()
+		if book.lastPrice == 0 {
+			return
+		}
+
+		var stop pendingStop
+
+		if n := len(book.buyStops); n > 0 && book.buyStops[n-1].stopPrice <= book.lastPrice {
+			stop = book.buyStops[n-1]
+			book.buyStops = book.buyStops[:n-1]
+		} else if n := len(book.sellStops); n > 0 && book.sellStops[n-1].stopPrice >= book.lastPrice {
+			stop = book.sellStops[n-1]
+			book.sellStops = book.sellStops[:n-1]
+		} else {
+			return
+		}
+		if stop.trail != 0 {
+			book.trailing--
+		}
+
+		slot := stop.slot
+		order := e.pool.get(slot)
+		order.flags &^= FLAG_PENDING_STOP
+		if order.flags&FLAG_OCO != 0 {
+			e.groupExecuted(slot)
+		}
+
+		// Fill-or-kill and self-trade rejection are checked at activation rather than entry
+		bound := book.limitPrice(order.side, order.price)
+		if (stop.tif == FOK && !e.canFill(book, order.side, bound, order.size, order.trader, nil)) ||
+			(e.stpMode == STP_REJECT_AGGRESSOR && e.wouldSelfTrade(book, order.side, bound, order.size, order.trader, nil)) {
+			e.cancelRemainder(slot, order.id, order.symbol, order.side, order.price, order.size, order.trader)
+			continue
+		}
+
+		// Enter the stop as a live limit (or market, for a zero price) order under its original ID
+		cmd := InputCommand{
+			symbol:     order.symbol,
+			side:       order.side,
+			price:      order.price,
+			size:       order.size,
+			peakSize:   order.peak,
+			trader:     order.trader,
+			tif:        stop.tif,
+			reduceOnly: order.flags&FLAG_REDUCE_ONLY != 0,
+		}
+		e.place(book, &cmd, slot, order.id)
+	}
+}
+
+func (book *OrderBook) stops(side Side) *[]pendingStop {
+	if side == Bid {
+		return &book.buyStops
+	}
+	return &book.sellStops
+}
+
+// Insert a pending stop into its side's list, keeping the next stop to trigger at the end
+func (book *OrderBook) insertStop(side Side, stop pendingStop) {
+	stops := book.stops(side)
+
+	// Find the first stop that triggers before the new one (a lower buy or higher sell trigger, or an equal earlier one)
+	i := sort.Search(len(*stops), func(i int) bool {
+		other := (*stops)[i].stopPrice
+		if side == Bid {
+			return other <= stop.stopPrice
+		}
+		return other >= stop.stopPrice
+	})
+
+	*stops = append(*stops, pendingStop{})
+	copy((*stops)[i+1:], (*stops)[i:])
+	(*stops)[i] = stop
+}
+
+// Remove a pending stop from its side's list (on cancellation)
+func (book *OrderBook) removeStop(pool *OrderPool, slot Slot) {
+	order := pool.get(slot)
+	stops := book.stops(order.side)
+
+	for i, stop := range *stops {
+		if stop.slot == slot {
+			*stops = append((*stops)[:i], (*stops)[i+1:]...)
+			if stop.trail != 0 {
+				book.trailing--
+			}
+			break
+		}
+	}
+	order.flags &^= FLAG_PENDING_STOP
+}
+
+// Initial trigger of a trailing stop entered without a stopPrice: offset behind the last trade (above
+// it for a buy, below it for a sell), or 0 if the symbol has not traded or a sell would trigger at or
+// below zero
+func (book *OrderBook) trailStart(side Side, offset Price) Price {
+	if book.lastPrice == 0 {
+		return 0
+	}
+	if side == Bid {
+		return book.lastPrice + offset
+	}
+	if book.lastPrice <= offset {
+		return 0
+	}
+	return book.lastPrice - offset
+}
+
+// Ratchet the trailing stops after a trade at price: a sell stop's trigger rises to price - trail
+// and a buy stop's falls to price + trail, but neither ever moves back, so a stop only triggers once
+// the market has reversed by its offset from the best price since entry. Moved stops are re-sorted,
+// ties keeping their order in the list
+func (book *OrderBook) trail(price Price) {
+	if book.trailing == 0 {
+		return
+	}
+	for _, side := range []Side{Bid, Ask} {
+		stops := *book.stops(side)
+		moved := false
+		for i := range stops {
+			stop := &stops[i]
+			if stop.trail == 0 {
+				continue
+			}
+			if side == Bid && price+stop.trail < stop.stopPrice {
+				stop.stopPrice, moved = price+stop.trail, true
+			} else if side == Ask && price > stop.trail && price-stop.trail > stop.stopPrice {
+				stop.stopPrice, moved = price-stop.trail, true
+			}
+		}
+		if moved {
+			sort.SliceStable(stops, func(i, j int) bool {
+				if side == Bid {
+					return stops[i].stopPrice > stops[j].stopPrice
+				}
+				return stops[i].stopPrice < stops[j].stopPrice
+			})
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import "testing"
+
+func TestStop_DormantUntilTriggered(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 12, 5, 1, GTC)
+	e.Market(&InputCommand{symbol: 1, side: Bid, size: 5, stopPrice: 11, trader: 2})
+	events := takerEvents(drainOutputEvents(e))
+	stopID := events[2].orderID
+	if len(events) != 3 || events[1].eventType != RESTED_EVENT || events[2].eventType != ORDER_EVENT {
+		t.Fatalf("expected only ORDER_EVENT receipts while dormant, got %+v", events)
+	}
+
+	// A trade at 10 is below the buy stop trigger
+	e.Limit(1, Ask, 10, 1, 3, GTC)
+	e.Limit(1, Bid, 10, 1, 4, GTC)
+	events = takerEvents(drainOutputEvents(e))
+	for _, ev := range events {
+		if ev.orderID == stopID {
+			t.Fatalf("stop should not have triggered at 10, got %+v", events)
+		}
+	}
+
+	// A trade at 11 triggers the stop, which then buys the ask at 12
+	e.Limit(1, Ask, 11, 1, 3, GTC)
+	e.Limit(1, Bid, 11, 1, 4, GTC)
+	events = takerEvents(drainOutputEvents(e))
+	last := events[len(events)-1]
+	if last.eventType != EXECUTION_EVENT || last.orderID != stopID || last.price != 12 || last.size != 5 {
+		t.Fatalf("expected triggered stop to execute 5 at 12, got %+v", events)
+	}
+	if e.books[1].lastPrice != 12 {
+		t.Fatalf("expected lastPrice 12, got %d", e.books[1].lastPrice)
+	}
+}
+
+func TestStop_CascadeInPriceOrder(t *testing.T) {
+	e := newTestEngine()
+
+	// Resting bids the sell stops will hit, one lot per price
+	for p := Price(10); p >= 6; p-- {
+		e.Limit(1, Bid, p, 1, 1, GTC)
+	}
+
+	// Sell stops: the 9 trigger should activate before the 8 trigger despite arriving later.
+	// The stop at 8 then triggers from the trade made by the stop at 9
+	e.Market(&InputCommand{symbol: 1, side: Ask, size: 1, stopPrice: 8, trader: 2})
+	e.Market(&InputCommand{symbol: 1, side: Ask, size: 1, stopPrice: 9, trader: 3})
+	e.Market(&InputCommand{symbol: 1, side: Ask, size: 1, stopPrice: 5, trader: 4}) // never reached
+	drainOutputEvents(e)
+
+	// Trade at 10 then 9 (triggering the stop at 9)
+	e.Limit(1, Ask, 9, 2, 5, GTC)
+
+	var traders []TraderID
+	var prices []Price
+	for _, ev := range takerEvents(drainOutputEvents(e)) {
+		if ev.eventType == EXECUTION_EVENT {
+			traders = append(traders, ev.trader)
+			prices = append(prices, ev.price)
+		}
+	}
+
+	expTraders := []TraderID{5, 5, 3, 2}
+	expPrices := []Price{10, 9, 8, 7}
+	if len(traders) != len(expTraders) {
+		t.Fatalf("expected %d executions, got traders %v prices %v", len(expTraders), traders, prices)
+	}
+	for i := range expTraders {
+		if traders[i] != expTraders[i] || prices[i] != expPrices[i] {
+			t.Fatalf("expected traders %v at %v, got %v at %v", expTraders, expPrices, traders, prices)
+		}
+	}
+	if len(e.books[1].sellStops) != 1 {
+		t.Fatalf("expected one stop still pending, got %d", len(e.books[1].sellStops))
+	}
+}
+
+func TestStop_CancelPending(t *testing.T) {
+	e := newTestEngine()
+
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 12, size: 5, stopPrice: 11, trader: 2})
+	id := drainOutputEvents(e)[0].orderID
+
+	e.Cancel(id, 2)
+	events := drainOutputEvents(e)
+	if len(events) != 1 || events[0].eventType != CANCEL_EVENT {
+		t.Fatalf("expected CANCEL_EVENT, got %+v", events)
+	}
+	if len(e.books[1].buyStops) != 0 {
+		t.Fatalf("expected no pending stops, got %d", len(e.books[1].buyStops))
+	}
+
+	// A trade through the trigger must not resurrect it
+	e.Limit(1, Ask, 11, 1, 3, GTC)
+	e.Limit(1, Bid, 11, 1, 4, GTC)
+	for _, ev := range drainOutputEvents(e) {
+		if ev.orderID == id {
+			t.Fatalf("cancelled stop should not trigger, got %+v", ev)
+		}
+	}
+}
+
+func TestMarket_CancelsUnfilledRemainder(t *testing.T) {
+	e := newTestEngine()
+
+	e.Limit(1, Ask, 10, 2, 1, GTC)
+	e.Limit(1, Ask, 500, 2, 1, GTC)
+	drainOutputEvents(e)
+
+	e.Market(&InputCommand{symbol: 1, side: Bid, size: 6, trader: 2})
+
+	events := takerEvents(drainOutputEvents(e))
+	if len(events) != 4 {
+		t.Fatalf("expected ORDER, 2 executions and CANCEL, got %+v", events)
+	}
+	if events[1].price != 10 || events[2].price != 500 {
+		t.Fatalf("expected executions at 10 and 500, got %+v", events)
+	}
+	if events[3].eventType != CANCEL_EVENT || events[3].size != 2 {
+		t.Fatalf("expected remainder of 2 cancelled, got %+v", events[3])
+	}
+	if e.books[1].bidMax != 0 {
+		t.Fatalf("market order should not rest, bidMax %d", e.books[1].bidMax)
+	}
+}
+
+func TestStop_FOKTriggeredUnderSTPExcludesOwnOrders(t *testing.T) {
+	e := newTestEngine()
+	e.SetSTPMode(STP_CANCEL_RESTING)
+
+	e.Limit(1, Ask, 10, 5, 1, GTC)
+	e.Limit(1, Ask, 10, 3, 2, GTC)
+	e.Limit(1, Ask, 9, 1, 4, GTC)
+	e.LimitCommand(&InputCommand{symbol: 1, side: Bid, price: 10, size: 8, stopPrice: 9, trader: 1, tif: FOK})
+	stop := drainOutputEvents(e)[6].orderID
+
+	// Trading at 9 triggers the stop, which cannot fill 8 without its own order
+	e.Limit(1, Bid, 9, 1, 5, GTC)
+	events := drainOutputEvents(e)
+	last := events[len(events)-1]
+	if last.eventType != CANCEL_EVENT || last.orderID != stop || last.size != 8 {
+		t.Fatalf("expected the triggered FOK stop cancelled in full, got %+v", events)
+	}
+	if volume := e.books[1].VolumeAt(Ask, 10); volume != 8 {
+		t.Fatalf("expected the asks at 10 untouched, got volume %d", volume)
+	}
+}
+
+func TestStop_TrailingSellRatchetsUpAndTriggersOnReversal(t *testing.T) {
+	e := newTestEngine()
+	trade := func(price Price) {
+		e.Limit(1, Ask, price, 1, 1, GTC)
+		e.Limit(1, Bid, price, 1, 2, GTC)
+	}
+
+	e.Limit(1, Bid, 90, 5, 3, GTC) // What the stop sells into once triggered
+	trade(100)
+	e.Market(&InputCommand{symbol: 1, side: Ask, size: 5, trailOffset: 5, trader: 4})
+	events := takerEvents(drainOutputEvents(e))
+	stopID := events[len(events)-1].orderID
+	if events[len(events)-1].eventType != ORDER_EVENT || e.books[1].sellStops[0].stopPrice != 95 {
+		t.Fatalf("expected a dormant stop triggering at 95, got %+v and %+v", events, e.books[1].sellStops)
+	}
+
+	// The trigger follows a rally up, but not the pullback after it
+	for _, step := range []struct{ price, trigger Price }{{110, 105}, {107, 105}, {108, 105}} {
+		trade(step.price)
+		if got := e.books[1].sellStops[0].stopPrice; got != step.trigger {
+			t.Fatalf("after a trade at %d expected the trigger at %d, got %d", step.price, step.trigger, got)
+		}
+	}
+	drainOutputEvents(e)
+
+	// A fall back to the trigger enters the stop, which sells into the bid at 90
+	trade(105)
+	events = takerEvents(drainOutputEvents(e))
+	last := events[len(events)-1]
+	if last.eventType != EXECUTION_EVENT || last.orderID != stopID || last.price != 90 || last.size != 5 {
+		t.Fatalf("expected the triggered stop to sell 5 at 90, got %+v", events)
+	}
+	if len(e.books[1].sellStops) != 0 || e.books[1].trailing != 0 {
+		t.Fatalf("expected no pending stops left, got %+v (%d trailing)", e.books[1].sellStops, e.books[1].trailing)
+	}
+}
+
+func TestStop_TrailingBuyRatchetsDownInTriggerOrder(t *testing.T) {
+	e := newTestEngine()
+	trade := func(price Price) {
+		e.Limit(1, Bid, price, 1, 1, GTC)
+		e.Limit(1, Ask, price, 1, 2, GTC)
+	}
+
+	// Without a last trade there is nothing to trail from
+	e.Market(&InputCommand{symbol: 1, side: Bid, size: 1, trailOffset: 5, trader: 3})
+	if events := drainOutputEvents(e); len(events) != 1 || events[0].reason != REJECT_INVALID_PRICE {
+		t.Fatalf("expected REJECT_INVALID_PRICE before any trade, got %+v", events)
+	}
+
+	// A fixed stop at 104 and a trailing one starting at 108, which passes it as the market falls
+	trade(100)
+	e.Market(&InputCommand{symbol: 1, side: Bid, size: 1, stopPrice: 104, trader: 3})
+	e.Market(&InputCommand{symbol: 1, side: Bid, size: 1, stopPrice: 108, trailOffset: 5, trader: 4})
+	trade(102)
+	trade(97)
+	stops := e.books[1].buyStops
+	if len(stops) != 2 || stops[1].stopPrice != 102 || stops[1].trail != 5 || stops[0].stopPrice != 104 {
+		t.Fatalf("expected the trailing stop at 102 to be next to trigger, got %+v", stops)
+	}
+	trade(99)
+	if got := e.books[1].buyStops[1].stopPrice; got != 102 {
+		t.Fatalf("expected a rise to leave the trigger at 102, got %d", got)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var (
+	ErrEngineStopped = errors.New("engine: stopped, command dropped")
+	ErrNotAnOrder    = errors.New("engine: Submit only takes ORDER_EVENT and MARKET_EVENT commands")
+)
+
+// Outcome of a command pushed by Submit, handed from the matching goroutine to the waiting caller
+type submitResult struct {
+	id     OrderID
+	reason RejectReason
+}
+
+// Submit pushes a new order command (ORDER_EVENT, or MARKET_EVENT) through the input ring like any
+// other producer, then blocks until the matching goroutine has processed it, returning the new
+// order's ID or a *RejectError. The command carries a correlation token, which dispatch uses to hand
+// the result straight back to this caller, so commands from other producers never wait on it. The
+// order's events are emitted as usual. Safe for concurrent callers; the input distributor must be
+// running (Stop still applies every command pushed before it)
+func (e *MatchingEngine) Submit(cmd InputCommand) (OrderID, error) {
+	if cmd.eventType != ORDER_EVENT && cmd.eventType != MARKET_EVENT {
+		return 0, ErrNotAnOrder
+	}
+
+	done := make(chan submitResult, 1)
+	cmd.token = atomic.AddUint64(&e.lastToken, 1)
+	e.waiters.Store(cmd.token, done)
+	if !e.inputRing.Push(cmd) {
+		e.waiters.Delete(cmd.token)
+		return 0, ErrEngineStopped
+	}
+
+	res := <-done
+	if res.id == 0 {
+		return 0, &RejectError{reason: res.reason}
+	}
+	return res.id, nil
+}
+
+// Query runs fn on the matching goroutine between two commands, so it can read the books (Depth,
+// OrderStatus and the like) consistently while the engine is running, and blocks until fn has
+// returned. fn must not block or panic, as the matching loop waits on it. Safe for concurrent
+// callers; the input distributor must be running
+func (e *MatchingEngine) Query(fn func()) error {
+	done := make(chan struct{})
+	token := atomic.AddUint64(&e.lastToken, 1)
+	e.waiters.Store(token, func() {
+		fn()
+		close(done)
+	})
+	if !e.inputRing.Push(InputCommand{eventType: QUERY_EVENT, token: token}) {
+		e.waiters.Delete(token)
+		return ErrEngineStopped
+	}
+	<-done
+	return nil
+}
+
+// Run the Query waiting on a QUERY_EVENT's token, if any (a query replayed from a frame or log has none)
+func (e *MatchingEngine) runQuery(token uint64) {
+	if token == 0 {
+		return
+	}
+	if fn, ok := e.waiters.LoadAndDelete(token); ok {
+		fn.(func())()
+	}
+}
+
+// Hand a processed command's result to the Submit call waiting on its token, if any
+func (e *MatchingEngine) complete(token uint64, id OrderID, reason RejectReason) {
+	if token == 0 {
+		return
+	}
+	if done, ok := e.waiters.LoadAndDelete(token); ok {
+		done.(chan submitResult) <- submitResult{id: id, reason: reason}
+	}
+}
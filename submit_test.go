@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestSubmit_ReturnsIDOnceProcessed(t *testing.T) {
+	e := newTestEngine()
+	go e.StartInputDistributor()
+	defer e.Stop()
+
+	id, err := e.Submit(InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Ask, price: 100, size: 10, trader: 1})
+	if err != nil || id == 0 {
+		t.Fatalf("expected an accepted order, got %d, %v", id, err)
+	}
+	// The matching goroutine has already applied the order by the time Submit returns
+	if exists, remaining, _, _, _ := e.OrderStatus(id); !exists || remaining != 10 {
+		t.Fatalf("expected the returned ID to be resting with 10, got %v %d", exists, remaining)
+	}
+
+	marketID, err := e.Submit(InputCommand{eventType: MARKET_EVENT, symbol: 1, side: Bid, size: 4, trader: 2})
+	if err != nil || marketID == 0 || marketID == id {
+		t.Fatalf("expected an accepted market order with its own ID, got %d, %v", marketID, err)
+	}
+
+	_, err = e.Submit(InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: 100, size: 0, trader: 2})
+	var rejectErr *RejectError
+	if !errors.As(err, &rejectErr) || rejectErr.Reason() != REJECT_INVALID_SIZE {
+		t.Fatalf("expected a RejectError with REJECT_INVALID_SIZE, got %v", err)
+	}
+
+	if _, err := e.Submit(InputCommand{eventType: CANCEL_EVENT, orderID: id}); err != ErrNotAnOrder {
+		t.Fatalf("expected ErrNotAnOrder for a cancel, got %v", err)
+	}
+}
+
+func TestSubmit_ConcurrentCallersGetTheirOwnIDs(t *testing.T) {
+	e := newTestEngine()
+	go e.StartInputDistributor()
+	defer e.Stop()
+
+	const callers, perCaller = 8, 50
+	ids := make([][]OrderID, callers)
+	var wg sync.WaitGroup
+	for c := 0; c < callers; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < perCaller; i++ {
+				id, err := e.Submit(InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: 10, size: 1, trader: TraderID(c + 1)})
+				if err != nil {
+					t.Errorf("caller %d: unexpected error %v", c, err)
+					return
+				}
+				ids[c] = append(ids[c], id)
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	seen := make(map[OrderID]bool)
+	for c, callerIDs := range ids {
+		for _, id := range callerIDs {
+			if seen[id] {
+				t.Fatalf("order %d returned to more than one Submit", id)
+			}
+			seen[id] = true
+			// Each caller's ID must belong to an order that caller placed
+			if trader := e.pool.get(Slot(id & SLOT_MASK)).trader; trader != TraderID(c+1) {
+				t.Fatalf("caller %d got order %d of trader %d", c+1, id, trader)
+			}
+		}
+	}
+	if len(seen) != callers*perCaller {
+		t.Fatalf("expected %d distinct IDs, got %d", callers*perCaller, len(seen))
+	}
+}
+
+func TestSubmit_AfterStopReturnsErrEngineStopped(t *testing.T) {
+	e := newTestEngine()
+	e.Stop()
+
+	if _, err := e.Submit(InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: 10, size: 1, trader: 1}); err != ErrEngineStopped {
+		t.Fatalf("expected ErrEngineStopped, got %v", err)
+	}
+}
+
+func TestQuery_RunsBetweenCommandsOnTheMatchingGoroutine(t *testing.T) {
+	e := newTestEngine()
+	go e.StartInputDistributor()
+
+	for i := 0; i < 100; i++ {
+		e.inputRing.Push(InputCommand{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: 10, size: 1, trader: 1})
+	}
+	var volume Size
+	if err := e.Query(func() { volume = e.books[1].VolumeAt(Bid, 10) }); err != nil {
+		t.Fatal(err)
+	}
+	// Commands pushed before the query have all been applied by the time it runs
+	if volume != 100 {
+		t.Fatalf("expected the query to see all 100 orders, got volume %d", volume)
+	}
+
+	e.Stop()
+	if err := e.Query(func() { t.Error("query ran on a stopped engine") }); err != ErrEngineStopped {
+		t.Fatalf("expected ErrEngineStopped once stopped, got %v", err)
+	}
+}
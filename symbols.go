@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+var (
+	ErrSymbolsExhausted = errors.New("symbols: all MAX_SYMBOLS symbols are registered")
+	ErrSymbolName       = errors.New("symbols: name is empty or numeric")
+)
+
+// Bidirectional mapping between ticker names and Symbol indices. Lookups come from client-facing
+// goroutines while registrations are rare, so it is guarded by its own lock rather than living on
+// the matching goroutine
+type symbolRegistry struct {
+	mu     sync.RWMutex
+	byName map[string]Symbol
+	names  []string // Indexed by Symbol, in registration order
+}
+
+// RegisterSymbol assigns the next free Symbol to a ticker name, or returns the Symbol it already
+// has. Numeric names are refused so they can never be confused with a raw Symbol index (see LookupSymbol)
+func (e *MatchingEngine) RegisterSymbol(name string) (Symbol, error) {
+	if _, err := strconv.ParseUint(name, 10, 16); name == "" || err == nil {
+		return 0, ErrSymbolName
+	}
+
+	r := &e.symbols
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if symbol, ok := r.byName[name]; ok {
+		return symbol, nil
+	}
+	if len(r.names) == MAX_SYMBOLS {
+		return 0, ErrSymbolsExhausted
+	}
+	if r.byName == nil {
+		r.byName = make(map[string]Symbol)
+	}
+
+	symbol := Symbol(len(r.names))
+	r.byName[name] = symbol
+	r.names = append(r.names, name)
+	return symbol, nil
+}
+
+// SymbolName returns a symbol's registered ticker name, or "" if it has none
+func (e *MatchingEngine) SymbolName(symbol Symbol) string {
+	r := &e.symbols
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if int(symbol) < len(r.names) {
+		return r.names[symbol]
+	}
+	return ""
+}
+
+// LookupSymbol resolves a client-supplied symbol: a registered ticker name, or a raw numeric index
+// below MAX_SYMBOLS. Unknown tickers and out-of-range numbers report false rather than defaulting to 0
+func (e *MatchingEngine) LookupSymbol(s string) (Symbol, bool) {
+	if n, err := strconv.ParseUint(s, 10, 16); err == nil {
+		return Symbol(n), n < MAX_SYMBOLS
+	}
+
+	r := &e.symbols
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	symbol, ok := r.byName[s]
+	return symbol, ok
+}
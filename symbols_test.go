@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSymbolRegistry_RegisterAndLookup(t *testing.T) {
+	e := newTestEngine()
+
+	aapl, err := e.RegisterSymbol("AAPL")
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	msft, _ := e.RegisterSymbol("MSFT")
+	if again, _ := e.RegisterSymbol("AAPL"); again != aapl || msft == aapl {
+		t.Fatalf("expected AAPL to keep symbol %d and MSFT to get another, got %d and %d", aapl, again, msft)
+	}
+	if e.SymbolName(msft) != "MSFT" || e.SymbolName(200) != "" {
+		t.Fatalf("expected names MSFT and \"\", got %q and %q", e.SymbolName(msft), e.SymbolName(200))
+	}
+
+	if symbol, ok := e.LookupSymbol("MSFT"); !ok || symbol != msft {
+		t.Fatalf("expected MSFT to resolve to %d, got %d (%v)", msft, symbol, ok)
+	}
+	if symbol, ok := e.LookupSymbol("42"); !ok || symbol != 42 {
+		t.Fatalf("expected the numeric form to keep working, got %d (%v)", symbol, ok)
+	}
+	for _, s := range []string{"GOOG", "256", "-1", ""} {
+		if _, ok := e.LookupSymbol(s); ok {
+			t.Fatalf("expected %q not to resolve", s)
+		}
+	}
+	if _, err := e.RegisterSymbol("7"); err != ErrSymbolName {
+		t.Fatalf("expected ErrSymbolName for a numeric name, got %v", err)
+	}
+}
+
+func TestSymbolRegistry_Exhaustion(t *testing.T) {
+	e := newTestEngine()
+	for i := 0; i < MAX_SYMBOLS; i++ {
+		if _, err := e.RegisterSymbol("S" + strconv.Itoa(i)); err != nil {
+			t.Fatalf("register %d failed: %v", i, err)
+		}
+	}
+	if _, err := e.RegisterSymbol("ONE_TOO_MANY"); err != ErrSymbolsExhausted {
+		t.Fatalf("expected ErrSymbolsExhausted, got %v", err)
+	}
+	if _, err := e.RegisterSymbol("S0"); err != nil {
+		t.Fatalf("expected an existing name to still resolve, got %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import "runtime"
+
+const (
+	CPU_SET_SIZE = 1024 // CPUs addressable by EngineConfig.cpus (the size of Linux's cpu_set_t)
+
+	INPUT_THREAD  = 0 // Index in EngineConfig.cpus of the input distributor's (matching loop's) CPU
+	OUTPUT_THREAD = 1 // Index in EngineConfig.cpus of the output distributor's CPU
+)
+
+// Lock the calling distributor to its OS thread and bind that thread to its CPU, if the engine is
+// configured to (see EngineConfig.lockThreads). Returns the func that undoes it, for the distributor
+// to defer, so a distributor run on the caller's own goroutine leaves its thread as it found it.
+// Panics if the thread cannot be bound, as the distributor has no other way to report it
+func (e *MatchingEngine) pinThread(role int) (unpin func()) {
+	if !e.lockThreads {
+		return func() {}
+	}
+	runtime.LockOSThread()
+	if role >= len(e.cpus) {
+		return runtime.UnlockOSThread
+	}
+
+	restore, err := bindCPU(e.cpus[role])
+	if err != nil {
+		runtime.UnlockOSThread()
+		panic("affinity: cannot bind distributor thread: " + err.Error())
+	}
+	return func() {
+		restore()
+		runtime.UnlockOSThread()
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+// A print on the time-and-sales tape: one execution, seen from the aggressor's side
+type Trade struct {
+	id        TradeID
+	symbol    Symbol
+	price     Price
+	size      Size
+	aggressor Side // Bid for a buyer-initiated trade, Ask for a seller-initiated one
+}
+
+// Trade reported by a taker EXECUTION_EVENT
+func tradeOf(ev *OutputEvent) Trade {
+	return Trade{id: ev.tradeID, symbol: ev.symbol, price: ev.price, size: ev.size, aggressor: ev.side}
+}
+
+// OnTrade subscribes fn to the trade tape: StartOutputDistributor calls it once for every execution,
+// in order, after the output callback has seen its taker EXECUTION_EVENT. Register before starting
+// the output distributor
+func (e *MatchingEngine) OnTrade(fn func(Trade)) {
+	e.onTrade = fn
+}
@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestOnTrade_ReportsAggressorAndUniqueIDs(t *testing.T) {
+	e := newTestEngine()
+
+	limit(e, 1, Ask, 100, 2, 1, GTC)
+	limit(e, 1, Ask, 101, 2, 1, GTC)
+	limit(e, 1, Bid, 101, 3, 2, GTC) // Buyer lifts both levels
+	limit(e, 1, Bid, 90, 5, 3, GTC)
+	limit(e, 1, Ask, 90, 1, 4, GTC) // Seller hits the bid
+	e.outputRing.Close()
+
+	var trades []Trade
+	var executions int
+	e.OnTrade(func(tr Trade) { trades = append(trades, tr) })
+	e.StartOutputDistributor(func(ev OutputEvent) {
+		if ev.eventType == EXECUTION_EVENT && !ev.maker {
+			executions++
+		}
+	})
+
+	expected := []Trade{
+		{id: 1, symbol: 1, price: 100, size: 2, aggressor: Bid},
+		{id: 2, symbol: 1, price: 101, size: 1, aggressor: Bid},
+		{id: 3, symbol: 1, price: 90, size: 1, aggressor: Ask},
+	}
+	if executions != len(expected) || len(trades) != len(expected) {
+		t.Fatalf("expected %d trades alongside %d executions, got %v", len(expected), executions, trades)
+	}
+	for i := range expected {
+		if trades[i] != expected[i] {
+			t.Fatalf("trade %d: expected %+v, got %+v", i, expected[i], trades[i])
+		}
+	}
+}
+
+func TestTradeIDs_GapFreeAcrossManyFills(t *testing.T) {
+	e := newTestEngine()
+
+	var next TradeID = 1
+	check := func() {
+		for _, ev := range drainOutputEvents(e) {
+			if ev.eventType != EXECUTION_EVENT || ev.maker {
+				continue
+			}
+			if ev.tradeID != next {
+				t.Fatalf("expected trade id %d, got %d", next, ev.tradeID)
+			}
+			next++
+		}
+	}
+
+	// Alternate resting ladders and sweeps, so fills come from multi-level and partial matches
+	for round := 0; round < 200; round++ {
+		for i := Price(0); i < 5; i++ {
+			limit(e, 1, Ask, 100+i, 2, 1, GTC)
+		}
+		limit(e, 1, Bid, 104, 7, 2, IOC)
+		limit(e, 1, Bid, 104, 3, 2, GTC) // Takes the last 3, resting nothing
+		check()
+	}
+	if next-1 != 200*6 {
+		t.Fatalf("expected %d fills, got %d", 200*6, next-1)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+// Segment tree of the visible volume at each price of one side of a book, kept only with
+// EngineConfig.volumeTrees. Leaves are padded to a power of two, so node i has children 2i and 2i+1
+// and the leaf for price p is node leaves+p; each inner node holds the sum of its children, and the
+// root (node 1) the side's total volume
+type volumeTree struct {
+	nodes  []uint64
+	leaves Price
+}
+
+func newVolumeTree(levels Price) volumeTree {
+	leaves := Price(1)
+	for leaves < levels {
+		leaves <<= 1
+	}
+	return volumeTree{nodes: make([]uint64, 2*leaves), leaves: leaves}
+}
+
+// Set the volume at price, updating its ancestors (a no-op for a book without trees)
+func (t *volumeTree) set(price Price, volume Size) {
+	if t.nodes == nil {
+		return
+	}
+	i := t.leaves + price
+	t.nodes[i] = uint64(volume)
+	for i >>= 1; i > 0; i >>= 1 {
+		t.nodes[i] = t.nodes[2*i] + t.nodes[2*i+1]
+	}
+}
+
+// Total volume at prices low..high inclusive
+func (t *volumeTree) sum(low, high Price) uint64 {
+	var total uint64
+	for l, r := t.leaves+low, t.leaves+high+1; l < r; l, r = l>>1, r>>1 {
+		if l&1 != 0 {
+			total += t.nodes[l]
+			l++
+		}
+		if r&1 != 0 {
+			r--
+			total += t.nodes[r]
+		}
+	}
+	return total
+}
+
+// Visible volume tree of one side of the book
+func (book *OrderBook) volumes(side Side) *volumeTree {
+	if side == Bid {
+		return &book.bidVolumes
+	}
+	return &book.askVolumes
+}
+
+// VolumeBetween returns the total visible volume resting on one side of a symbol's book at prices
+// low..high inclusive (hidden iceberg reserve is excluded), for imbalance and liquidity measures. With
+// EngineConfig.volumeTrees it is a range query costing O(log price levels); otherwise it walks the
+// non-empty levels in the range. Must run on the matching thread (or while it is idle), like Depth
+func (e *MatchingEngine) VolumeBetween(symbol Symbol, side Side, low, high Price) uint64 {
+	if symbol >= MAX_SYMBOLS || side > Ask {
+		return 0
+	}
+	book := &e.books[symbol]
+	high = min(high, book.priceLevels()-1)
+	if low > high {
+		return 0
+	}
+
+	if tree := book.volumes(side); tree.nodes != nil {
+		return tree.sum(low, high)
+	}
+	var total uint64
+	bits := book.bits(side)
+	for price := bits.next(low); price <= high; price = bits.next(price + 1) {
+		total += uint64(book.level(side, price).volume)
+	}
+	return total
+}
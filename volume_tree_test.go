@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestVolumeBetween_TreeMatchesLevelWalk(t *testing.T) {
+	walked := newTestEngineWithConfig(EngineConfig{priceLevels: 200, sparseBooks: true})
+	tree := newTestEngineWithConfig(EngineConfig{priceLevels: 200, sparseBooks: true, volumeTrees: true})
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 2000; i++ {
+		cmd := InputCommand{symbol: 1, side: Side(rng.Intn(2)), price: Price(80 + rng.Intn(41)), size: Size(1 + rng.Intn(20)), trader: TraderID(rng.Intn(5))}
+		if rng.Intn(4) == 0 {
+			cmd.peakSize = Size(1 + rng.Intn(5))
+		}
+		for _, e := range []*MatchingEngine{walked, tree} {
+			e.LimitCommand(&cmd)
+			drainOutputEvents(e)
+		}
+
+		side, low := Side(rng.Intn(2)), Price(rng.Intn(200))
+		high := low + Price(rng.Intn(300)) // Past the last price level too
+		if want, got := walked.VolumeBetween(1, side, low, high), tree.VolumeBetween(1, side, low, high); got != want {
+			t.Fatalf("after order %d: side %d %d..%d expected %d, got %d from the tree", i, side, low, high, want, got)
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.VolumeBetween(1, Bid, 0, 199) + tree.VolumeBetween(1, Ask, 0, 199); got == 0 {
+		t.Fatal("expected volume resting on the book")
+	}
+	if got := tree.VolumeBetween(1, Bid, 120, 80); got != 0 {
+		t.Fatalf("expected an empty range to hold nothing, got %d", got)
+	}
+}
+
+func TestVolumeBetween_TreeFollowsRestore(t *testing.T) {
+	e := newTestEngineWithConfig(EngineConfig{priceLevels: 256, sparseBooks: true})
+	limit(e, 1, Bid, 10, 5, 1, GTC)
+	limit(e, 1, Bid, 12, 3, 1, GTC)
+	limit(e, 1, Ask, 15, 4, 2, GTC)
+	var full bytes.Buffer
+	if err := e.SaveSnapshot(&full); err != nil {
+		t.Fatal(err)
+	}
+
+	config := EngineConfig{priceLevels: 256, sparseBooks: true, volumeTrees: true}
+	loaded := newTestEngineWithConfig(config)
+	if err := loaded.LoadSnapshot(&full); err != nil {
+		t.Fatal(err)
+	}
+	restored := newTestEngineWithConfig(config)
+	if err := restored.Restore(1, e.Snapshot(1)); err != nil {
+		t.Fatal(err)
+	}
+	for name, e := range map[string]*MatchingEngine{"LoadSnapshot": loaded, "Restore": restored} {
+		if got := e.VolumeBetween(1, Bid, 10, 12); got != 8 {
+			t.Fatalf("%s: expected 8 bid volume, got %d", name, got)
+		}
+		if err := e.Validate(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	restored.books[1].bidVolumes.set(11, 1) // A leaf out of step with its level
+	if err := restored.Validate(); !errors.Is(err, ErrBookInvalid) {
+		t.Fatalf("expected a stale volume tree to be reported, got %v", err)
+	}
+}
+
+// Volume across a 1,000-tick range with every level non-empty, walking the levels
+func BenchmarkVolumeBetween_LevelWalk(b *testing.B) {
+	benchmarkVolumeBetween(b, false)
+}
+
+// Volume across a 1,000-tick range with every level non-empty, as a tree range query
+func BenchmarkVolumeBetween_VolumeTree(b *testing.B) {
+	benchmarkVolumeBetween(b, true)
+}
+
+func benchmarkVolumeBetween(b *testing.B, trees bool) {
+	e := newTestEngineWithConfig(EngineConfig{sparseBooks: true, volumeTrees: trees})
+	for price := Price(1000); price < 2000; price++ {
+		limit(e, 1, Bid, price, 1, 1, GTC)
+	}
+	drainOutputEvents(e)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if e.VolumeBetween(1, Bid, 1000, 1999) != 1000 {
+			b.Fatal("wrong volume")
+		}
+	}
+}
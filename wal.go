@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// Each WAL record is the command's 8-byte sequence number followed by its binary frame
+const WAL_RECORD_SIZE = 8 + COMMAND_FRAME_SIZE
+
+var ErrWALCorrupt = errors.New("wal: malformed or out-of-sequence record")
+
+// Append-only write-ahead log of input commands. Records are buffered by Append and made durable by
+// Sync, so a batch of commands costs one fsync
+type WAL struct {
+	file   *os.File
+	writer *bufio.Writer
+	seq    uint64 // Sequence number of the last record appended
+	record []byte
+}
+
+// OpenWAL opens (or creates) the log at path for appending. The sequence continues from the last
+// complete record; a torn record left by a crash mid-write is truncated away
+func OpenWAL(path string) (*WAL, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	seq, end, err := scanWAL(file, 0, nil)
+	if err == nil {
+		err = file.Truncate(end)
+	}
+	if err == nil {
+		_, err = file.Seek(end, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &WAL{
+		file:   file,
+		writer: bufio.NewWriterSize(file, WAL_RECORD_SIZE*DISTRIBUTOR_BUFFER),
+		seq:    seq,
+		record: make([]byte, 0, WAL_RECORD_SIZE),
+	}, nil
+}
+
+// Append buffers cmd as the next record and returns its sequence number. It is not durable until Sync
+func (w *WAL) Append(cmd *InputCommand) (uint64, error) {
+	w.seq++
+	w.record = binary.LittleEndian.AppendUint64(w.record[:0], w.seq)
+	w.record = AppendCommand(w.record, cmd)
+	_, err := w.writer.Write(w.record)
+	return w.seq, err
+}
+
+// Sync flushes buffered records and fsyncs the file
+func (w *WAL) Sync() error {
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// Seq returns the sequence number of the last record appended
+func (w *WAL) Seq() uint64 {
+	return w.seq
+}
+
+// Close syncs and closes the log
+func (w *WAL) Close() error {
+	err := w.Sync()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReplayWAL calls fn for every record in the log at path with a sequence number after `after`, in
+// order, and returns the last sequence number read. A torn final record is ignored
+func ReplayWAL(path string, after uint64, fn func(seq uint64, cmd *InputCommand)) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	seq, _, err := scanWAL(file, after, fn)
+	return seq, err
+}
+
+// Read records from r, checking sequence numbers are contiguous, and pass those after `after` to fn
+// (if set). Returns the last sequence number and the byte offset where the complete records end
+func scanWAL(r io.Reader, after uint64, fn func(seq uint64, cmd *InputCommand)) (uint64, int64, error) {
+	reader := bufio.NewReader(r)
+	record := make([]byte, WAL_RECORD_SIZE)
+	var cmd InputCommand
+	var seq uint64
+	var end int64
+
+	for {
+		if _, err := io.ReadFull(reader, record); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return seq, end, nil // Clean end, or a torn final record
+		} else if err != nil {
+			return seq, end, err
+		}
+
+		next := binary.LittleEndian.Uint64(record)
+		if (seq != 0 && next != seq+1) || DecodeCommand(record[8:], &cmd) != nil {
+			return seq, end, ErrWALCorrupt
+		}
+		seq = next
+		end += WAL_RECORD_SIZE
+
+		if fn != nil && seq > after {
+			fn(seq, &cmd)
+		}
+	}
+}
+
+// Replay applies every command in the log at path after the last one the engine has applied (none
+// for a fresh engine, or the snapshot's sequence after LoadSnapshot). Matching is deterministic
+// (order ids come from the pool's free list and expiry sweeps are logged commands carrying their own
+// time), so replaying the same log into the same starting state reaches the same engine state
+func (e *MatchingEngine) Replay(path string) error {
+	_, err := ReplayWAL(path, e.seq, func(seq uint64, cmd *InputCommand) {
+		e.dispatch(cmd)
+		e.seq = seq
+	})
+	return err
+}
+
+// ReplayCommands applies a stream of WAL records (a log captured from production, say) to a fresh
+// engine built with config, which should match the live engine's, and returns it along with every output event the commands produced, in order. The commands
+// run through the usual distributors, so the matching is exactly the live engine's; as it is
+// deterministic (see Replay), the same stream always yields the same events. A torn final record is
+// ignored, and the events of the commands before a corrupt record are still returned with the error
+func ReplayCommands(r io.Reader, config EngineConfig) (*MatchingEngine, []OutputEvent, error) {
+	e := NewMatchingEngineWithConfig(config)
+	var events []OutputEvent
+	done := make(chan struct{})
+	go func() {
+		e.StartOutputDistributor(func(ev OutputEvent) { events = append(events, ev) })
+		close(done)
+	}()
+	go e.StartInputDistributor()
+
+	seq, _, err := scanWAL(r, 0, func(_ uint64, cmd *InputCommand) { e.inputRing.Push(*cmd) })
+	e.Stop()
+	<-done
+	e.seq = seq
+	return e, events, err
+}
+
+// StartLoggedInputDistributor is StartInputDistributor with every command durably written to wal
+// before it reaches the matching engine: each batch read from the input ring is appended and
+// fsynced once, then applied. If snapshotEvery is non-zero, a full engine snapshot is also written
+// to snapshotPath once at least that many commands have been applied since the last one, bounding
+// how much of the log recovery has to replay. A WAL or snapshot write failure panics, as the engine
+// cannot continue durably. Shuts down on Stop like StartInputDistributor; the caller closes wal
+func (e *MatchingEngine) StartLoggedInputDistributor(wal *WAL, snapshotEvery uint64, snapshotPath string) {
+	defer e.pinThread(INPUT_THREAD)()
+	buf := make([]InputCommand, DISTRIBUTOR_BUFFER)
+	lastSnapshot := e.seq
+	for {
+		n := e.inputRing.Read(buf)
+		if n == 0 {
+			e.outputRing.Close()
+			return
+		}
+		e.applyLogged(wal, buf[:n])
+
+		if snapshotEvery != 0 && e.seq-lastSnapshot >= snapshotEvery {
+			if err := e.SaveSnapshotFile(snapshotPath); err != nil {
+				panic("snapshot: write failed: " + err.Error())
+			}
+			lastSnapshot = e.seq
+		}
+	}
+}
+
+// Log a batch of commands, then apply them
+func (e *MatchingEngine) applyLogged(wal *WAL, batch []InputCommand) {
+	for i := range batch {
+		if _, err := wal.Append(&batch[i]); err != nil {
+			panic("wal: append failed: " + err.Error())
+		}
+	}
+	if err := wal.Sync(); err != nil {
+		panic("wal: sync failed: " + err.Error())
+	}
+	for i := range batch {
+		e.dispatch(&batch[i])
+	}
+	e.seq = wal.Seq()
+}
+
+// Recover rebuilds a fresh engine from the latest snapshot at snapshotPath (if one has been written)
+// and the records logged to walPath after it
+func (e *MatchingEngine) Recover(snapshotPath, walPath string) error {
+	if file, err := os.Open(snapshotPath); err == nil {
+		err = e.LoadSnapshot(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return e.Replay(walPath)
+}
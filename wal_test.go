@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A mix of commands exercising matching, cancels, amends and GTD expiry
+func walTestCommands() []InputCommand {
+	return []InputCommand{
+		{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: 100, size: 10, trader: 1},
+		{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: 101, size: 5, trader: 2, tif: GTD, expiresAt: 50},
+		{eventType: ORDER_EVENT, symbol: 1, side: Ask, price: 105, size: 8, trader: 3, peakSize: 2},
+		{eventType: MARKET_EVENT, symbol: 1, side: Ask, size: 3, trader: 4},
+		{eventType: CANCEL_EVENT, orderID: 1, trader: 1},
+		{eventType: AMEND_EVENT, orderID: 3, price: 104, size: 8},
+		{eventType: ORDER_EVENT, symbol: 2, side: Ask, price: 200, size: 4, trader: 5},
+		{eventType: EXPIRE_EVENT, expiresAt: 60},
+		{eventType: ORDER_EVENT, symbol: 1, side: Bid, price: 104, size: 1, trader: 6},
+	}
+}
+
+func TestWAL_ReplayReachesIdenticalState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "engine.wal")
+	wal, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	live := newTestEngine()
+	cmds := walTestCommands()
+	live.applyLogged(wal, cmds[:4])
+	live.applyLogged(wal, cmds[4:])
+	if err := wal.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	recovered := newTestEngine()
+	if err := recovered.Replay(path); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if recovered.seq != uint64(len(cmds)) {
+		t.Fatalf("expected last sequence %d, got %d", len(cmds), recovered.seq)
+	}
+
+	for _, symbol := range []Symbol{1, 2} {
+		if !bytes.Equal(live.Snapshot(symbol), recovered.Snapshot(symbol)) {
+			t.Fatalf("symbol %d: recovered book differs from live book", symbol)
+		}
+	}
+	if live.pool.freeHead != recovered.pool.freeHead || live.pool.nextFreeSlot != recovered.pool.nextFreeSlot {
+		t.Fatalf("expected identical pool free lists, got heads %d and %d", live.pool.freeHead, recovered.pool.freeHead)
+	}
+}
+
+func TestWAL_TornRecordIsTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "engine.wal")
+	wal, _ := OpenWAL(path)
+	cmds := walTestCommands()
+	for i := range cmds[:3] {
+		wal.Append(&cmds[i])
+	}
+	wal.Close()
+
+	// Simulate a crash part way through writing a fourth record
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	file.Write(make([]byte, WAL_RECORD_SIZE/2))
+	file.Close()
+
+	wal, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if wal.Seq() != 3 {
+		t.Fatalf("expected sequence to continue from 3, got %d", wal.Seq())
+	}
+	if seq, _ := wal.Append(&cmds[3]); seq != 4 {
+		t.Fatalf("expected next sequence 4, got %d", seq)
+	}
+	wal.Close()
+
+	var seqs []uint64
+	if _, err := ReplayWAL(path, 1, func(seq uint64, _ *InputCommand) { seqs = append(seqs, seq) }); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if len(seqs) != 3 || seqs[0] != 2 || seqs[2] != 4 {
+		t.Fatalf("expected records 2-4 after sequence 1, got %v", seqs)
+	}
+}
+
+func TestReplayCommands_ReproducesTheLiveEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "engine.wal")
+	wal, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	live := newTestEngine()
+	live.applyLogged(wal, walTestCommands())
+	want := drainOutputEvents(live)
+	if err := wal.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	var outputs [2][]byte
+	for run := range outputs {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("open failed: %v", err)
+		}
+		e, events, err := ReplayCommands(file, EngineConfig{maxOrders: TEST_MAX_ORDERS})
+		file.Close()
+		if err != nil {
+			t.Fatalf("replay failed: %v", err)
+		}
+
+		if len(events) != len(want) {
+			t.Fatalf("run %d: expected the live engine's %d events, got %d", run, len(want), len(events))
+		}
+		var out bytes.Buffer
+		write := NewJSONEventWriter(&out)
+		for i := range events {
+			if events[i] != want[i] {
+				t.Fatalf("run %d: event %d differs from the live engine's: %+v vs %+v", run, i, events[i], want[i])
+			}
+			write(events[i])
+		}
+		outputs[run] = out.Bytes()
+
+		if e.seq != uint64(len(walTestCommands())) || !bytes.Equal(e.Snapshot(1), live.Snapshot(1)) {
+			t.Fatalf("run %d: expected the replayed engine to match the live one at sequence %d", run, e.seq)
+		}
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Fatal("expected byte-identical output from replaying the same log twice")
+	}
+}